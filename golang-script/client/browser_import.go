@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// siteDomain is the registrable domain of www and yoyaku. Browser exports
+// also carry ad and analytics cookies of other sites, which are not imported.
+const siteDomain = "cityheaven.net"
+
+// AuthCookieNames are the cookies a logged-in session depends on: lo and
+// member_id are set by loginAuth, PHPSESSID is the www session they belong to.
+var AuthCookieNames = []string{"member_id", "lo", "PHPSESSID"}
+
+// BrowserCookie is one entry of a Playwright cookie export
+// (browserContext.cookies() or the "cookies" of a storage state). A leading
+// dot on Domain marks a domain cookie; without it the cookie is host-only.
+type BrowserCookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain"`
+	Path     string  `json:"path"`
+	Expires  float64 `json:"expires"` // Unix seconds, -1 for a session cookie
+	HttpOnly bool    `json:"httpOnly"`
+	Secure   bool    `json:"secure"`
+	SameSite string  `json:"sameSite"` // Not enforced by the jar
+}
+
+// Stored converts the entry to the form SessionJar keeps.
+func (b BrowserCookie) Stored() StoredCookie {
+	s := StoredCookie{
+		Name:     b.Name,
+		Value:    b.Value,
+		Domain:   strings.ToLower(strings.TrimPrefix(b.Domain, ".")),
+		Path:     b.Path,
+		HostOnly: !strings.HasPrefix(b.Domain, "."),
+		Secure:   b.Secure,
+		HttpOnly: b.HttpOnly,
+	}
+	if s.Path == "" {
+		s.Path = "/"
+	}
+	if b.Expires > 0 {
+		sec, frac := math.Modf(b.Expires)
+		s.Expires = time.Unix(int64(sec), int64(frac*1e9))
+	}
+	return s
+}
+
+// LoadBrowserCookies reads a Playwright cookie export: a JSON array of
+// cookies, or a storage state object with a "cookies" array.
+func LoadBrowserCookies(path string) ([]BrowserCookie, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("browser cookies: %w", err)
+	}
+	var cookies []BrowserCookie
+	if err := json.Unmarshal(data, &cookies); err == nil {
+		return cookies, nil
+	}
+	var state struct {
+		Cookies []BrowserCookie `json:"cookies"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("browser cookies: %s is not a Playwright cookie export: %w", path, err)
+	}
+	return state.Cookies, nil
+}
+
+// LoadLocalStorage reads a localStorage export (a JSON object of string
+// keys and values).
+func LoadLocalStorage(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("local storage: %w", err)
+	}
+	var items map[string]string
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("local storage: %s is not a key/value object: %w", path, err)
+	}
+	return items, nil
+}
+
+// AuthCookie is the state of one auth cookie in a browser export.
+type AuthCookie struct {
+	Name    string
+	Domain  string    // As exported (".www.cityheaven.net", "yoyaku.cityheaven.net", ...)
+	Present bool      // False if the export has no such cookie for the site
+	Expired bool      // Expired at import time (not imported)
+	Expires time.Time // Zero for a session cookie
+}
+
+func (a AuthCookie) String() string {
+	switch {
+	case !a.Present:
+		return a.Name + ": missing"
+	case a.Expired:
+		return fmt.Sprintf("%s (%s): expired %s", a.Name, a.Domain, a.Expires.Format("2006-01-02 15:04 MST"))
+	case a.Expires.IsZero():
+		return fmt.Sprintf("%s (%s): session cookie", a.Name, a.Domain)
+	}
+	return fmt.Sprintf("%s (%s): valid until %s", a.Name, a.Domain, a.Expires.Format("2006-01-02 15:04 MST"))
+}
+
+// BrowserImport reports what ImportBrowserSession loaded.
+type BrowserImport struct {
+	Imported     int          // Site cookies added to the jar
+	Expired      int          // Site cookies skipped as expired
+	ThirdParty   int          // Cookies of other domains, skipped
+	Auth         []AuthCookie // Per AuthCookieNames entry, one per domain it was set for
+	LocalStorage map[string]string
+}
+
+// LoggedIn reports whether every auth cookie is present and unexpired for
+// at least one domain.
+func (r *BrowserImport) LoggedIn() bool {
+	for _, name := range AuthCookieNames {
+		ok := false
+		for _, a := range r.Auth {
+			if a.Name == name && a.Present && !a.Expired {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ImportBrowserSession adds the cityheaven.net cookies of a Playwright
+// export to the client's jar, keeping their domain scoping, and reports the
+// auth cookies. localStoragePath is optional: the client runs no scripts, so
+// localStorage is only loaded for reference. Check the session with
+// SessionValid afterwards; the site may have ended it since the export.
+func (c *LowLatencyClient) ImportBrowserSession(cookiesPath, localStoragePath string) (*BrowserImport, error) {
+	cookies, err := LoadBrowserCookies(cookiesPath)
+	if err != nil {
+		return nil, err
+	}
+	r := &BrowserImport{}
+	if localStoragePath != "" {
+		if r.LocalStorage, err = LoadLocalStorage(localStoragePath); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	var site []StoredCookie
+	for _, b := range cookies {
+		s := b.Stored()
+		if s.Domain != siteDomain && !strings.HasSuffix(s.Domain, "."+siteDomain) {
+			r.ThirdParty++
+			continue
+		}
+		if s.Expired(now) {
+			r.Expired++
+		} else {
+			site = append(site, s)
+		}
+		for _, name := range AuthCookieNames {
+			if s.Name == name {
+				r.Auth = append(r.Auth, AuthCookie{Name: name, Domain: b.Domain, Present: true, Expired: s.Expired(now), Expires: s.Expires})
+			}
+		}
+	}
+	for _, name := range AuthCookieNames {
+		found := false
+		for _, a := range r.Auth {
+			found = found || a.Name == name
+		}
+		if !found {
+			r.Auth = append(r.Auth, AuthCookie{Name: name})
+		}
+	}
+	slices.SortStableFunc(r.Auth, func(a, b AuthCookie) int {
+		return slices.Index(AuthCookieNames, a.Name) - slices.Index(AuthCookieNames, b.Name)
+	})
+	r.Imported = c.jar.Add(site)
+	return r, nil
+}
@@ -0,0 +1,96 @@
+package client_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+)
+
+// writeJSON marshals v to a file in dir.
+func writeJSON(t *testing.T, dir, name string, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportBrowserSession(t *testing.T) {
+	// A "browser" logs in; its cookies are exported the way Playwright does
+	browser, srv := newTestClient(t)
+	if err := browser.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	www, _ := url.Parse("https://www.cityheaven.net/")
+	future := float64(time.Now().Add(48 * time.Hour).Unix())
+	var export []client.BrowserCookie
+	for _, ck := range browser.CookieJar().Cookies(www) {
+		b := client.BrowserCookie{Name: ck.Name, Value: ck.Value, Domain: "www.cityheaven.net", Path: "/", Expires: -1, SameSite: "Lax"}
+		if ck.Name == "lo" || ck.Name == "member_id" {
+			b.Domain, b.Expires = ".www.cityheaven.net", future
+		}
+		export = append(export, b)
+	}
+	export = append(export,
+		client.BrowserCookie{Name: "member_id", Value: "old", Domain: "yoyaku.cityheaven.net", Path: "/", Expires: float64(time.Now().Add(-time.Hour).Unix())},
+		client.BrowserCookie{Name: "khaos", Value: "x", Domain: ".rubiconproject.com", Path: "/", Expires: future, Secure: true, SameSite: "None"},
+	)
+	dir := t.TempDir()
+	cookiesPath := writeJSON(t, dir, "cookies.json", export)
+	storagePath := writeJSON(t, dir, "localStorage.json", map[string]string{"history-girl-pc": `[{"girls_id":"52809022"}]`})
+
+	c := restartClient(t, srv)
+	r, err := c.ImportBrowserSession(cookiesPath, storagePath)
+	if err != nil {
+		t.Fatalf("ImportBrowserSession: %v", err)
+	}
+	if r.Imported != len(export)-2 || r.Expired != 1 || r.ThirdParty != 1 || len(r.LocalStorage) != 1 {
+		t.Errorf("imported %d, expired %d, third-party %d, localStorage %d", r.Imported, r.Expired, r.ThirdParty, len(r.LocalStorage))
+	}
+	var auth []string
+	for _, a := range r.Auth {
+		auth = append(auth, a.String())
+	}
+	got := strings.Join(auth, "; ")
+	for _, want := range []string{"member_id (.www.cityheaven.net): valid until", "member_id (yoyaku.cityheaven.net): expired",
+		"lo (.www.cityheaven.net): valid until", "PHPSESSID (www.cityheaven.net): session cookie"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("auth report %q lacks %q", got, want)
+		}
+	}
+	if !r.LoggedIn() {
+		t.Error("LoggedIn = false with valid member_id, lo and PHPSESSID")
+	}
+
+	if ok, err := c.SessionValid(); err != nil || !ok {
+		t.Fatalf("SessionValid on the imported session = %v, %v", ok, err)
+	}
+	if got, want := cookieNames(c, "https://www.cityheaven.net/niigata/"), cookieNames(browser, "https://www.cityheaven.net/niigata/"); got != want {
+		t.Errorf("www cookies %s, want %s", got, want)
+	}
+	if got := cookieNames(c, "https://yoyaku.cityheaven.net/"); got != "" {
+		t.Errorf("www host-only cookies leaked to yoyaku: %s", got)
+	}
+}
+
+func TestLoadBrowserCookiesStorageState(t *testing.T) {
+	state := map[string]any{"cookies": []client.BrowserCookie{{Name: "lo", Value: "1", Domain: ".www.cityheaven.net", Path: "/", Expires: -1}}}
+	cookies, err := client.LoadBrowserCookies(writeJSON(t, t.TempDir(), "state.json", state))
+	if err != nil || len(cookies) != 1 {
+		t.Fatalf("LoadBrowserCookies = %v, %v", cookies, err)
+	}
+	if s := cookies[0].Stored(); s.HostOnly || s.Domain != "www.cityheaven.net" || !s.Expires.IsZero() {
+		t.Errorf("Stored = %+v, want a www domain session cookie", s)
+	}
+}
@@ -0,0 +1,373 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrCalendarLayout is returned by FetchCalendar when the page carries neither
+// the get_result JSON nor a calendar table it can read. An empty result with a
+// nil error means the calendar was read and nothing is bookable.
+var ErrCalendarLayout = errors.New("calendar page layout not recognized")
+
+// jst is the site's time zone; calendar dates are JST.
+var jst = time.FixedZone("JST", 9*60*60)
+
+// SlotStatus classifies a calendar cell by its acceptance mark and flag.
+type SlotStatus int
+
+const (
+	SlotUnknown   SlotStatus = iota // Mark not recognised
+	SlotAvailable                   // ○ / CAN: bookable online
+	SlotPhoneOnly                   // TEL: bookable by phone only
+	SlotWaitlist                    // △: full, cancel-wait registration possible
+	SlotFull                        // × or -: fully booked or not working
+)
+
+var slotStatusNames = map[SlotStatus]string{
+	SlotUnknown:   "Unknown",
+	SlotAvailable: "Available",
+	SlotPhoneOnly: "PhoneOnly",
+	SlotWaitlist:  "Waitlist",
+	SlotFull:      "Full",
+}
+
+func (s SlotStatus) String() string {
+	if name, ok := slotStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("SlotStatus(%d)", int(s))
+}
+
+// Status classifies the slot from its raw mark and flag.
+func (s Slot) Status() SlotStatus {
+	switch {
+	case s.Mark == "○" || s.Mark == "◎" || s.Flag == "CAN":
+		return SlotAvailable
+	case s.Mark == "TEL" || s.Flag == "TEL":
+		return SlotPhoneOnly
+	case s.Mark == "△":
+		return SlotWaitlist
+	case s.Mark == "×" || s.Mark == "-":
+		return SlotFull
+	}
+	return SlotUnknown
+}
+
+// Available reports whether the slot can be booked online.
+func (s Slot) Available() bool {
+	return s.Status() == SlotAvailable
+}
+
+// Key identifies the slot's cell, e.g. "2026-02-21 14:00".
+func (s Slot) Key() string {
+	return s.Date + " " + s.DayTime
+}
+
+// newSlot builds a slot for date ("2026-02-21") and dayTime ("14:00") with
+// Start set in JST.
+func newSlot(date, dayTime string) Slot {
+	start, _ := time.ParseInLocation("2006-01-02 15:04", date+" "+dayTime, jst)
+	return Slot{Date: date, DayTime: dayTime, Start: start}
+}
+
+// Calendar is every cell of a calendar page (usually two weeks), not just
+// the bookable ones.
+type Calendar struct {
+	ShopID string
+	Dates  []string // Columns in page order, e.g. "2026-02-21"
+	Times  []string // Rows in ascending order, e.g. "14:00"
+	Slots  []Slot   // Every cell read, in page order
+}
+
+// At returns the cell for date and dayTime.
+func (c *Calendar) At(date, dayTime string) (Slot, bool) {
+	for _, s := range c.Slots {
+		if s.Date == date && s.DayTime == dayTime {
+			return s, true
+		}
+	}
+	return Slot{}, false
+}
+
+// Grid returns the cells as rows of Times by columns of Dates. Cells the page
+// did not list are zero Slots.
+func (c *Calendar) Grid() [][]Slot {
+	row := map[string]int{}
+	for i, t := range c.Times {
+		row[t] = i
+	}
+	col := map[string]int{}
+	for i, d := range c.Dates {
+		col[d] = i
+	}
+	grid := make([][]Slot, len(c.Times))
+	for i := range grid {
+		grid[i] = make([]Slot, len(c.Dates))
+	}
+	for _, s := range c.Slots {
+		grid[row[s.DayTime]][col[s.Date]] = s
+	}
+	return grid
+}
+
+// Filter returns the slots with the given status, in page order.
+func (c *Calendar) Filter(status SlotStatus) []Slot {
+	var out []Slot
+	for _, s := range c.Slots {
+		if s.Status() == status {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Available returns the slots that can be booked online.
+func (c *Calendar) Available() []Slot {
+	return c.Filter(SlotAvailable)
+}
+
+// Render draws the grid as text, one row per time, with the raw marks.
+func (c *Calendar) Render() string {
+	var b strings.Builder
+	b.WriteString("     ")
+	for _, d := range c.Dates {
+		fmt.Fprintf(&b, " %5s", d[5:]) // "02-21"
+	}
+	b.WriteString("\n")
+	for i, row := range c.Grid() {
+		b.WriteString(c.Times[i])
+		for _, s := range row {
+			mark := s.Mark
+			if mark == "" {
+				mark = "."
+			}
+			fmt.Fprintf(&b, " %5s", mark)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// add appends a cell, keeping Dates in first-seen order and Times sorted.
+func (c *Calendar) add(s Slot) {
+	if !slices.Contains(c.Dates, s.Date) {
+		c.Dates = append(c.Dates, s.Date)
+	}
+	if i, found := slices.BinarySearch(c.Times, s.DayTime); !found {
+		c.Times = slices.Insert(c.Times, i, s.DayTime)
+	}
+	c.Slots = append(c.Slots, s)
+}
+
+// getResultRe extracts the calendar JSON: var get_result = '{...}';
+var getResultRe = regexp.MustCompile(`var get_result = '(\{.*?\})';`)
+
+// ParseCalendar returns the bookable slots of a calendar page.
+func ParseCalendar(body []byte) ([]Slot, error) {
+	cal, err := ParseCalendarGrid(body)
+	if err != nil {
+		return nil, err
+	}
+	return cal.Available(), nil
+}
+
+// ParseCalendarGrid reads every cell of a calendar page. The JSON embedded in
+// the page is preferred; if it is missing, the rendered table.cth is read
+// instead.
+func ParseCalendarGrid(body []byte) (*Calendar, error) {
+	if match := getResultRe.FindSubmatch(body); len(match) >= 2 {
+		return parseCalendarJSON(match[1])
+	}
+
+	log.Println("Warning: Could not find 'get_result' JSON in page. Trying table.cth fallback...")
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCalendarLayout, err)
+	}
+	table := doc.Find("table.cth").First()
+	if table.Length() == 0 {
+		return nil, fmt.Errorf("%w: no get_result JSON and no table.cth", ErrCalendarLayout)
+	}
+	return parseCalendarTable(table, time.Now())
+}
+
+func parseCalendarJSON(jsonStr []byte) (*Calendar, error) {
+	// Data structures for JSON
+	type SlotRaw struct {
+		Date          string      `json:"date"`
+		Time          string      `json:"time"` // "1000"
+		GirlID        interface{} `json:"girl_id"`
+		AcpStatusMark string      `json:"acp_status_mark"`
+		AcpStatusFlg  string      `json:"acp_status_flg"`
+	}
+
+	type CalendarData struct {
+		ShopID         interface{}            `json:"shop_id"`
+		CommuAcpStatus []map[string][]SlotRaw `json:"commu_acp_status"`
+	}
+
+	var data CalendarData
+	if err := json.Unmarshal(jsonStr, &data); err != nil {
+		return nil, fmt.Errorf("%w: bad get_result JSON: %v", ErrCalendarLayout, err)
+	}
+	if data.ShopID != nil {
+		log.Printf("Found shop_id in JSON: %v", jsonID(data.ShopID))
+	} else {
+		log.Println("shop_id NOT FOUND in JSON root")
+	}
+
+	cal := &Calendar{ShopID: jsonID(data.ShopID)}
+
+	// Iterate through the array of daily objects
+	for _, dayMap := range data.CommuAcpStatus {
+		for _, slots := range dayMap {
+			for _, s := range slots {
+				// Format time "1000" -> "10:00"
+				timeFormatted := s.Time
+				if len(s.Time) == 4 {
+					timeFormatted = fmt.Sprintf("%s:%s", s.Time[:2], s.Time[2:])
+				}
+
+				slot := newSlot(s.Date, timeFormatted)
+				slot.GirlID = jsonID(s.GirlID)
+				slot.Mark = s.AcpStatusMark
+				slot.Flag = s.AcpStatusFlg
+				logSlotCheck(slot)
+				cal.add(slot)
+			}
+		}
+	}
+
+	return cal, nil
+}
+
+// jsonID formats an ID the JSON may carry as a number or a string.
+func jsonID(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	}
+	return ""
+}
+
+var (
+	// Header cells: "2026/02/21(土)", "2026-02-21", "2/21(土)" or "02/21"
+	tableFullDate = regexp.MustCompile(`(\d{4})[/-](\d{1,2})[/-](\d{1,2})`)
+	tableDate     = regexp.MustCompile(`(\d{1,2})/(\d{1,2})`)
+	// Row headers: data-sys_time="14:00-" or the text "14:00-"
+	tableTime = regexp.MustCompile(`(\d{1,2}):(\d{2})`)
+)
+
+// parseCalendarTable reads the calendar grid: th.day headers carry the dates,
+// each tbody row starts with a th.daytime-child time and has one cell per day
+// holding the acceptance mark (○ bookable, △, TEL, ×). The page served
+// without JavaScript has empty headers and cells; that is reported as
+// ErrCalendarLayout rather than "no availability". now resolves the year of
+// headers written without one.
+func parseCalendarTable(table *goquery.Selection, now time.Time) (*Calendar, error) {
+	var dates []string
+	table.Find("thead th.day").Each(func(i int, th *goquery.Selection) {
+		dates = append(dates, tableHeaderDate(th, now))
+	})
+	known := 0
+	for _, d := range dates {
+		if d != "" {
+			known++
+		}
+	}
+	if known == 0 {
+		return nil, fmt.Errorf("%w: table.cth has no dates in its header (page not rendered?)", ErrCalendarLayout)
+	}
+
+	cal := &Calendar{}
+	rows := 0
+	table.Find("tbody tr").Each(func(i int, tr *goquery.Selection) {
+		th := tr.Find("th").First()
+		m := tableTime.FindStringSubmatch(th.AttrOr("data-sys_time", th.Text()))
+		if m == nil {
+			return
+		}
+		rows++
+		hour, _ := strconv.Atoi(m[1])
+		dayTime := fmt.Sprintf("%02d:%s", hour, m[2])
+
+		tr.Find("td").Each(func(col int, td *goquery.Selection) {
+			if col >= len(dates) || dates[col] == "" {
+				return
+			}
+			mark := tableCellMark(td)
+			if mark == "" {
+				return
+			}
+			slot := newSlot(dates[col], dayTime)
+			slot.Mark = mark
+			logSlotCheck(slot)
+			cal.add(slot)
+		})
+	})
+
+	if rows == 0 || len(cal.Slots) == 0 {
+		return nil, fmt.Errorf("%w: table.cth has %d time rows and %d marked cells", ErrCalendarLayout, rows, len(cal.Slots))
+	}
+	return cal, nil
+}
+
+// tableHeaderDate returns the header's date as YYYY-MM-DD, or "" if it has none.
+func tableHeaderDate(th *goquery.Selection, now time.Time) string {
+	for _, s := range []string{th.AttrOr("data-date", ""), th.AttrOr("data-day", ""), th.Text()} {
+		if m := tableFullDate.FindStringSubmatch(s); m != nil {
+			y, _ := strconv.Atoi(m[1])
+			mo, _ := strconv.Atoi(m[2])
+			d, _ := strconv.Atoi(m[3])
+			return fmt.Sprintf("%04d-%02d-%02d", y, mo, d)
+		}
+		if m := tableDate.FindStringSubmatch(s); m != nil {
+			mo, _ := strconv.Atoi(m[1])
+			d, _ := strconv.Atoi(m[2])
+			return inferYear(mo, d, now).Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// inferYear places month/day in the year that keeps it closest to now, so a
+// calendar spanning New Year resolves "1/2" to the next year.
+func inferYear(month, day int, now time.Time) time.Time {
+	now = now.In(jst)
+	t := time.Date(now.Year(), time.Month(month), day, 0, 0, 0, 0, jst)
+	if t.Before(now.AddDate(0, -6, 0)) {
+		t = t.AddDate(1, 0, 0)
+	}
+	return t
+}
+
+// tableCellMark returns the acceptance mark shown in a cell, from its text or
+// the alt text of an image.
+func tableCellMark(td *goquery.Selection) string {
+	mark := strings.TrimSpace(td.Text())
+	if mark == "" {
+		mark = strings.TrimSpace(td.Find("img").AttrOr("alt", ""))
+	}
+	return mark
+}
+
+func logSlotCheck(s Slot) {
+	statusLog := "Full/UA"
+	if s.Available() {
+		statusLog = "AVAILABLE"
+	}
+	// VERBOSE LOGGING per user request
+	log.Printf("    Checking [%s %s] -> %s (%s)", s.Date, s.DayTime, statusLog, s.Mark)
+}
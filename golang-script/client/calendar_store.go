@@ -0,0 +1,161 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CalendarEventKind is what changed in a calendar cell between two passes.
+type CalendarEventKind int
+
+const (
+	SlotOpened        CalendarEventKind = iota // Became bookable online (a cancellation or new release)
+	SlotClosed                                 // Was bookable, now is not (or dropped off the calendar)
+	SlotStatusChanged                          // Any other change of status, e.g. × → △
+)
+
+var calendarEventNames = map[CalendarEventKind]string{
+	SlotOpened:        "Opened",
+	SlotClosed:        "Closed",
+	SlotStatusChanged: "StatusChanged",
+}
+
+func (k CalendarEventKind) String() string {
+	if name, ok := calendarEventNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("CalendarEventKind(%d)", int(k))
+}
+
+// CalendarEvent is one cell change. Slot is the cell as now read, or as last
+// read if it dropped off the calendar.
+type CalendarEvent struct {
+	Kind   CalendarEventKind
+	GirlID string
+	Slot   Slot
+	Before SlotStatus // SlotUnknown if the cell is new
+	After  SlotStatus // SlotUnknown if the cell is gone
+	At     time.Time  // When the new snapshot was stored
+}
+
+func (e CalendarEvent) String() string {
+	return fmt.Sprintf("%s girl %s %s (%s → %s)", e.Kind, e.GirlID, e.Slot.Key(), e.Before, e.After)
+}
+
+// CalendarDiff is the result of storing a new snapshot for a girl.
+type CalendarDiff struct {
+	GirlID string
+	// Initial is set when there was no earlier snapshot. Every bookable slot
+	// then counts as opened, so the first pass acts on what is already open.
+	Initial bool
+	Events  []CalendarEvent
+}
+
+// Opened returns the slots that became bookable since the previous pass.
+func (d CalendarDiff) Opened() []Slot {
+	var out []Slot
+	for _, e := range d.Events {
+		if e.Kind == SlotOpened {
+			out = append(out, e.Slot)
+		}
+	}
+	return out
+}
+
+// DiffCalendars compares two snapshots of a girl's calendar. prev may be nil.
+// Cells that appear or disappear without ever being bookable (days scrolling
+// into and out of the two-week window) are not reported.
+func DiffCalendars(girlID string, prev, next *Calendar, at time.Time) CalendarDiff {
+	d := CalendarDiff{GirlID: girlID, Initial: prev == nil}
+	before := map[string]Slot{}
+	if prev != nil {
+		for _, s := range prev.Slots {
+			before[s.Key()] = s
+		}
+	}
+
+	emit := func(kind CalendarEventKind, s Slot, from, to SlotStatus) {
+		d.Events = append(d.Events, CalendarEvent{Kind: kind, GirlID: girlID, Slot: s, Before: from, After: to, At: at})
+	}
+	for _, s := range next.Slots {
+		old, seen := before[s.Key()]
+		delete(before, s.Key())
+		from, to := old.Status(), s.Status()
+		switch {
+		case !seen && to == SlotAvailable:
+			emit(SlotOpened, s, SlotUnknown, to)
+		case !seen:
+			// New cell that is not bookable
+		case from == to:
+			// Unchanged
+		case to == SlotAvailable:
+			emit(SlotOpened, s, from, to)
+		case from == SlotAvailable:
+			emit(SlotClosed, s, from, to)
+		default:
+			emit(SlotStatusChanged, s, from, to)
+		}
+	}
+	if prev != nil {
+		for _, s := range prev.Slots {
+			if _, gone := before[s.Key()]; gone && s.Available() {
+				emit(SlotClosed, s, SlotAvailable, SlotUnknown)
+			}
+		}
+	}
+	return d
+}
+
+// CalendarStore keeps the last calendar read for each girl and reports what
+// changed on every pass. It is safe for concurrent use.
+type CalendarStore struct {
+	mu          sync.Mutex
+	snapshots   map[string]*Calendar
+	updated     map[string]time.Time
+	subscribers []func(CalendarEvent)
+}
+
+// NewCalendarStore returns an empty store.
+func NewCalendarStore() *CalendarStore {
+	return &CalendarStore{
+		snapshots: map[string]*Calendar{},
+		updated:   map[string]time.Time{},
+	}
+}
+
+// Subscribe registers fn to be called with every event, in order, from the
+// goroutine calling Update.
+func (s *CalendarStore) Subscribe(fn func(CalendarEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Update stores cal as the girl's latest snapshot, notifies subscribers of
+// the changes and returns them.
+func (s *CalendarStore) Update(girlID string, cal *Calendar) CalendarDiff {
+	now := time.Now()
+	s.mu.Lock()
+	diff := DiffCalendars(girlID, s.snapshots[girlID], cal, now)
+	s.snapshots[girlID] = cal
+	s.updated[girlID] = now
+	subscribers := slices.Clone(s.subscribers)
+	s.mu.Unlock()
+
+	for _, e := range diff.Events {
+		for _, fn := range subscribers {
+			fn(e)
+		}
+	}
+	return diff
+}
+
+// Snapshot returns the girl's last stored calendar and when it was stored.
+func (s *CalendarStore) Snapshot(girlID string) (*Calendar, time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cal, ok := s.snapshots[girlID]
+	return cal, s.updated[girlID], ok
+}
@@ -0,0 +1,61 @@
+package client_test
+
+import (
+	"testing"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+func TestCalendarStoreDiff(t *testing.T) {
+	c, srv := newTestClient(t)
+	open := newFlow(t, c, srv).Slot
+	store := client.NewCalendarStore()
+
+	var events []string
+	store.Subscribe(func(e client.CalendarEvent) { events = append(events, e.String()) })
+
+	cal, err := c.FetchCalendarGrid(s6URL)
+	if err != nil {
+		t.Fatalf("FetchCalendarGrid: %v", err)
+	}
+	diff := store.Update(testGirlID, cal)
+	if !diff.Initial || keys(diff.Opened()) != open.Key() {
+		t.Fatalf("first pass: initial=%v opened=%s, want the open slot", diff.Initial, keys(diff.Opened()))
+	}
+
+	// Nothing changed
+	cal, _ = c.FetchCalendarGrid(s6URL)
+	if diff := store.Update(testGirlID, cal); diff.Initial || len(diff.Events) != 0 {
+		t.Fatalf("unchanged pass: %+v", diff)
+	}
+
+	// 14:00 is taken, 15:00 goes from phone-only to waitlist, 16:00 is a cancellation
+	events = nil
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: open.Date, Time: "1400", Mark: "×", Flg: "NG"})
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: open.Date, Time: "1500", Mark: "△", Flg: "NG"})
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: open.Date, Time: "1600", Mark: "○", Flg: "CAN"})
+	cal, _ = c.FetchCalendarGrid(s6URL)
+	diff = store.Update(testGirlID, cal)
+
+	if got, want := keys(diff.Opened()), open.Date+" 16:00"; got != want {
+		t.Errorf("opened = %s, want %s", got, want)
+	}
+	want := []string{
+		"Closed girl " + testGirlID + " " + open.Date + " 14:00 (Available → Full)",
+		"StatusChanged girl " + testGirlID + " " + open.Date + " 15:00 (PhoneOnly → Waitlist)",
+		"Opened girl " + testGirlID + " " + open.Date + " 16:00 (Unknown → Available)",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, events[i], want[i])
+		}
+	}
+
+	if snap, _, ok := store.Snapshot(testGirlID); !ok || snap != cal {
+		t.Errorf("Snapshot did not return the last calendar")
+	}
+}
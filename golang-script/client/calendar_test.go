@@ -0,0 +1,134 @@
+package client_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+)
+
+func parseFixture(t *testing.T, name string) ([]client.Slot, error) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.ParseCalendar(body)
+}
+
+func keys(slots []client.Slot) string {
+	var out []string
+	for _, s := range slots {
+		out = append(out, s.Key())
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestParseCalendarJSON(t *testing.T) {
+	slots, err := parseFixture(t, "calendar_json.html")
+	if err != nil {
+		t.Fatalf("ParseCalendar: %v", err)
+	}
+	if got, want := keys(slots), "2026-02-21 14:00, 2026-02-22 11:30"; got != want {
+		t.Fatalf("slots = %s, want %s", got, want)
+	}
+	s := slots[0]
+	start := time.Date(2026, 2, 21, 14, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	if s.GirlID != "52809022" || s.Mark != "○" || s.Flag != "CAN" || !s.Start.Equal(start) || s.Start.Format("-0700") != "+0900" {
+		t.Errorf("slot = %+v", s)
+	}
+}
+
+func TestParseCalendarTable(t *testing.T) {
+	slots, err := parseFixture(t, "calendar_table.html")
+	if err != nil {
+		t.Fatalf("ParseCalendar: %v", err)
+	}
+	// Table headers ("2/21(土)") leave the year to be inferred
+	var got []string
+	for _, s := range slots {
+		got = append(got, s.Date[5:]+" "+s.DayTime)
+	}
+	if want := "02-23 09:00, 02-21 14:00"; strings.Join(got, ", ") != want {
+		t.Errorf("slots = %v, want %s", got, want)
+	}
+}
+
+func TestParseCalendarGrid(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "calendar_json.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal, err := client.ParseCalendarGrid(body)
+	if err != nil {
+		t.Fatalf("ParseCalendarGrid: %v", err)
+	}
+	if cal.ShopID != "2310001233" || len(cal.Slots) != 5 {
+		t.Fatalf("calendar = %+v", cal)
+	}
+	if got := strings.Join(cal.Dates, ","); got != "2026-02-21,2026-02-22" {
+		t.Errorf("dates = %s", got)
+	}
+	if got := strings.Join(cal.Times, ","); got != "10:00,11:30,12:00,14:00,15:00" {
+		t.Errorf("times = %s", got)
+	}
+
+	for status, want := range map[client.SlotStatus]string{
+		client.SlotAvailable: "2026-02-21 14:00, 2026-02-22 11:30",
+		client.SlotPhoneOnly: "2026-02-21 15:00",
+		client.SlotWaitlist:  "2026-02-22 12:00",
+		client.SlotFull:      "2026-02-21 10:00",
+	} {
+		if got := keys(cal.Filter(status)); got != want {
+			t.Errorf("%s = %s, want %s", status, got, want)
+		}
+	}
+
+	grid := cal.Grid()
+	if len(grid) != len(cal.Times) || len(grid[0]) != len(cal.Dates) {
+		t.Fatalf("grid is %dx%d, want %dx%d", len(grid), len(grid[0]), len(cal.Times), len(cal.Dates))
+	}
+	if s := grid[3][0]; s.Key() != "2026-02-21 14:00" || !s.Available() {
+		t.Errorf("grid[14:00][02-21] = %+v", s)
+	}
+	if s := grid[3][1]; s.Date != "" {
+		t.Errorf("grid[14:00][02-22] = %+v, want an empty cell", s)
+	}
+	if s, ok := cal.At("2026-02-21", "15:00"); !ok || s.Status() != client.SlotPhoneOnly {
+		t.Errorf("At(02-21 15:00) = %+v, %v", s, ok)
+	}
+}
+
+func TestParseCalendarNoAvailability(t *testing.T) {
+	for _, name := range []string{"calendar_json_full.html", "calendar_table_full.html"} {
+		t.Run(name, func(t *testing.T) {
+			slots, err := parseFixture(t, name)
+			if err != nil {
+				t.Fatalf("ParseCalendar: got %v, want no error for a fully booked calendar", err)
+			}
+			if len(slots) != 0 {
+				t.Errorf("slots = %v, want none", slots)
+			}
+		})
+	}
+}
+
+func TestParseCalendarLayoutNotRecognized(t *testing.T) {
+	// The page as served before calendar.js fills in the grid
+	if _, err := parseFixture(t, "calendar_skeleton.html"); !errors.Is(err, client.ErrCalendarLayout) {
+		t.Errorf("skeleton table: got %v, want ErrCalendarLayout", err)
+	}
+
+	for name, body := range map[string]string{
+		"no calendar": `<html><body><div id="chart"></div></body></html>`,
+		"bad JSON":    `<script>var get_result = '{"commu_acp_status":"closed"}';</script>`,
+	} {
+		if _, err := client.ParseCalendar([]byte(body)); !errors.Is(err, client.ErrCalendarLayout) {
+			t.Errorf("%s: got %v, want ErrCalendarLayout", name, err)
+		}
+	}
+}
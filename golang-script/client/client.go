@@ -11,8 +11,6 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"net/http/cookiejar"
-	"net/http/httptrace"
 	"net/url"
 	"sync"
 	"time"
@@ -23,6 +21,9 @@ import (
 
 // RequestResult holds the timing and status of a request
 type RequestResult struct {
+	Method               string        `json:"method"`
+	URL                  string        `json:"url"`            // host/path
+	Step                 string        `json:"step,omitempty"` // Flow step the request belongs to
 	StartTime            time.Time     `json:"start_time"`
 	DNSStart             time.Duration `json:"dns_start"`
 	DNSDone              time.Duration `json:"dns_done"`
@@ -36,6 +37,8 @@ type RequestResult struct {
 	StatusCode           int           `json:"status_code"`
 	Protocol             string        `json:"protocol"`
 	ConnectionReused     bool          `json:"connection_reused"`
+	RemoteAddr           string        `json:"remote_addr,omitempty"`
+	Proxy                string        `json:"proxy,omitempty"` // Masked proxy, "" when direct
 	Error                string        `json:"error,omitempty"`
 	Body                 []byte        `json:"-"`
 }
@@ -44,6 +47,8 @@ type RequestResult struct {
 type LowLatencyClient struct {
 	client               *http.Client
 	sessionClient        *http.Client // Standard TLS client for login/age-verification (shares cookie jar)
+	jar                  *SessionJar  // Shared by both clients; see session_store.go
+	yoyaku               *YoyakuSession // Last www → yoyaku handoff; see handoff.go
 	mu                   sync.RWMutex
 	shutdown             bool
 	CancelGlobal         context.CancelFunc
@@ -59,11 +64,22 @@ type LowLatencyClient struct {
 	Scheduler          *Scheduler
 
 	ForceStandardTransport bool
+
+	// OnRequest, if set, is called with every recorded round trip (e.g. to
+	// export latency metrics). It must not block.
+	OnRequest func(RequestResult)
+
+	// stepName is the TagRequests label for requests sent without a flow
+	// step in their context.
+	stepName    string
+	requestLog  []RequestResult
+	stepSamples map[string][]RequestResult // Latency summary samples by step
+	stepOrder   []string
 }
 
 func NewLowLatencyClient(cancel context.CancelFunc, simulateStatus int, pm *ProxyManager, fm *FingerprintManager, cs CaptchaSolver, forceStandard ...bool) *LowLatencyClient {
 	// Create cookie jar for session management (shared between both clients)
-	jar, _ := cookiejar.New(nil)
+	jar := NewSessionJar()
 
 	useStandard := false
 	if len(forceStandard) > 0 && forceStandard[0] {
@@ -81,9 +97,10 @@ func NewLowLatencyClient(cancel context.CancelFunc, simulateStatus int, pm *Prox
 						if parsed, err := url.Parse(p); err == nil {
 							safeProxy := parsed.Host
 							if parsed.User != nil {
-								safeProxy = fmt.Sprintf("%s@%s", parsed.User.Username(), parsed.Host)
+								safeProxy = fmt.Sprintf("******@%s", parsed.Host)
 							}
 							fmt.Printf("   🔄 [Main Proxy] %s %s → via %s://%s\n", req.Method, req.URL.Path, parsed.Scheme, safeProxy)
+							setProxy(req.Context(), parsed.Scheme+"://"+safeProxy)
 						}
 						return url.Parse(p)
 					}
@@ -106,7 +123,7 @@ func NewLowLatencyClient(cancel context.CancelFunc, simulateStatus int, pm *Prox
 		transport = newFingerprintedTransport(pm)
 	}
 
-	return &LowLatencyClient{
+	c := &LowLatencyClient{
 		client: &http.Client{
 			Transport: transport,
 			Timeout:   20 * time.Second,
@@ -132,10 +149,10 @@ func NewLowLatencyClient(cancel context.CancelFunc, simulateStatus int, pm *Prox
 							if parsed, err := url.Parse(p); err == nil {
 								safeProxy := parsed.Host
 								if parsed.User != nil {
-									username := parsed.User.Username()
-									safeProxy = fmt.Sprintf("%s@%s", username, parsed.Host)
+									safeProxy = fmt.Sprintf("******@%s", parsed.Host)
 								}
 								log.Printf("   🔄 [Session Proxy] %s %s → via %s://%s (sticky)", req.Method, req.URL.Path, parsed.Scheme, safeProxy)
+								setProxy(req.Context(), parsed.Scheme+"://"+safeProxy)
 							}
 							return url.Parse(p)
 						}
@@ -150,6 +167,7 @@ func NewLowLatencyClient(cancel context.CancelFunc, simulateStatus int, pm *Prox
 				ExpectContinueTimeout: 1 * time.Second,
 			},
 		},
+		jar:                    jar,
 		CancelGlobal:           cancel,
 		SimulateRemoteStatus:   simulateStatus,
 		ProxyManager:           pm,
@@ -159,6 +177,10 @@ func NewLowLatencyClient(cancel context.CancelFunc, simulateStatus int, pm *Prox
 		Scheduler:              NewScheduler(),
 		ForceStandardTransport: useStandard,
 	}
+	// Both clients share the instrumented round-tripper (see metrics.go)
+	c.client.Transport = c.instrument(c.client.Transport)
+	c.sessionClient.Transport = c.instrument(c.sessionClient.Transport)
+	return c
 }
 
 func newFingerprintedTransport(pm *ProxyManager) http.RoundTripper {
@@ -184,6 +206,7 @@ func newFingerprintedTransport(pm *ProxyManager) http.RoundTripper {
 						safeURL = u.String()
 					}
 					fmt.Printf("   🔄 [Proxy] Rotating to: %s\n", safeURL)
+					setProxy(ctx, safeURL)
 				}
 			}
 
@@ -214,6 +237,7 @@ func newFingerprintedTransport(pm *ProxyManager) http.RoundTripper {
 						safeURL = u.String()
 					}
 					fmt.Printf("   🔄 [Proxy] Rotating to: %s\n", safeURL)
+					setProxy(ctx, safeURL)
 				}
 			}
 
@@ -258,7 +282,7 @@ func newFingerprintedTransport(pm *ProxyManager) http.RoundTripper {
 				return nil, fmt.Errorf("failed to apply preset: %w", err)
 			}
 
-			err = uConn.Handshake()
+			err = traceTLS(ctx, uConn.Handshake)
 			if err != nil {
 				conn.Close()
 				return nil, err
@@ -308,6 +332,13 @@ func (c *LowLatencyClient) Do(req *http.Request) (*http.Response, error) {
 		}
 	}
 
+	// 3. Logged out mid-run? (see checkSession)
+	if err == nil {
+		if err := checkSession(req, resp); err != nil {
+			return nil, err
+		}
+	}
+
 	return resp, err
 }
 
@@ -325,13 +356,25 @@ func (c *LowLatencyClient) DoSession(req *http.Request) (*http.Response, error)
 		return resp, err
 	}
 	log.Printf("   ✅ [DoSession] %s %s → %s (%v)", req.Method, req.URL.String(), resp.Status, duration)
-	return resp, err
+	if err := checkSession(req, resp); err != nil {
+		log.Printf("   🔒 [DoSession] %v", err)
+		return nil, err
+	}
+	return resp, nil
 }
 
 func (c *LowLatencyClient) CookieJar() http.CookieJar {
 	return c.client.Jar
 }
 
+// SetTransport replaces the transport of both the fingerprinted client and the
+// session client (still instrumented). Used by tests to route all traffic to
+// a local mock server.
+func (c *LowLatencyClient) SetTransport(rt http.RoundTripper) {
+	c.client.Transport = c.instrument(rt)
+	c.sessionClient.Transport = c.instrument(rt)
+}
+
 func (c *LowLatencyClient) Shutdown(reason string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -376,29 +419,14 @@ func (c *LowLatencyClient) ExecuteRequestWithHeaders(ctx context.Context, method
 	}
 
 	var start time.Time
-	var dnsStart, dnsDone, connStart, connDone, tlsStart, tlsDone, wroteReq, firstByte time.Time
-	var reused bool
-
-	trace := &httptrace.ClientTrace{
-		DNSStart:             func(_ httptrace.DNSStartInfo) { dnsStart = time.Now() },
-		DNSDone:              func(_ httptrace.DNSDoneInfo) { dnsDone = time.Now() },
-		ConnectStart:         func(_, _ string) { connStart = time.Now() },
-		ConnectDone:          func(network, addr string, err error) { connDone = time.Now() },
-		TLSHandshakeStart:    func() { tlsStart = time.Now() },
-		TLSHandshakeDone:     func(_ stdtls.ConnectionState, _ error) { tlsDone = time.Now() },
-		WroteRequest:         func(_ httptrace.WroteRequestInfo) { wroteReq = time.Now() },
-		GotFirstResponseByte: func() { firstByte = time.Now() },
-		GotConn: func(info httptrace.GotConnInfo) {
-			reused = info.Reused
-		},
-	}
+	ctx, tracer := withTracer(ctx)
 
 	var bodyReader io.Reader
 	if body != nil {
 		bodyReader = bytes.NewReader(body)
 	}
 
-	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, url, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
 		return nil, err
 	}
@@ -451,11 +479,11 @@ func (c *LowLatencyClient) ExecuteRequestWithHeaders(ctx context.Context, method
 				// Re-create request (bodyReader is consumed, need to reset if possible)
 				if body != nil {
 					bodyReader = bytes.NewReader(body)
-					req, _ = http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, url, bodyReader)
+					req, _ = http.NewRequestWithContext(ctx, method, url, bodyReader)
 					// Verify headers again?
 					req.Header.Set("User-Agent", ua)
 				} else {
-					req, _ = http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, url, nil)
+					req, _ = http.NewRequestWithContext(ctx, method, url, nil)
 					req.Header.Set("User-Agent", ua)
 				}
 				// Re-apply headers
@@ -472,39 +500,7 @@ func (c *LowLatencyClient) ExecuteRequestWithHeaders(ctx context.Context, method
 		}
 	}
 
-	total := time.Since(start)
-
-	result := &RequestResult{
-		StartTime:         start,
-		TotalDuration:     total,
-		TLSHandshakeStart: time.Duration(0),
-	}
-
-	if !dnsStart.IsZero() {
-		result.DNSStart = dnsStart.Sub(start)
-	}
-	if !dnsDone.IsZero() {
-		result.DNSDone = dnsDone.Sub(start)
-	}
-	if !connStart.IsZero() {
-		result.ConnectStart = connStart.Sub(start)
-	}
-	if !connDone.IsZero() {
-		result.ConnectDone = connDone.Sub(start)
-	}
-	if !tlsStart.IsZero() {
-		result.TLSHandshakeStart = tlsStart.Sub(start)
-	}
-	if !tlsDone.IsZero() {
-		result.TLSHandshakeDone = tlsDone.Sub(start)
-	}
-	if !wroteReq.IsZero() {
-		result.WroteRequest = wroteReq.Sub(start)
-	}
-	if !firstByte.IsZero() {
-		result.GotFirstResponseByte = firstByte.Sub(start)
-	}
-	result.ConnectionReused = reused
+	result := tracer.result(req, start, resp, err)
 
 	if err != nil {
 		// Handle Safety Checking
@@ -515,7 +511,6 @@ func (c *LowLatencyClient) ExecuteRequestWithHeaders(ctx context.Context, method
 			go c.Shutdown("Received 429 Too Many Requests")
 		}
 
-		result.Error = err.Error()
 		result.Body = []byte{}
 		return result, nil // Return result with error info rather than skipping log
 	}
@@ -525,9 +520,6 @@ func (c *LowLatencyClient) ExecuteRequestWithHeaders(ctx context.Context, method
 		go c.Shutdown(fmt.Sprintf("HTTP %d Detected", resp.StatusCode))
 	}
 
-	result.StatusCode = resp.StatusCode
-	result.Protocol = resp.Proto
-
 	// Read Response Body
 	bodyBytes, _ := io.ReadAll(resp.Body)
 	result.Body = bodyBytes
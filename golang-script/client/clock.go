@@ -0,0 +1,309 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clockWindow is how long a sample is kept. Crystal drift of a few tens
+	// of ppm moves the offset by well under a millisecond in that time.
+	clockWindow = 10 * time.Minute
+	// maxClockSamples caps the samples kept within the window.
+	maxClockSamples = 64
+)
+
+// ClockSample bounds the offset of the server clock from the local clock
+// (server - local) at one moment: the true offset lies in [Low, High].
+type ClockSample struct {
+	Source string // "Date www.cityheaven.net", "SNTP ntp.nict.jp:123", ...
+	At     time.Time
+	Low    time.Duration
+	High   time.Duration
+	RTT    time.Duration
+}
+
+// DateSample turns a response Date header into a sample. The header was
+// written at some local time between sent and received, and has one second
+// resolution, so the offset lies in [date - received, date + 1s - sent].
+func DateSample(source, date string, sent, received time.Time) (ClockSample, error) {
+	d, err := http.ParseTime(date)
+	if err != nil {
+		return ClockSample{}, fmt.Errorf("clock: bad Date header %q: %w", date, err)
+	}
+	return ClockSample{
+		Source: source,
+		At:     received,
+		Low:    d.Sub(received),
+		High:   d.Add(time.Second).Sub(sent),
+		RTT:    received.Sub(sent),
+	}, nil
+}
+
+// ClockEstimate is the combined offset of the server clock from the local
+// one: the samples agree it lies in [Low, High]. Offset is the midpoint and
+// Uncertainty half the width.
+type ClockEstimate struct {
+	Low         time.Duration
+	High        time.Duration
+	Offset      time.Duration
+	Uncertainty time.Duration
+	Samples     int      // Samples that agree on the interval
+	Sources     []string // Distinct sources of those samples
+	MinRTT      time.Duration
+	AvgRTT      time.Duration // Smoothed over every round trip seen
+}
+
+// Calibrated reports whether any sample was taken.
+func (e ClockEstimate) Calibrated() bool {
+	return e.Samples > 0
+}
+
+// Correction is the offset the scheduler applies: zero while the local clock
+// is within the interval (a single Date header only bounds the offset to a
+// second, and the midpoint would move a synchronised clock by up to half of
+// it), otherwise Offset.
+func (e ClockEstimate) Correction() time.Duration {
+	if e.Low <= 0 && 0 <= e.High {
+		return 0
+	}
+	return e.Offset
+}
+
+func (e ClockEstimate) String() string {
+	if !e.Calibrated() {
+		return "not calibrated (local clock)"
+	}
+	return fmt.Sprintf("%+.1f ms ± %.1f ms (%d samples: %s)",
+		float64(e.Offset.Microseconds())/1000, float64(e.Uncertainty.Microseconds())/1000,
+		e.Samples, strings.Join(e.Sources, ", "))
+}
+
+// ServerClock estimates the site's clock from Date headers and optional SNTP
+// queries. Every sample is an interval the offset must lie in; intersecting
+// recent samples narrows it. When a sample contradicts older ones (the local
+// clock was stepped, or the site's servers disagree) the older ones are
+// dropped. It is safe for concurrent use; a nil *ServerClock reports a zero
+// offset.
+type ServerClock struct {
+	mu      sync.Mutex
+	samples []ClockSample
+	minRTT  time.Duration
+	avgRTT  time.Duration
+}
+
+// NewServerClock returns a clock with no samples (zero offset).
+func NewServerClock() *ServerClock {
+	return &ServerClock{}
+}
+
+// Add records a sample.
+func (c *ServerClock) Add(s ClockSample) {
+	if c == nil || s.High < s.Low {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.RTT > 0 {
+		if c.minRTT == 0 || s.RTT < c.minRTT {
+			c.minRTT = s.RTT
+		}
+		if c.avgRTT == 0 {
+			c.avgRTT = s.RTT
+		} else {
+			c.avgRTT += (s.RTT - c.avgRTT) / 8
+		}
+	}
+	c.samples = append(c.samples, s)
+	cutoff := s.At.Add(-clockWindow)
+	c.samples = slices.DeleteFunc(c.samples, func(x ClockSample) bool { return x.At.Before(cutoff) })
+	if len(c.samples) > maxClockSamples {
+		c.samples = c.samples[len(c.samples)-maxClockSamples:]
+	}
+}
+
+// ObserveResponse records the Date header of resp, for a request sent at
+// sent whose headers arrived at received.
+func (c *ServerClock) ObserveResponse(sent, received time.Time, resp *http.Response) {
+	if c == nil || resp == nil {
+		return
+	}
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return
+	}
+	host := ""
+	if resp.Request != nil {
+		host = resp.Request.URL.Host
+	}
+	if s, err := DateSample("Date "+host, date, sent, received); err == nil {
+		c.Add(s)
+	}
+}
+
+// Estimate combines the samples, newest first, until one would leave the
+// interval empty.
+func (c *ServerClock) Estimate() ClockEstimate {
+	if c == nil {
+		return ClockEstimate{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := ClockEstimate{MinRTT: c.minRTT, AvgRTT: c.avgRTT}
+	var low, high time.Duration
+	for i := len(c.samples) - 1; i >= 0; i-- {
+		s := c.samples[i]
+		if e.Samples == 0 {
+			low, high = s.Low, s.High
+		} else {
+			l, h := max(low, s.Low), min(high, s.High)
+			if l > h {
+				break
+			}
+			low, high = l, h
+		}
+		e.Samples++
+		if !slices.Contains(e.Sources, s.Source) {
+			e.Sources = append(e.Sources, s.Source)
+		}
+	}
+	if e.Samples > 0 {
+		e.Low, e.High = low, high
+		e.Offset = low + (high-low)/2
+		e.Uncertainty = (high - low) / 2
+	}
+	return e
+}
+
+// Offset is the server - local offset to schedule with (see Correction).
+func (c *ServerClock) Offset() time.Duration {
+	return c.Estimate().Correction()
+}
+
+// ntpEpochOffset is the number of seconds from 1900 (NTP era 0) to 1970.
+const ntpEpochOffset = 2208988800
+
+// SNTPSample queries an SNTP/NTP server (host:port) once and returns the
+// offset of its clock, bounded by half the network delay either way.
+func SNTPSample(ctx context.Context, addr string) (ClockSample, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return ClockSample{}, fmt.Errorf("sntp %s: %w", addr, err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	conn.SetDeadline(deadline)
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI 0, version 4, mode 3 (client)
+	t1 := time.Now()
+	putNTPTime(req[40:], t1) // Transmit timestamp, echoed as the originate timestamp
+	if _, err := conn.Write(req); err != nil {
+		return ClockSample{}, fmt.Errorf("sntp %s: %w", addr, err)
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	t4 := time.Now()
+	if err != nil {
+		return ClockSample{}, fmt.Errorf("sntp %s: %w", addr, err)
+	}
+	switch {
+	case n < 48:
+		return ClockSample{}, fmt.Errorf("sntp %s: short reply (%d bytes)", addr, n)
+	case resp[0]&0x07 != 4:
+		return ClockSample{}, fmt.Errorf("sntp %s: reply mode %d is not server", addr, resp[0]&0x07)
+	case resp[1] == 0:
+		return ClockSample{}, fmt.Errorf("sntp %s: kiss-o'-death %q", addr, resp[12:16])
+	case binary.BigEndian.Uint64(resp[24:32]) != binary.BigEndian.Uint64(req[40:48]):
+		return ClockSample{}, fmt.Errorf("sntp %s: reply does not answer our request", addr)
+	}
+
+	t2, t3 := ntpTime(resp[32:]), ntpTime(resp[40:])
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+	if delay < 0 {
+		return ClockSample{}, errors.New("sntp " + addr + ": negative round-trip delay")
+	}
+	return ClockSample{
+		Source: "SNTP " + addr,
+		At:     t4,
+		Low:    offset - delay/2,
+		High:   offset + delay/2,
+		RTT:    delay,
+	}, nil
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	binary.BigEndian.PutUint64(b, secs<<32|frac)
+}
+
+func ntpTime(b []byte) time.Time {
+	v := binary.BigEndian.Uint64(b)
+	secs, frac := int64(v>>32), (v&0xffffffff)*1e9>>32
+	return time.Unix(secs-ntpEpochOffset, int64(frac))
+}
+
+// SyncSNTP adds one SNTP sample from addr to the scheduler's clock.
+func (s *Scheduler) SyncSNTP(ctx context.Context, addr string) (ClockSample, error) {
+	sample, err := SNTPSample(ctx, addr)
+	if err != nil {
+		return sample, err
+	}
+	s.Clock.Add(sample)
+	return sample, nil
+}
+
+// CalibrateClock sends samples GET requests to rawURL over the session client
+// and narrows the server clock offset from their Date headers. Each request
+// is timed to reach the server on what the current estimate says is a second
+// boundary, so the one-second header resolution halves the interval every
+// time until the round-trip jitter dominates.
+func (c *LowLatencyClient) CalibrateClock(ctx context.Context, rawURL string, samples int) (ClockEstimate, error) {
+	clock := c.Scheduler.Clock
+	for i := 0; i < samples; i++ {
+		if est := clock.Estimate(); est.Calibrated() {
+			// Local time at which the server clock next reads a whole second
+			// (at least 200ms ahead), less half a round trip
+			server := time.Now().Add(est.Offset + 200*time.Millisecond + est.MinRTT)
+			boundary := server.Truncate(time.Second).Add(time.Second)
+			send := boundary.Add(-est.Offset - est.MinRTT/2)
+			if err := sleepCtx(ctx, time.Until(send)); err != nil {
+				return clock.Estimate(), err
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+		if err != nil {
+			return clock.Estimate(), err
+		}
+		resp, err := c.DoSession(req) // The transport records the Date header
+		if errors.Is(err, ErrSessionExpired) {
+			continue // Age gate before login: its Date header counts all the same
+		}
+		if err != nil {
+			return clock.Estimate(), fmt.Errorf("clock calibration: %w", err)
+		}
+		resp.Body.Close()
+	}
+	return clock.Estimate(), nil
+}
+
+// observeClock feeds the Date header of a response to the scheduler's clock.
+func (c *LowLatencyClient) observeClock(sent time.Time, resp *http.Response) {
+	if c.Scheduler != nil && resp != nil {
+		c.Scheduler.Clock.ObserveResponse(sent, time.Now(), resp)
+	}
+}
@@ -0,0 +1,93 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+func TestClockAgreesWithSite(t *testing.T) {
+	c, srv := newTestClient(t)
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	est := c.Scheduler.Clock.Estimate()
+	if !est.Calibrated() {
+		t.Fatal("no Date samples recorded during login")
+	}
+	// The mock's clock is the local one, so no correction is applied
+	if est.Low > 0 || est.High < 0 || est.Correction() != 0 {
+		t.Errorf("estimate %+v, want an interval around 0 and no correction", est)
+	}
+	if est.MinRTT <= 0 || est.AvgRTT < est.MinRTT {
+		t.Errorf("round trips min %v avg %v", est.MinRTT, est.AvgRTT)
+	}
+}
+
+func TestCalibrateClock(t *testing.T) {
+	c, srv := newTestClient(t)
+	skew := 3*time.Second + 250*time.Millisecond
+	srv.ClockOffset = skew
+
+	est, err := c.CalibrateClock(context.Background(), "https://www.cityheaven.net/", 5)
+	if err != nil {
+		t.Fatalf("CalibrateClock: %v", err)
+	}
+	if est.Low > skew || est.High < skew {
+		t.Fatalf("interval [%v, %v] excludes the skew %v", est.Low, est.High, skew)
+	}
+	if est.Uncertainty > 100*time.Millisecond {
+		t.Errorf("uncertainty %v after 5 samples, want < 100ms", est.Uncertainty)
+	}
+	if d := est.Correction() - skew; d < -est.Uncertainty || d > est.Uncertainty {
+		t.Errorf("correction %v, want %v ± %v", est.Correction(), skew, est.Uncertainty)
+	}
+
+	// A target in server time is reached skew earlier on the local clock
+	start := time.Now()
+	c.Scheduler.SleepUntil(c.Scheduler.Now().Add(50 * time.Millisecond))
+	if waited := time.Since(start); waited > 500*time.Millisecond {
+		t.Errorf("waited %v for a target 50ms ahead in server time", waited)
+	}
+}
+
+func TestSyncSNTP(t *testing.T) {
+	c, _ := newTestClient(t)
+	ntp, err := mockserver.NewSNTPServer(-1500 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewSNTPServer: %v", err)
+	}
+	defer ntp.Close()
+
+	sample, err := c.Scheduler.SyncSNTP(context.Background(), ntp.Addr())
+	if err != nil {
+		t.Fatalf("SyncSNTP: %v", err)
+	}
+	if sample.Source != "SNTP "+ntp.Addr() || sample.Low > -1500*time.Millisecond || sample.High < -1500*time.Millisecond {
+		t.Errorf("sample %+v does not bound the -1.5s skew", sample)
+	}
+	if got := c.Scheduler.Clock.Offset(); got < -1510*time.Millisecond || got > -1490*time.Millisecond {
+		t.Errorf("Offset = %v, want ≈ -1.5s", got)
+	}
+	if d := c.Scheduler.Now().Sub(time.Now()); d > -1400*time.Millisecond {
+		t.Errorf("Now is %v from the local clock, want ≈ -1.5s", d)
+	}
+}
+
+func TestDateSample(t *testing.T) {
+	sent := time.Date(2026, 2, 14, 1, 0, 0, 200e6, time.UTC)
+	s, err := client.DateSample("Date test", "Sat, 14 Feb 2026 01:00:05 GMT", sent, sent.Add(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("DateSample: %v", err)
+	}
+	// Server read 01:00:05.000-.999 while we were between .200 and .300
+	if s.Low != 4700*time.Millisecond || s.High != 5800*time.Millisecond || s.RTT != 100*time.Millisecond {
+		t.Errorf("sample = %+v", s)
+	}
+	if _, err := client.DateSample("Date test", "yesterday", sent, sent); err == nil {
+		t.Error("bad Date header accepted")
+	}
+}
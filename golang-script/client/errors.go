@@ -0,0 +1,210 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Booking flow errors, for callers that branch with errors.Is and errors.As.
+// The typed errors below match their sentinel with errors.Is; elsewhere the
+// sentinel is wrapped with the details ("%w: 2026-02-21 14:00"). The session
+// is covered by ErrSessionExpired (session_expiry.go).
+var (
+	// ErrSlotTaken: the slot can no longer be booked online (SelectedList or
+	// SelectedGirl answered false, or timeChangeProposal found it gone).
+	ErrSlotTaken = errors.New("slot no longer available")
+	// ErrPhoneOnly: the slot falls in hours the shop only books by phone (TEL).
+	ErrPhoneOnly = errors.New("slot bookable by phone only")
+	// ErrValidation is matched by *ValidationError.
+	ErrValidation = errors.New("validation failed")
+	// ErrCSRFMissing: a form that must carry a _csrf token has none.
+	ErrCSRFMissing = errors.New("csrf token not found")
+	// ErrServer is matched by *ServerError.
+	ErrServer = errors.New("server error")
+	// ErrDuplicateReservation is matched by *DuplicateReservationError.
+	ErrDuplicateReservation = errors.New("duplicate reservation")
+	// ErrRateLimited is matched by *RateLimitError.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrOutcomeUnknown is matched by *OutcomeUnknownError.
+	ErrOutcomeUnknown = errors.New("booking outcome unknown")
+)
+
+// ValidationError is returned when input_profile comes back with error
+// messages instead of moving on to confirm.
+type ValidationError struct {
+	Fields   []string // Form fields the messages refer to, where known
+	Messages []string
+}
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("%v: %s", ErrValidation, strings.Join(e.Messages, "; "))
+	if len(e.Fields) > 0 {
+		msg += fmt.Sprintf(" (fields: %s)", strings.Join(e.Fields, ", "))
+	}
+	return msg
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// validationFields maps the profile form's error messages, by the field
+// label they mention, to the fields SubmitProfile fills in.
+var validationFields = []struct{ keyword, field string }{
+	{"お名前", "customer_name"},
+	{"電話番号", "reservation_phone_number"},
+	{"メールアドレス", "mail_pc_sp"},
+}
+
+// parseValidationError collects the error messages of a form page, or
+// returns nil if it shows none.
+func parseValidationError(doc *goquery.Document) *ValidationError {
+	e := &ValidationError{}
+	doc.Find(".errorstyle, .error-message, .error-msg").Each(func(i int, s *goquery.Selection) {
+		msg := strings.TrimSpace(s.Text())
+		if msg == "" {
+			return
+		}
+		e.Messages = append(e.Messages, msg)
+		for _, f := range validationFields {
+			if strings.Contains(msg, f.keyword) {
+				e.Fields = append(e.Fields, f.field)
+				break
+			}
+		}
+	})
+	if len(e.Messages) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ServerError is an /error/ page (code EFRESV... or ER..., message from the
+// page) or a 5xx answer (Status).
+type ServerError struct {
+	Code    string
+	Message string
+	URL     string
+	Status  int   // HTTP status of a 5xx answer; 0 for an /error/ page
+	Err     error // The response status, or why the error page could not be read
+}
+
+func (e *ServerError) Error() string {
+	switch {
+	case e.Status != 0:
+		return fmt.Sprintf("%v: %d %s", ErrServer, e.Status, http.StatusText(e.Status))
+	case e.Message != "":
+		return fmt.Sprintf("%v %s: %s", ErrServer, e.Code, e.Message)
+	case e.Err != nil:
+		return fmt.Sprintf("%v (code: %s, URL: %s): %v", ErrServer, e.Code, e.URL, e.Err)
+	}
+	return fmt.Sprintf("%v (code: %s, URL: %s)", ErrServer, e.Code, e.URL)
+}
+
+func (e *ServerError) Is(target error) bool {
+	return target == ErrServer
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// errorPage reads the code and message of an /error/ page. readErr is the
+// error, if any, of reading body.
+func errorPage(page *url.URL, body []byte, readErr error) *ServerError {
+	e := &ServerError{Code: errorCodeFromPath(page.Path), URL: page.String(), Err: readErr}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		e.Err = errors.Join(e.Err, err)
+		return e
+	}
+	e.Message = strings.TrimSpace(doc.Find(".error-msg").Text())
+	return e
+}
+
+// RateLimitError is an HTTP 429 answer.
+type RateLimitError struct {
+	URL        string
+	RetryAfter time.Duration // From Retry-After; 0 if the server sent none
+	Err        error         // The response status, and why Retry-After could not be parsed
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v by %s (retry after %v)", ErrRateLimited, e.URL, e.RetryAfter)
+	}
+	return fmt.Sprintf("%v by %s", ErrRateLimited, e.URL)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// OutcomeUnknownError is returned by ConfirmReservation when ConfirmList
+// was sent but no answer came back (a timeout, a transport failure, a 5xx).
+// The booking may have been made, so the form must not be posted again; the
+// flow looks it up with CheckReservations instead.
+type OutcomeUnknownError struct {
+	URL     string
+	Receipt *BookingReceipt // What the confirm page showed
+	Err     error
+}
+
+func (e *OutcomeUnknownError) Error() string {
+	return fmt.Sprintf("%v after POST %s: %v", ErrOutcomeUnknown, e.URL, e.Err)
+}
+
+func (e *OutcomeUnknownError) Is(target error) bool {
+	return target == ErrOutcomeUnknown
+}
+
+func (e *OutcomeUnknownError) Unwrap() error {
+	return e.Err
+}
+
+// statusError is the error for a response with a 4xx or 5xx status: a
+// *RateLimitError for 429, a *ServerError for 5xx, each wrapped with what
+// failed.
+func statusError(what string, resp *http.Response) error {
+	status := fmt.Errorf("%s %s: %s", resp.Request.Method, resp.Request.URL, resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e := &RateLimitError{URL: resp.Request.URL.String(), Err: status}
+		wait, err := retryAfter(resp.Header.Get("Retry-After"))
+		if err != nil {
+			e.Err = errors.Join(status, err)
+		}
+		e.RetryAfter = wait
+		return fmt.Errorf("%s: %w", what, e)
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%s: %w", what, &ServerError{Status: resp.StatusCode, URL: resp.Request.URL.String(), Err: status})
+	}
+	return fmt.Errorf("%s: %s", what, resp.Status)
+}
+
+// retryAfter parses a Retry-After value, in seconds or an HTTP date. An
+// empty value is 0.
+func retryAfter(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		return time.Duration(sec) * time.Second, nil
+	}
+	at, err := http.ParseTime(v)
+	if err != nil {
+		return 0, fmt.Errorf("unparsable Retry-After %q: %w", v, err)
+	}
+	return max(time.Until(at), 0), nil
+}
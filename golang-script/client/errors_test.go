@@ -0,0 +1,227 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+// statusTransport answers requests whose path contains match with status
+// instead of passing them on.
+type statusTransport struct {
+	next   http.RoundTripper
+	match  string
+	status int
+	header http.Header
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.Contains(req.URL.Path, t.match) {
+		return t.next.RoundTrip(req)
+	}
+	header := t.header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: t.status,
+		Status:     http.StatusText(t.status),
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestSelectSlotTaken(t *testing.T) {
+	c, srv := newTestClient(t)
+	slot := newFlow(t, c, srv).Slot
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: slot.Date, Time: "1400", Mark: "×", Flg: "NG"})
+
+	err := c.SelectSlot(context.Background(), testAreaPath, testShopDir, testGirlID, slot.Date, slot.DayTime)
+	if !errors.Is(err, client.ErrSlotTaken) {
+		t.Fatalf("SelectSlot on a taken slot: err = %v, want ErrSlotTaken", err)
+	}
+
+	// The flow sees it at timeChangeProposal first
+	f := client.NewReservationFlow(c, testProfile, slot)
+	if err := f.Run(context.Background()); !errors.Is(err, client.ErrSlotTaken) {
+		t.Errorf("Run on a taken slot: err = %v, want ErrSlotTaken", err)
+	}
+}
+
+func TestReservationFlowPhoneOnly(t *testing.T) {
+	c, srv := newTestClient(t)
+	f := newFlow(t, c, srv)
+	f.Slot.Mark, f.Slot.Flag = "TEL", "TEL"
+	f.SkipTimeChange = true
+
+	if err := f.Run(context.Background()); !errors.Is(err, client.ErrPhoneOnly) {
+		t.Fatalf("Run on a phone-only slot: err = %v, want ErrPhoneOnly", err)
+	}
+	if n := countRequests(srv, "SelectedList"); n != 0 {
+		t.Errorf("sent %d SelectedList for a phone-only slot", n)
+	}
+}
+
+func TestConfirmReservationServerError(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.ConfirmErrorCode = "EFRESV030101"
+	loginAndSelect(t, c, srv)
+
+	body, confirmURL, err := c.SubmitProfile(context.Background(), profileInputURL, testProfile)
+	if err != nil {
+		t.Fatalf("SubmitProfile: %v", err)
+	}
+	_, err = c.ConfirmReservation(context.Background(), confirmURL, confirmURL, body, false)
+	var se *client.ServerError
+	if !errors.As(err, &se) || se.Code != "EFRESV030101" || !errors.Is(err, client.ErrServer) {
+		t.Fatalf("ConfirmReservation: err = %v, want server error EFRESV030101", err)
+	}
+}
+
+func TestSelectCourseErrorPage(t *testing.T) {
+	c, srv := newTestClient(t)
+	slot := newFlow(t, c, srv).Slot
+	// Slot locked but no girl selected: the course page bounces to /error/
+	if err := c.SelectSlot(context.Background(), testAreaPath, testShopDir, testGirlID, slot.Date, slot.DayTime); err != nil {
+		t.Fatalf("SelectSlot: %v", err)
+	}
+
+	err := c.SelectCourse(context.Background(), courseSelectURL, testProfile)
+	var se *client.ServerError
+	if !errors.As(err, &se) || se.Code != mockserver.ErrCodeFlow || !errors.Is(err, client.ErrServer) {
+		t.Fatalf("SelectCourse: err = %v, want server error %s", err, mockserver.ErrCodeFlow)
+	}
+}
+
+func TestSelectCourseCSRFMissing(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.OmitCourseCSRF = true
+	selectUpToCourse(t, c, srv)
+
+	if err := c.SelectCourse(context.Background(), courseSelectURL, testProfile); !errors.Is(err, client.ErrCSRFMissing) {
+		t.Fatalf("SelectCourse: err = %v, want ErrCSRFMissing", err)
+	}
+	if n := countRequests(srv, "POST yoyaku.cityheaven.net/select_course"); n != 0 {
+		t.Errorf("sent %d course POSTs without a token", n)
+	}
+}
+
+// errBodyCut is the read error of cutBody.
+type errBodyCut struct{}
+
+func (errBodyCut) Error() string { return "connection cut mid-body" }
+
+// cutBody fails after the first part of a page.
+type cutBody struct{ sent bool }
+
+func (b *cutBody) Read(p []byte) (int, error) {
+	if b.sent {
+		return 0, errBodyCut{}
+	}
+	b.sent = true
+	return copy(p, `<p class="error-msg">エラー`), nil
+}
+
+func (b *cutBody) Close() error { return nil }
+
+// cutErrorPageTransport answers requests whose path contains match with an
+// /error/ page that breaks off while being read.
+type cutErrorPageTransport struct {
+	next  http.RoundTripper
+	match string
+}
+
+func (t *cutErrorPageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.Contains(req.URL.Path, t.match) {
+		return t.next.RoundTrip(req)
+	}
+	errReq := req.Clone(req.Context())
+	errReq.URL.Path = "/error/" + testAreaPath + "/" + testShopDir + "/EFRESV000001/"
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{},
+		Body: &cutBody{}, Request: errReq}, nil
+}
+
+func TestTypedErrorsWrapCause(t *testing.T) {
+	t.Run("error page read error", func(t *testing.T) {
+		c, srv := newTestClient(t)
+		selectUpToCourse(t, c, srv)
+		c.SetTransport(&cutErrorPageTransport{next: srv.Transport(), match: "/select_course/"})
+
+		err := c.SelectCourse(context.Background(), courseSelectURL, testProfile)
+		var se *client.ServerError
+		if !errors.As(err, &se) || se.Code != "EFRESV000001" {
+			t.Fatalf("SelectCourse: err = %v, want server error EFRESV000001", err)
+		}
+		if !errors.As(err, new(errBodyCut)) {
+			t.Errorf("err = %v, the read error is not wrapped", err)
+		}
+	})
+
+	t.Run("5xx status", func(t *testing.T) {
+		c, srv := newTestClient(t)
+		f := newFlow(t, c, srv)
+		c.SetTransport(&statusTransport{next: srv.Transport(), match: "SelectedList", status: http.StatusBadGateway})
+
+		err := f.Step(context.Background())
+		var se *client.ServerError
+		if !errors.As(err, &se) || se.Unwrap() == nil || !strings.Contains(se.Unwrap().Error(), "POST") ||
+			!strings.Contains(se.Unwrap().Error(), http.StatusText(http.StatusBadGateway)) {
+			t.Fatalf("Step: err = %v, want a ServerError wrapping the POST's status", err)
+		}
+	})
+
+	t.Run("unparsable Retry-After", func(t *testing.T) {
+		c, srv := newTestClient(t)
+		f := newFlow(t, c, srv)
+		c.SetTransport(&statusTransport{next: srv.Transport(), match: "SelectedList", status: http.StatusTooManyRequests,
+			header: http.Header{"Retry-After": {"soon"}}})
+
+		err := f.Step(context.Background())
+		var rl *client.RateLimitError
+		var pe *time.ParseError
+		if !errors.As(err, &rl) || rl.RetryAfter != 0 || !errors.As(err, &pe) {
+			t.Fatalf("Step: err = %v, want a RateLimitError wrapping the Retry-After parse error", err)
+		}
+	})
+}
+
+func TestRateLimited(t *testing.T) {
+	c, srv := newTestClient(t)
+	f := newFlow(t, c, srv)
+	c.SetTransport(&statusTransport{next: srv.Transport(), match: "SelectedList", status: http.StatusTooManyRequests,
+		header: http.Header{"Retry-After": {"30"}}})
+
+	err := f.Run(context.Background())
+	var rl *client.RateLimitError
+	if !errors.As(err, &rl) || rl.RetryAfter != 30*time.Second || !errors.Is(err, client.ErrRateLimited) {
+		t.Fatalf("Run: err = %v, want RateLimitError with Retry-After 30s", err)
+	}
+	var te *client.TransitionError
+	if !errors.As(err, &te) || te.Transient {
+		t.Errorf("rate limiting reported as transient: %v", err)
+	}
+}
+
+func TestServerErrorTransient(t *testing.T) {
+	c, srv := newTestClient(t)
+	f := newFlow(t, c, srv)
+	c.SetTransport(&statusTransport{next: srv.Transport(), match: "SelectedList", status: http.StatusServiceUnavailable})
+
+	err := f.Step(context.Background())
+	var te *client.TransitionError
+	var se *client.ServerError
+	if !errors.As(err, &te) || !te.Transient || !errors.As(err, &se) || se.Status != http.StatusServiceUnavailable {
+		t.Fatalf("Step: err = %v, want a transient 503 ServerError", err)
+	}
+	if f.State() != client.StateStart {
+		t.Errorf("state %s after a 503, want Start", f.State())
+	}
+}
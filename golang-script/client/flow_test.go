@@ -0,0 +1,343 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+const (
+	testAreaPath = "niigata/A1501/A150101"
+	testShopDir  = "arabiannight"
+	testGirlID   = "52809022"
+	testCourseID = "253139"
+
+	s6URL           = "https://www.cityheaven.net/niigata/A1501/A150101/arabiannight/S6ShareToReservationLogin/?forward=F1&girl_id=52809022&pcmode=sp"
+	courseSelectURL = "https://yoyaku.cityheaven.net/select_course/niigata/A1501/A150101/arabiannight"
+	profileInputURL = "https://yoyaku.cityheaven.net/input_profile/niigata/A1501/A150101/arabiannight"
+)
+
+// newTestClient starts a mock site and returns a client routed to it.
+func newTestClient(t *testing.T) (*client.LowLatencyClient, *mockserver.Server) {
+	t.Helper()
+	srv := mockserver.New()
+	t.Cleanup(srv.Close)
+
+	_, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c := client.NewLowLatencyClient(cancel, 0, nil, nil, nil, true)
+	c.SetTransport(srv.Transport())
+	return c, srv
+}
+
+// loginAndSelect runs the flow up to and including SelectCourse.
+func loginAndSelect(t *testing.T, c *client.LowLatencyClient, srv *mockserver.Server) client.Slot {
+	t.Helper()
+	slot := selectUpToCourse(t, c, srv)
+	if err := c.SelectCourse(context.Background(), courseSelectURL, testProfile); err != nil {
+		t.Fatalf("SelectCourse: %v", err)
+	}
+	return slot
+}
+
+var testProfile = client.ReservationConfig{
+	ShopID:   "2310001233",
+	GirlID:   testGirlID,
+	CourseID: testCourseID,
+	AreaPath: testAreaPath,
+	ShopDir:  testShopDir,
+	Name:     "山田 太郎",
+	Phone:    "09012345678",
+	Email:    "test@example.com",
+}
+
+func TestBookingFlowEndToEnd(t *testing.T) {
+	c, srv := newTestClient(t)
+	slot := loginAndSelect(t, c, srv)
+
+	body, confirmURL, err := c.SubmitProfile(context.Background(), profileInputURL, testProfile)
+	if err != nil {
+		t.Fatalf("SubmitProfile: %v", err)
+	}
+	if !strings.Contains(confirmURL, "/confirm/") {
+		t.Fatalf("SubmitProfile landed on %s, want the confirm page", confirmURL)
+	}
+
+	receipt, err := c.ConfirmReservation(context.Background(), confirmURL, confirmURL, body, false)
+	if err != nil {
+		t.Fatalf("ConfirmReservation: %v", err)
+	}
+	want := client.BookingReceipt{
+		ShopName:      "湯房アラビアンナイト",
+		ShopPhone:     "025-241-1451",
+		GirlID:        testGirlID,
+		GirlName:      "じゅり",
+		Date:          slot.Date,
+		Time:          "14:00",
+		Course:        "通常コース80分 28,000円",
+		Price:         "28,000円",
+		DeliveryNgFlg: "0",
+	}
+	got := *receipt
+	got.CompleteURL, got.ConfirmedAt = "", time.Time{}
+	if got != want {
+		t.Errorf("receipt = %+v\nwant %+v", got, want)
+	}
+	if !strings.Contains(receipt.CompleteURL, "/complete/") || receipt.ConfirmedAt.IsZero() {
+		t.Errorf("receipt missing completion URL or time: %+v", receipt)
+	}
+
+	var order []string
+	for _, r := range srv.Requests() {
+		if strings.Contains(r, "/Confirm/") {
+			order = append(order, r[strings.LastIndex(r, "/Confirm/")+len("/Confirm/"):])
+		}
+	}
+	if got := strings.Join(order, " "); !strings.HasPrefix(got, "DupliConfirmCancellWait DupliConfirmReservationRequest ConfirmList/") {
+		t.Errorf("confirm requests = %s, want duplicate checks before ConfirmList", got)
+	}
+
+	bookings := srv.Bookings()
+	if len(bookings) != 1 {
+		t.Fatalf("got %d bookings, want 1", len(bookings))
+	}
+	b := bookings[0]
+	if b.GirlID != testGirlID || b.Date != slot.Date || b.Time != "1400" || b.CourseID != testCourseID || b.Phone != testProfile.Phone {
+		t.Errorf("unexpected booking %+v", b)
+	}
+
+	reservations, err := c.CheckReservations()
+	if err != nil {
+		t.Fatalf("CheckReservations: %v", err)
+	}
+	if len(reservations) != 1 || reservations[0].GirlName != "じゅり" {
+		t.Errorf("CheckReservations returned %+v", reservations)
+	}
+}
+
+func TestReservationMatches(t *testing.T) {
+	slot := client.Slot{Date: "2026-02-21", DayTime: "14:00"}
+	tests := []struct {
+		date, time string
+		want       bool
+	}{
+		{"2026-02-21", "14:00", true},
+		{"2026年2月21日（土）", "14:00〜", true},
+		{"02/21", "14:00", true},
+		{"2026-02-21", "15:00", false},
+		{"2026-02-22", "14:00", false},
+		{"14:00", "2026-02-21", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		r := client.Reservation{Date: tt.date, Time: tt.time}
+		if got := r.Matches(slot); got != tt.want {
+			t.Errorf("%q %q matches = %v, want %v", tt.date, tt.time, got, tt.want)
+		}
+	}
+}
+
+func TestDryRunDoesNotBook(t *testing.T) {
+	c, srv := newTestClient(t)
+	loginAndSelect(t, c, srv)
+
+	body, confirmURL, err := c.SubmitProfile(context.Background(), profileInputURL, testProfile)
+	if err != nil {
+		t.Fatalf("SubmitProfile: %v", err)
+	}
+	receipt, err := c.ConfirmReservation(context.Background(), confirmURL, confirmURL, body, true)
+	if err != nil {
+		t.Fatalf("ConfirmReservation: %v", err)
+	}
+	if !receipt.DryRun || receipt.Course == "" || receipt.CompleteURL != "" {
+		t.Errorf("dry-run receipt = %+v, want confirm page details only", receipt)
+	}
+	if n := len(srv.Bookings()); n != 0 {
+		t.Errorf("dry run created %d bookings", n)
+	}
+}
+
+func TestConfirmReservationDuplicate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		set  func(*mockserver.Server)
+		kind client.DuplicateKind
+	}{
+		{"cancel wait", func(s *mockserver.Server) { s.DuplicateCancelWait = true }, client.DuplicateCancelWait},
+		{"reservation request", func(s *mockserver.Server) { s.DuplicateReservationRequest = true }, client.DuplicateReservationRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, srv := newTestClient(t)
+			tc.set(srv)
+			loginAndSelect(t, c, srv)
+
+			body, confirmURL, err := c.SubmitProfile(context.Background(), profileInputURL, testProfile)
+			if err != nil {
+				t.Fatalf("SubmitProfile: %v", err)
+			}
+			_, err = c.ConfirmReservation(context.Background(), confirmURL, confirmURL, body, false)
+			var dup *client.DuplicateReservationError
+			if !errors.As(err, &dup) || dup.Kind != tc.kind || !errors.Is(err, client.ErrDuplicateReservation) {
+				t.Fatalf("ConfirmReservation: got %v, want duplicate %s", err, tc.kind)
+			}
+			if n := len(srv.Bookings()); n != 0 {
+				t.Errorf("duplicate was booked anyway (%d bookings)", n)
+			}
+		})
+	}
+}
+
+func TestLoginInvalidCredentials(t *testing.T) {
+	c, srv := newTestClient(t)
+	err := c.Login(srv.Username, "wrong")
+	if err == nil || !strings.Contains(err.Error(), "invalid credentials") {
+		t.Fatalf("Login with wrong password: got %v", err)
+	}
+}
+
+func TestSubmitProfileServerError(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.ProfileErrorCode = "EFRESV020801"
+	loginAndSelect(t, c, srv)
+
+	_, finalURL, err := c.SubmitProfile(context.Background(), profileInputURL, testProfile)
+	var se *client.ServerError
+	if !errors.As(err, &se) || se.Code != "EFRESV020801" || !strings.Contains(err.Error(), "EFRESV020801") {
+		t.Fatalf("SubmitProfile: got %v, want server error EFRESV020801", err)
+	}
+	if !strings.Contains(finalURL, "/error/") {
+		t.Errorf("final URL %s is not an error page", finalURL)
+	}
+}
+
+func TestSubmitProfileValidationError(t *testing.T) {
+	c, srv := newTestClient(t)
+	loginAndSelect(t, c, srv)
+
+	bad := testProfile
+	bad.Phone = "12-34"
+	_, _, err := c.SubmitProfile(context.Background(), profileInputURL, bad)
+	var verr *client.ValidationError
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "validation error") {
+		t.Fatalf("SubmitProfile with bad phone: got %v", err)
+	}
+	if len(verr.Fields) != 1 || verr.Fields[0] != "reservation_phone_number" {
+		t.Errorf("validation fields %v, want [reservation_phone_number]", verr.Fields)
+	}
+}
+
+// selectUpToCourse runs the flow up to SelectGirl for the open 14:00 slot.
+func selectUpToCourse(t *testing.T, c *client.LowLatencyClient, srv *mockserver.Server) client.Slot {
+	t.Helper()
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	slots, err := c.FetchCalendar(s6URL)
+	if err != nil {
+		t.Fatalf("FetchCalendar: %v", err)
+	}
+	if len(slots) != 1 || slots[0].DayTime != "14:00" {
+		t.Fatalf("FetchCalendar returned %+v, want the single 14:00 slot", slots)
+	}
+	slot := slots[0]
+
+	if err := c.SelectSlot(context.Background(), testAreaPath, testShopDir, testGirlID, slot.Date, slot.DayTime); err != nil {
+		t.Fatalf("SelectSlot: %v", err)
+	}
+	if err := c.SelectGirl(context.Background(), srv.ShopID, testGirlID, slot.Date, slot.DayTime); err != nil {
+		t.Fatalf("SelectGirl: %v", err)
+	}
+	return slot
+}
+
+func TestSelectCourseWithOptions(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.Options = []mockserver.Option{
+		{ID: "901", Name: "延長30分", Price: 10000},
+		{ID: "902", Name: "本指名料", Price: 2000},
+	}
+	selectUpToCourse(t, c, srv)
+
+	cfg := testProfile
+	cfg.OptionIDs = []string{"902"}
+	if err := c.SelectCourse(context.Background(), courseSelectURL, cfg); err != nil {
+		t.Fatalf("SelectCourse: %v", err)
+	}
+	body, confirmURL, err := c.SubmitProfile(context.Background(), profileInputURL, cfg)
+	if err != nil {
+		t.Fatalf("SubmitProfile: %v", err)
+	}
+	receipt, err := c.ConfirmReservation(context.Background(), confirmURL, confirmURL, body, false)
+	if err != nil {
+		t.Fatalf("ConfirmReservation: %v", err)
+	}
+	if receipt.Price != "30,000円" {
+		t.Errorf("receipt price = %q, want course + nomination fee", receipt.Price)
+	}
+	if b := srv.Bookings(); len(b) != 1 || strings.Join(b[0].OptionIDs, ",") != "902" {
+		t.Errorf("bookings = %+v, want option 902 only", b)
+	}
+}
+
+func TestSelectCourseUnknownOption(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.Options = []mockserver.Option{{ID: "901", Name: "延長30分", Price: 10000}}
+	selectUpToCourse(t, c, srv)
+
+	cfg := testProfile
+	cfg.OptionIDs = []string{"999"}
+	err := c.SelectCourse(context.Background(), courseSelectURL, cfg)
+	var unknown *client.UnknownOptionError
+	if !errors.As(err, &unknown) || unknown.Missing[0] != "999" || unknown.Available["901"] == "" {
+		t.Fatalf("SelectCourse: got %v, want UnknownOptionError listing 901", err)
+	}
+}
+
+func TestSelectCourseOptionsNotOffered(t *testing.T) {
+	c, srv := newTestClient(t)
+	selectUpToCourse(t, c, srv)
+
+	cfg := testProfile
+	cfg.OptionIDs = []string{"901"}
+	if err := c.SelectCourse(context.Background(), courseSelectURL, cfg); err == nil || !strings.Contains(err.Error(), "no select_option page") {
+		t.Fatalf("SelectCourse: got %v, want options-not-offered error", err)
+	}
+}
+
+func TestSelectCourseTerms(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.RequireTerms = true
+	selectUpToCourse(t, c, srv)
+
+	if err := c.SelectCourse(context.Background(), courseSelectURL, testProfile); !errors.Is(err, client.ErrTermsNotAccepted) {
+		t.Fatalf("SelectCourse without AcceptTerms: got %v, want ErrTermsNotAccepted", err)
+	}
+
+	cfg := testProfile
+	cfg.AcceptTerms = true
+	if err := c.SelectCourse(context.Background(), courseSelectURL, cfg); err != nil {
+		t.Fatalf("SelectCourse with AcceptTerms: %v", err)
+	}
+	if _, _, err := c.SubmitProfile(context.Background(), profileInputURL, cfg); err != nil {
+		t.Fatalf("SubmitProfile after terms: %v", err)
+	}
+}
+
+func TestSelectCourseWithoutSlot(t *testing.T) {
+	c, srv := newTestClient(t)
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := c.FetchCalendar(s6URL); err != nil {
+		t.Fatalf("FetchCalendar: %v", err)
+	}
+	if err := c.SelectCourse(context.Background(), courseSelectURL, testProfile); err == nil {
+		t.Fatal("SelectCourse succeeded without a selected slot")
+	}
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// yoyakuSessionCookie is the cookie yoyaku binds its reservation state to.
+const yoyakuSessionCookie = "SESSION"
+
+// ErrHandoff is matched (errors.Is) by the *HandoffError HandoffToYoyaku
+// returns.
+var ErrHandoff = errors.New("yoyaku handoff failed")
+
+// HandoffError says which hop of the www → yoyaku handoff failed:
+//   - "S6ShareToReservationLogin": www did not issue a temporary_key (not
+//     logged in on www, or the request failed);
+//   - "receive": yoyaku refused the temporary_key;
+//   - "session": receive answered but left no SESSION cookie.
+type HandoffError struct {
+	Stage string
+	URL   string // S6 URL the handoff started from
+	Err   error
+}
+
+func (e *HandoffError) Error() string {
+	return fmt.Sprintf("%v at %s (%s): %v", ErrHandoff, e.Stage, e.URL, e.Err)
+}
+
+func (e *HandoffError) Is(target error) bool {
+	return target == ErrHandoff
+}
+
+func (e *HandoffError) Unwrap() error {
+	return e.Err
+}
+
+// YoyakuSession is the state of the yoyaku session a handoff established,
+// taken from the receive URL www redirected to.
+type YoyakuSession struct {
+	EstablishedAt time.Time
+	S6URL         string   // S6ShareToReservationLogin URL the handoff started from
+	MemberID      string   // user_id passed to receive
+	GirlID        string   // girl_id passed to receive
+	UserKbn       string   // user_kbn ("FRN" for a member)
+	Landed        string   // Page receive redirected to (the girl's calendar)
+	Cookies       []string // Names of the cookies held for yoyaku afterwards
+}
+
+func (s *YoyakuSession) String() string {
+	return fmt.Sprintf("member %s, girl %s, %s at %s (cookies: %s)",
+		s.MemberID, s.GirlID, s.UserKbn, s.EstablishedAt.Format("15:04:05"), strings.Join(s.Cookies, ", "))
+}
+
+// isReceiveURL reports whether u is yoyaku's freservationresv/receive, the
+// hop that turns a temporary_key into a SESSION cookie.
+func isReceiveURL(u *url.URL) bool {
+	return strings.HasPrefix(u.Host, "yoyaku.") && u.Path == "/freservationresv/receive"
+}
+
+// redirectURLs is redirectChain with full URLs: every URL resp was
+// redirected through, oldest first, ending with the one it was served for.
+func redirectURLs(resp *http.Response) []*url.URL {
+	var chain []*url.URL
+	for req := resp.Request; req != nil; {
+		chain = append(chain, req.URL)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	slices.Reverse(chain)
+	return chain
+}
+
+// HandoffToYoyaku opens a yoyaku session the way the browser does: the S6
+// URL (see config.CalendarURL) makes www issue a one-time temporary_key and
+// redirect to freservationresv/receive, which sets the SESSION cookie and
+// forwards to the calendar. The session is verified and kept as
+// YoyakuSession. www must be logged in.
+func (c *LowLatencyClient) HandoffToYoyaku(s6URL string) (*YoyakuSession, error) {
+	req, err := http.NewRequest("GET", s6URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Referer", "https://www.cityheaven.net/")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
+
+	resp, err := c.DoSession(req)
+	if err != nil {
+		stage := "S6ShareToReservationLogin"
+		var se *SessionExpiredError
+		if errors.As(err, &se) && slices.ContainsFunc(se.Via, func(u string) bool {
+			parsed, _ := url.Parse(u)
+			return parsed != nil && isReceiveURL(parsed)
+		}) {
+			stage = "receive"
+		}
+		return nil, &HandoffError{Stage: stage, URL: s6URL, Err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HandoffError{Stage: "receive", URL: s6URL, Err: fmt.Errorf("landed on %s with status %s", resp.Request.URL, resp.Status)}
+	}
+
+	s, err := c.handoffResult(s6URL, resp)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Yoyaku session established: %s", s)
+	return s, nil
+}
+
+// handoffResult checks the redirect chain of an S6 request for the receive
+// hop and the SESSION cookie it should have left, and records the session.
+func (c *LowLatencyClient) handoffResult(s6URL string, resp *http.Response) (*YoyakuSession, error) {
+	var receive *url.URL
+	for _, u := range redirectURLs(resp) {
+		if isReceiveURL(u) {
+			receive = u
+		}
+	}
+	if receive == nil {
+		return nil, &HandoffError{Stage: "S6ShareToReservationLogin", URL: s6URL,
+			Err: fmt.Errorf("landed on %s without passing freservationresv/receive", resp.Request.URL)}
+	}
+	q := receive.Query()
+	if q.Get("temporary_key") == "" {
+		return nil, &HandoffError{Stage: "receive", URL: s6URL, Err: errors.New("no temporary_key in the receive URL")}
+	}
+
+	yoyaku := &url.URL{Scheme: "https", Host: receive.Host, Path: "/"}
+	var names []string
+	for _, ck := range c.jar.Cookies(yoyaku) {
+		names = append(names, ck.Name)
+	}
+	if !slices.Contains(names, yoyakuSessionCookie) {
+		return nil, &HandoffError{Stage: "session", URL: s6URL, Err: fmt.Errorf("no %s cookie for %s after receive", yoyakuSessionCookie, receive.Host)}
+	}
+
+	s := &YoyakuSession{
+		EstablishedAt: time.Now(),
+		S6URL:         s6URL,
+		MemberID:      q.Get("user_id"),
+		GirlID:        q.Get("girl_id"),
+		UserKbn:       q.Get("user_kbn"),
+		Landed:        resp.Request.URL.String(),
+		Cookies:       names,
+	}
+	c.mu.Lock()
+	c.yoyaku = s
+	c.mu.Unlock()
+	return s, nil
+}
+
+// YoyakuSession returns the session the last handoff established (by
+// HandoffToYoyaku or a calendar read through an S6 URL), or nil if there was
+// none since the cookies were last reset.
+func (c *LowLatencyClient) YoyakuSession() *YoyakuSession {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.yoyaku
+}
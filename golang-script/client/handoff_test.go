@@ -0,0 +1,51 @@
+package client_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"booker-bot/client"
+)
+
+func TestHandoffToYoyaku(t *testing.T) {
+	c, srv := newTestClient(t)
+
+	// Not logged in on www: S6 sends us to the login form
+	_, err := c.HandoffToYoyaku(s6URL)
+	var he *client.HandoffError
+	if !errors.As(err, &he) || he.Stage != "S6ShareToReservationLogin" || !errors.Is(err, client.ErrSessionExpired) {
+		t.Fatalf("before login: err = %v, want a HandoffError at S6ShareToReservationLogin", err)
+	}
+	if c.YoyakuSession() != nil {
+		t.Errorf("YoyakuSession = %v after a failed handoff", c.YoyakuSession())
+	}
+
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if got := cookieNames(c, "https://yoyaku.cityheaven.net/"); strings.Contains(got, "PHPSESSID") {
+		t.Errorf("www cookies copied to yoyaku: %s", got)
+	}
+	s, err := c.HandoffToYoyaku(s6URL)
+	if err != nil {
+		t.Fatalf("HandoffToYoyaku: %v", err)
+	}
+	if s.MemberID != srv.MemberID || s.GirlID != testGirlID || s.UserKbn != "FRN" || !slices.Contains(s.Cookies, "SESSION") {
+		t.Errorf("yoyaku session %+v", s)
+	}
+	if c.YoyakuSession() != s {
+		t.Errorf("YoyakuSession = %v, want %v", c.YoyakuSession(), s)
+	}
+
+	// The session reads the yoyaku calendar directly
+	if slots, err := c.FetchCalendar(s.Landed); err != nil || len(slots) == 0 {
+		t.Errorf("FetchCalendar(%s) = %v, %v", s.Landed, slots, err)
+	}
+
+	c.ResetCookies()
+	if c.YoyakuSession() != nil {
+		t.Error("YoyakuSession kept after ResetCookies")
+	}
+}
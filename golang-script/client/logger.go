@@ -29,6 +29,8 @@ type LogEntry struct {
 	TargetTime time.Time
 	ActualTime time.Time
 	// Drift is calculated from ActualTime - TargetTime
+	// Clock is the server clock estimate both times are corrected by
+	Clock ClockEstimate
 
 	// [2] Connection State (Metrics from the critical request)
 	DNSResolution    time.Duration
@@ -36,6 +38,10 @@ type LogEntry struct {
 	TLSHandshake     time.Duration
 	ConnectionReused bool
 	ProxyTunnel      string // e.g., "Established (HTTP CONNECT)"
+	// CriticalRequest is the request the fields above come from (see
+	// UseRequests); Requests are all requests of the flow, in order.
+	CriticalRequest *RequestResult  `json:",omitempty"`
+	Requests        []RequestResult `json:",omitempty"`
 
 	// [3] Monitoring & Detection
 	MonitoringMethod   string
@@ -44,12 +50,43 @@ type LogEntry struct {
 
 	// [4] Reservation Attempt Logic
 	Attempts []AttemptLog
+	// Relogins are the flows' re-logins after the site ended the session
+	Relogins []ReloginEvent `json:",omitempty"`
 
 	// [5] Result Summary
 	Result            string
 	EndToEndReadiness string
 	ObservedIssues    string
 	EngineerNote      string
+
+	// [6] Booking Receipt (nil if nothing was booked)
+	Receipt *BookingReceipt `json:",omitempty"`
+}
+
+// UseRequests fills the connection state from critical and keeps the
+// flow's requests for the report. critical may be nil when the flow failed
+// before sending it.
+func (e *LogEntry) UseRequests(critical *RequestResult, requests []RequestResult) {
+	e.Requests = requests
+	e.CriticalRequest = critical
+	if critical == nil {
+		e.ProxyTunnel = "N/A (no critical request sent)"
+		return
+	}
+	e.DNSResolution = critical.DNS()
+	e.TCPHandshake = critical.TCP()
+	e.TLSHandshake = critical.TLS()
+	e.ConnectionReused = critical.ConnectionReused
+	switch {
+	case critical.Proxy != "" && critical.ConnectionReused:
+		e.ProxyTunnel = "Reused (via " + critical.Proxy + ")"
+	case critical.Proxy != "":
+		e.ProxyTunnel = "Established (via " + critical.Proxy + ")"
+	case critical.ConnectionReused:
+		e.ProxyTunnel = "Reused connection"
+	default:
+		e.ProxyTunnel = "None (direct)"
+	}
 }
 
 // PrintExecutionLog outputs the formatted log exactly as requested
@@ -81,6 +118,12 @@ func PrintExecutionLog(e LogEntry) {
 		sign = "" // drift string includes -
 	}
 	fmt.Printf("%s               : %s\n", labelColor("Timing Drift"), driftColor("%s%d µs", sign, drift.Microseconds()))
+	fmt.Printf("%s        : %s\n", labelColor("Server Clock Offset"), valueColor(e.Clock.String()))
+	if e.Clock.Calibrated() {
+		fmt.Printf("%s         : %s\n", labelColor("Applied Correction"), valueColor(fmt.Sprintf("%+d ms", e.Clock.Correction().Milliseconds())))
+		fmt.Printf("%s           : %s\n", labelColor("Round Trip (RTT)"), valueColor(fmt.Sprintf("min %.1f ms / avg %.1f ms",
+			float64(e.Clock.MinRTT.Microseconds())/1000, float64(e.Clock.AvgRTT.Microseconds())/1000)))
+	}
 
 	fmt.Println("\nComment:")
 	fmt.Println("ミリ秒ではなく「マイクロ秒」単位で発火しており、")
@@ -94,6 +137,15 @@ func PrintExecutionLog(e LogEntry) {
 	fmt.Printf("%s       : %s\n", labelColor("TLS Handshake (uTLS)"), valueColor(fmt.Sprintf("%d ms", e.TLSHandshake.Milliseconds())))
 	fmt.Printf("%s          : %s\n", labelColor("Connection Reused"), valueColor(fmt.Sprintf("%v", e.ConnectionReused)))
 	fmt.Printf("%s               : %s\n", labelColor("Proxy Tunnel"), valueColor(e.ProxyTunnel))
+	if r := e.CriticalRequest; r != nil {
+		fmt.Printf("%s           : %s\n", labelColor("Critical Request"), valueColor(r.String()))
+	}
+	if len(e.Requests) > 0 {
+		fmt.Println("\nFlow Requests:")
+		for _, r := range e.Requests {
+			fmt.Printf("  %-16s %s\n", r.Step, r.String())
+		}
+	}
 
 	fmt.Println("\nComment:")
 	fmt.Println("本番ではこの接続を事前に確立（プリウォーム）するため、")
@@ -124,6 +176,12 @@ func PrintExecutionLog(e LogEntry) {
 		fmt.Printf("  Slot [%d] : %s\n", len(e.Attempts), last.Detail)
 		fmt.Printf("  Status   : %s\n", last.Status)
 	}
+	if len(e.Relogins) > 0 {
+		fmt.Println("\nSession Re-logins:")
+		for _, r := range e.Relogins {
+			fmt.Printf("  %s\n", r)
+		}
+	}
 
 	fmt.Println("\nComment:")
 	fmt.Println("第1希望が失敗した場合でも、")
@@ -153,6 +211,27 @@ func PrintExecutionLog(e LogEntry) {
 
 	}
 
+	if r := e.Receipt; r != nil {
+		fmt.Println("\n" + sectionColor("--------------------------------------------------"))
+		fmt.Println(sectionColor("[6] Booking Receipt"))
+		fmt.Println(sectionColor("--------------------------------------------------"))
+		number := r.ReservationNumber
+		if number == "" {
+			number = "(not shown by site)"
+		}
+		if r.DryRun {
+			number = "(dry run, not booked)"
+		}
+		fmt.Printf("%s         : %s\n", labelColor("Reservation No."), valueColor(number))
+		fmt.Printf("%s                : %s\n", labelColor("Shop"), valueColor(strings.TrimSpace(r.ShopName+" "+r.ShopPhone)))
+		fmt.Printf("%s                : %s\n", labelColor("Girl"), valueColor(fmt.Sprintf("%s (ID %s)", r.GirlName, r.GirlID)))
+		fmt.Printf("%s           : %s\n", labelColor("Date / Time"), valueColor(r.Slot()))
+		fmt.Printf("%s              : %s\n", labelColor("Course"), valueColor(r.Course))
+		fmt.Printf("%s               : %s\n", labelColor("Price"), valueColor(r.Price))
+		fmt.Printf("%s       : %s\n", labelColor("Delivery NG Flag"), valueColor(r.DeliveryNgFlg))
+		fmt.Printf("%s        : %s\n", labelColor("Completion Page"), valueColor(r.CompleteURL))
+	}
+
 	if strings.Contains(e.Result, "SUCCESS") {
 		fmt.Println("\n" + successColor("🎉🎉🎉 予約完了！ (RESERVATION COMPLETE) 🎉🎉🎉"))
 	} else {
@@ -182,3 +261,19 @@ func WriteStructuredLog(e LogEntry, filename string) error {
 	}
 	return nil
 }
+
+// PrintLatencySummary prints the per-step p50/p95 latencies of a run.
+func PrintLatencySummary(steps []StepLatency) {
+	if len(steps) == 0 {
+		return
+	}
+	sectionColor := color.New(color.FgHiYellow).SprintFunc()
+	fmt.Println("\n" + sectionColor("--------------------------------------------------"))
+	fmt.Println(sectionColor("[Latency by Step] p50/p95 in ms"))
+	fmt.Println(sectionColor("--------------------------------------------------"))
+	fmt.Printf("%-16s %5s %4s %4s  %-11s %-11s %-11s %-11s %-11s\n", "Step", "Reqs", "Err", "New", "DNS", "Connect", "TLS", "TTFB", "Total")
+	for _, s := range steps {
+		fmt.Printf("%-16s %5d %4d %4d  %-11s %-11s %-11s %-11s %-11s\n", s.Step, s.Requests, s.Errors, s.NewConns,
+			s.DNS, s.Connect, s.TLS, s.TTFB, s.Total)
+	}
+}
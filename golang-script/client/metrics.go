@@ -0,0 +1,364 @@
+package client
+
+import (
+	"context"
+	stdtls "crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRequestLog is how many RequestResults the client keeps.
+	maxRequestLog = 256
+	// maxStepSamples is how many requests per step the latency summary keeps.
+	maxStepSamples = 1024
+)
+
+// instrumentedTransport wraps the transports of both clients. Every round
+// trip (each redirect hop on its own) is traced, recorded with the flow step
+// in progress and its Date header fed to the server clock.
+type instrumentedTransport struct {
+	base   http.RoundTripper
+	client *LowLatencyClient
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, tracer := withTracer(req.Context())
+	req = req.WithContext(ctx)
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	t.client.observeClock(start, resp)
+	t.client.record(req.Context(), tracer.result(req, start, resp, err))
+	return resp, err
+}
+
+// instrument wraps rt unless it already is instrumented.
+func (c *LowLatencyClient) instrument(rt http.RoundTripper) http.RoundTripper {
+	if it, ok := rt.(*instrumentedTransport); ok && it.client == c {
+		return rt
+	}
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &instrumentedTransport{base: rt, client: c}
+}
+
+// DNS is the time spent resolving the host (zero on a reused connection).
+func (r *RequestResult) DNS() time.Duration {
+	return r.DNSDone - r.DNSStart
+}
+
+// TCP is the time spent on the TCP handshake (to the proxy when proxied).
+func (r *RequestResult) TCP() time.Duration {
+	return r.ConnectDone - r.ConnectStart
+}
+
+// TLS is the time spent on the TLS handshake, uTLS included.
+func (r *RequestResult) TLS() time.Duration {
+	return r.TLSHandshakeDone - r.TLSHandshakeStart
+}
+
+func (r *RequestResult) String() string {
+	conn := "new conn"
+	if r.ConnectionReused {
+		conn = "reused"
+	}
+	status := fmt.Sprint(r.StatusCode)
+	if r.Error != "" {
+		status = "ERROR"
+	}
+	return fmt.Sprintf("%s %s → %s in %d ms (TTFB %d ms, %s)", r.Method, r.URL, status,
+		r.TotalDuration.Milliseconds(), r.GotFirstResponseByte.Milliseconds(), conn)
+}
+
+// requestTracer collects the httptrace timings of one request. Callbacks
+// arrive from the transport's goroutines, hence the mutex.
+type requestTracer struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone   time.Time
+	connStart, connDone time.Time
+	tlsStart, tlsDone   time.Time
+	wroteReq, firstByte time.Time
+	reused              bool
+	remoteAddr          string
+	proxy               string
+}
+
+type tracerKey struct{}
+
+// withTracer returns ctx carrying a new tracer and its httptrace hooks.
+func withTracer(ctx context.Context) (context.Context, *requestTracer) {
+	t := &requestTracer{}
+	set := func(dst *time.Time) {
+		t.mu.Lock()
+		*dst = time.Now()
+		t.mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart:         func(_, _ string) { set(&t.connStart) },
+		ConnectDone:          func(_, _ string, _ error) { set(&t.connDone) },
+		TLSHandshakeStart:    func() { set(&t.tlsStart) },
+		TLSHandshakeDone:     func(stdtls.ConnectionState, error) { set(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&t.wroteReq) },
+		GotFirstResponseByte: func() { set(&t.firstByte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+			t.mu.Unlock()
+		},
+	}
+	ctx = context.WithValue(ctx, tracerKey{}, t)
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// setProxy notes the (masked) proxy a request is sent through. Called from
+// the transports' proxy and dial functions with the request's context.
+func setProxy(ctx context.Context, label string) {
+	if t, ok := ctx.Value(tracerKey{}).(*requestTracer); ok {
+		t.mu.Lock()
+		t.proxy = label
+		t.mu.Unlock()
+	}
+}
+
+// traceTLS runs a handshake the transport cannot see (uTLS is dialled inside
+// DialTLSContext) between the TLSHandshakeStart/Done hooks of ctx.
+func traceTLS(ctx context.Context, handshake func() error) error {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	err := handshake()
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(stdtls.ConnectionState{}, err)
+	}
+	return err
+}
+
+// result builds the RequestResult of req, started at start. Phases are
+// offsets from start; with redirects they are those of the last hop that
+// went through them.
+func (t *requestTracer) result(req *http.Request, start time.Time, resp *http.Response, err error) *RequestResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	since := func(at time.Time) time.Duration {
+		if at.IsZero() {
+			return 0
+		}
+		return at.Sub(start)
+	}
+	r := &RequestResult{
+		StartTime:            start,
+		Method:               req.Method,
+		URL:                  req.URL.Host + req.URL.Path,
+		DNSStart:             since(t.dnsStart),
+		DNSDone:              since(t.dnsDone),
+		ConnectStart:         since(t.connStart),
+		ConnectDone:          since(t.connDone),
+		TLSHandshakeStart:    since(t.tlsStart),
+		TLSHandshakeDone:     since(t.tlsDone),
+		WroteRequest:         since(t.wroteReq),
+		GotFirstResponseByte: since(t.firstByte),
+		TotalDuration:        time.Since(start),
+		ConnectionReused:     t.reused,
+		RemoteAddr:           t.remoteAddr,
+		Proxy:                t.proxy,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if resp != nil {
+		r.StatusCode = resp.StatusCode
+		r.Protocol = resp.Proto
+	}
+	return r
+}
+
+// stepRequests tags the requests sent with a context from withStep and
+// collects them for the flow step.
+type stepRequests struct {
+	name string
+
+	mu      sync.Mutex
+	results []RequestResult
+}
+
+type stepKey struct{}
+
+// withStep returns ctx tagging every request sent with it as step (see
+// ReservationFlow), and the list those requests are collected in.
+func withStep(ctx context.Context, step string) (context.Context, *stepRequests) {
+	s := &stepRequests{name: step}
+	return context.WithValue(ctx, stepKey{}, s), s
+}
+
+func (s *stepRequests) add(r RequestResult) {
+	s.mu.Lock()
+	s.results = append(s.results, r)
+	s.mu.Unlock()
+}
+
+// requests returns the requests collected so far.
+func (s *stepRequests) requests() []RequestResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.results)
+}
+
+// record keeps r in the client's request log, tagged with the flow step of
+// ctx (or the TagRequests label) and in the step's own list, then hands it
+// to OnRequest.
+func (c *LowLatencyClient) record(ctx context.Context, r *RequestResult) {
+	step, _ := ctx.Value(stepKey{}).(*stepRequests)
+	rec := c.store(step, r)
+	if step != nil {
+		step.add(rec)
+	}
+	if c.OnRequest != nil {
+		c.OnRequest(rec)
+	}
+}
+
+func (c *LowLatencyClient) store(step *stepRequests, r *RequestResult) RequestResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r.Step = c.stepName
+	if step != nil {
+		r.Step = step.name
+	}
+	rec := *r
+	rec.Body = nil
+
+	c.requestLog = append(c.requestLog, rec)
+	if len(c.requestLog) > maxRequestLog {
+		c.requestLog = c.requestLog[len(c.requestLog)-maxRequestLog:]
+	}
+
+	name := rec.Step
+	if name == "" {
+		name = "Other"
+	}
+	if c.stepSamples == nil {
+		c.stepSamples = map[string][]RequestResult{}
+	}
+	if _, ok := c.stepSamples[name]; !ok {
+		c.stepOrder = append(c.stepOrder, name)
+	}
+	samples := append(c.stepSamples[name], rec)
+	if len(samples) > maxStepSamples {
+		samples = samples[1:]
+	}
+	c.stepSamples[name] = samples
+	return rec
+}
+
+// TagRequests labels the requests sent until the returned function is called
+// with step (e.g. "Login", "Calendar") in the request log and the latency
+// summary. The label is client-wide; the reservation flow tags its own
+// requests with its states through their context instead, which wins.
+func (c *LowLatencyClient) TagRequests(step string) func() {
+	c.mu.Lock()
+	prev := c.stepName
+	c.stepName = step
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		c.stepName = prev
+		c.mu.Unlock()
+	}
+}
+
+// Percentiles are the median and 95th percentile of a set of durations.
+type Percentiles struct {
+	P50 time.Duration
+	P95 time.Duration
+}
+
+func (p Percentiles) String() string {
+	return fmt.Sprintf("%.1f/%.1f", float64(p.P50.Microseconds())/1000, float64(p.P95.Microseconds())/1000)
+}
+
+// percentiles uses the nearest-rank method; it returns zeros for no values.
+func percentiles(values []time.Duration) Percentiles {
+	if len(values) == 0 {
+		return Percentiles{}
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	rank := func(p int) time.Duration {
+		i := (p*len(sorted)+99)/100 - 1
+		return sorted[max(i, 0)]
+	}
+	return Percentiles{P50: rank(50), P95: rank(95)}
+}
+
+// StepLatency summarises the requests of one step. DNS, Connect and TLS only
+// cover the requests that went through that phase (NewConns of them for
+// Connect and TLS); TTFB and Total cover them all.
+type StepLatency struct {
+	Step     string
+	Requests int
+	Errors   int
+	NewConns int
+	DNS      Percentiles
+	Connect  Percentiles
+	TLS      Percentiles
+	TTFB     Percentiles
+	Total    Percentiles
+}
+
+// LatencySummary returns per-step latency percentiles over the requests
+// recorded so far (the latest 1024 per step), in order of first use.
+func (c *LowLatencyClient) LatencySummary() []StepLatency {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var out []StepLatency
+	for _, step := range c.stepOrder {
+		s := StepLatency{Step: step}
+		var dns, connect, tls, ttfb, total []time.Duration
+		for _, r := range c.stepSamples[step] {
+			s.Requests++
+			if r.Error != "" {
+				s.Errors++
+			}
+			if !r.ConnectionReused {
+				s.NewConns++
+			}
+			if r.DNSDone > 0 {
+				dns = append(dns, r.DNS())
+			}
+			if r.ConnectDone > 0 {
+				connect = append(connect, r.TCP())
+			}
+			if r.TLSHandshakeDone > 0 {
+				tls = append(tls, r.TLS())
+			}
+			if r.GotFirstResponseByte > 0 {
+				ttfb = append(ttfb, r.GotFirstResponseByte)
+			}
+			total = append(total, r.TotalDuration)
+		}
+		s.DNS, s.Connect, s.TLS = percentiles(dns), percentiles(connect), percentiles(tls)
+		s.TTFB, s.Total = percentiles(ttfb), percentiles(total)
+		out = append(out, s)
+	}
+	return out
+}
+
+// Requests returns the latest round trips of both clients (up to 256),
+// oldest first. Each redirect hop is a request of its own.
+func (c *LowLatencyClient) Requests() []RequestResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]RequestResult(nil), c.requestLog...)
+}
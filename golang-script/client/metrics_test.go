@@ -0,0 +1,165 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"booker-bot/client"
+)
+
+func TestFlowRecordsRequests(t *testing.T) {
+	c, srv := newTestClient(t)
+	flow := newFlow(t, c, srv)
+
+	// Login opened the connection: DNS is skipped (the mock dials directly)
+	// but the TCP and TLS handshakes are measured
+	first := c.Requests()[0]
+	if first.Step != "" || first.ConnectionReused || first.TLS() <= 0 || first.TCP() <= 0 {
+		t.Errorf("first request %+v, want a new connection with TCP and TLS timings", first)
+	}
+
+	if err := flow.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, r := range flow.Requests() {
+		if r.Step == "" || r.StatusCode == 0 || r.TotalDuration <= 0 || r.GotFirstResponseByte <= 0 {
+			t.Errorf("incomplete result %+v", r)
+		}
+		seen[r.Step] = true
+	}
+	for _, step := range []client.FlowState{client.StateSlotSelected, client.StateGirlSelected, client.StateCourseSelected,
+		client.StateProfileSubmitted, client.StateConfirmed} {
+		if !seen[step.String()] {
+			t.Errorf("no request recorded for %s", step)
+		}
+	}
+
+	critical := flow.CriticalRequest()
+	if critical == nil || critical.Method != "POST" || !strings.HasSuffix(critical.URL, "/calendar/SelectedList/") ||
+		critical.Step != "SlotSelected" || critical.StatusCode != 200 {
+		t.Fatalf("critical request = %+v", critical)
+	}
+
+	var e client.LogEntry
+	e.UseRequests(critical, flow.Requests())
+	if !e.ConnectionReused || e.TLSHandshake != 0 || e.ProxyTunnel != "Reused connection" {
+		t.Errorf("log entry: reused %v, TLS %v, tunnel %q", e.ConnectionReused, e.TLSHandshake, e.ProxyTunnel)
+	}
+	if all := c.Requests(); all[len(all)-1].URL != flow.Requests()[len(flow.Requests())-1].URL {
+		t.Errorf("client log does not end with the flow's last request")
+	}
+}
+
+// hookTransport calls hook before passing on the first request whose path
+// contains match.
+type hookTransport struct {
+	next  http.RoundTripper
+	match string
+	hook  func()
+	once  sync.Once
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.URL.Path, t.match) {
+		t.once.Do(t.hook)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// Requests sent on the same client while a flow step is in progress belong
+// to whoever sent them, not to the flow.
+func TestFlowRequestsStayWithTheFlow(t *testing.T) {
+	c, srv := newTestClient(t)
+	flow := newFlow(t, c, srv)
+	c.SetTransport(&hookTransport{next: srv.Transport(), match: "/SelectedList/", hook: func() {
+		done := make(chan error)
+		go func() {
+			defer c.TagRequests("Check")()
+			_, err := c.SessionValid()
+			done <- err
+		}()
+		if err := <-done; err != nil {
+			t.Errorf("SessionValid during SlotSelected: %v", err)
+		}
+	}})
+
+	if err := flow.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, r := range flow.Requests() {
+		if strings.Contains(r.URL, "SBMyReservation") {
+			t.Errorf("session check %s collected by the flow as %s", r.URL, r.Step)
+		}
+	}
+	if critical := flow.CriticalRequest(); critical == nil || critical.Step != "SlotSelected" {
+		t.Errorf("critical request = %+v, want SelectedList tagged SlotSelected", critical)
+	}
+	checks := 0
+	for _, r := range c.Requests() {
+		if strings.Contains(r.URL, "SBMyReservation") {
+			checks++
+			if r.Step != "Check" {
+				t.Errorf("session check tagged %q, want Check", r.Step)
+			}
+		}
+	}
+	if checks == 0 {
+		t.Error("the session check during the flow was not recorded")
+	}
+}
+
+func TestLatencySummary(t *testing.T) {
+	c, srv := newTestClient(t)
+	var observed atomic.Int32
+	c.OnRequest = func(client.RequestResult) { observed.Add(1) }
+	untag := c.TagRequests("Login")
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	untag()
+	slots, err := c.FetchCalendar(s6URL) // Untagged: "Other"
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("FetchCalendar: %v %v", slots, err)
+	}
+	flow := client.NewReservationFlow(c, testProfile, slots[0])
+	flow.CourseSelectURL = courseSelectURL
+	flow.ProfileInputURL = profileInputURL
+	if err := flow.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// Both clients are instrumented and every redirect hop counts
+	if got, want := len(c.Requests()), len(srv.Requests()); got != want {
+		t.Errorf("recorded %d round trips, server saw %d", got, want)
+	}
+	if got := int(observed.Load()); got != len(srv.Requests()) {
+		t.Errorf("OnRequest saw %d round trips, want %d", got, len(srv.Requests()))
+	}
+
+	summary := c.LatencySummary()
+	var steps []string
+	total := 0
+	for _, s := range summary {
+		steps = append(steps, s.Step)
+		total += s.Requests
+		if s.Total.P50 <= 0 || s.Total.P50 > s.Total.P95 || s.TTFB.P50 <= 0 || s.Errors != 0 {
+			t.Errorf("%s: %+v", s.Step, s)
+		}
+	}
+	want := "Login Other SlotSelected GirlSelected CourseSelected ProfileSubmitted Confirmed"
+	if got := strings.Join(steps, " "); got != want {
+		t.Errorf("steps = %s, want %s", got, want)
+	}
+	if total != len(srv.Requests()) {
+		t.Errorf("summary covers %d requests, want %d", total, len(srv.Requests()))
+	}
+	if login := summary[0]; login.NewConns == 0 || login.TLS.P50 <= 0 || login.Connect.P50 <= 0 {
+		t.Errorf("login opened no measured connection: %+v", login)
+	}
+}
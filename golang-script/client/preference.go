@@ -0,0 +1,237 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a range of start times within a day, inclusive, as "HH:MM".
+// Hours past 23 follow the site's late-night notation ("25:00" = 1am).
+type TimeWindow struct {
+	From string
+	To   string
+}
+
+var clockRe = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+
+// ParseTimeWindow parses "13:00-18:00".
+func ParseTimeWindow(s string) (TimeWindow, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	w := TimeWindow{From: strings.TrimSpace(from), To: strings.TrimSpace(to)}
+	if !ok {
+		return w, fmt.Errorf("time window %q must look like \"13:00-18:00\"", s)
+	}
+	fromMin, err1 := clockMinutes(w.From)
+	toMin, err2 := clockMinutes(w.To)
+	if err1 != nil || err2 != nil || toMin < fromMin {
+		return w, fmt.Errorf("time window %q must look like \"13:00-18:00\"", s)
+	}
+	return w, nil
+}
+
+// Contains reports whether the window includes the start time "HH:MM".
+func (w TimeWindow) Contains(dayTime string) bool {
+	m, err := clockMinutes(dayTime)
+	from, _ := clockMinutes(w.From)
+	to, _ := clockMinutes(w.To)
+	return err == nil && m >= from && m <= to
+}
+
+// clockMinutes turns "14:30" into minutes after midnight.
+func clockMinutes(s string) (int, error) {
+	m := clockRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	h, _ := strconv.Atoi(m[1])
+	mins, _ := strconv.Atoi(m[2])
+	if h > 29 || mins > 59 {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return h*60 + mins, nil
+}
+
+// SlotPreferences rank the available slots of a calendar. Girls, Days and
+// Windows are soft: slots matching them are tried first. Earliest and Latest
+// are hard bounds: a slot starting before Earliest, or whose course
+// (CourseMinutes) would run past Latest, is dropped.
+type SlotPreferences struct {
+	Girls         []string       // Girl IDs in priority order
+	Days          []time.Weekday // Preferred days of week
+	Windows       []TimeWindow   // Preferred start-time windows
+	Earliest      string         // e.g. "12:00" ("" = no bound)
+	Latest        string         // e.g. "23:00" ("" = no bound)
+	CourseMinutes int            // Length of the booked course, for the Latest check
+}
+
+// Rank returns the bookable slots in the order they should be tried. Among
+// otherwise equal slots the earlier start comes first.
+func (p SlotPreferences) Rank(slots []Slot) []Slot {
+	return p.rank(slots, func(s Slot) bool {
+		// Slots built by hand carry no mark and are taken as bookable
+		return s.Available() || s.Mark == ""
+	})
+}
+
+// RankWaitlist is Rank for the full (△) slots that take a cancellation
+// notification.
+func (p SlotPreferences) RankWaitlist(slots []Slot) []Slot {
+	return p.rank(slots, func(s Slot) bool { return s.Status() == SlotWaitlist })
+}
+
+func (p SlotPreferences) rank(slots []Slot, keep func(Slot) bool) []Slot {
+	earliest, errE := clockMinutes(p.Earliest)
+	latest, errL := clockMinutes(p.Latest)
+
+	type ranked struct {
+		slot Slot
+		key  [3]int
+	}
+	var candidates []ranked
+	for _, s := range slots {
+		if !keep(s) {
+			continue
+		}
+		start, err := clockMinutes(s.DayTime)
+		if err != nil {
+			continue
+		}
+		if errE == nil && start < earliest {
+			log.Printf("Preferences: skipping %s (before %s)", s.Key(), p.Earliest)
+			continue
+		}
+		if errL == nil && start+p.CourseMinutes > latest {
+			log.Printf("Preferences: skipping %s (%d min course ends after %s)", s.Key(), p.CourseMinutes, p.Latest)
+			continue
+		}
+		candidates = append(candidates, ranked{slot: s, key: p.score(s)})
+	}
+
+	slices.SortStableFunc(candidates, func(a, b ranked) int {
+		for i := range a.key {
+			if a.key[i] != b.key[i] {
+				return a.key[i] - b.key[i]
+			}
+		}
+		return slotStart(a.slot).Compare(slotStart(b.slot))
+	})
+
+	out := make([]Slot, len(candidates))
+	for i, c := range candidates {
+		out[i] = c.slot
+	}
+	return out
+}
+
+// score is compared field by field, lower first: girl priority, then
+// preferred day, then preferred window.
+func (p SlotPreferences) score(s Slot) [3]int {
+	var key [3]int
+	key[0] = len(p.Girls)
+	if i := slices.Index(p.Girls, s.GirlID); i >= 0 {
+		key[0] = i
+	}
+	if len(p.Days) > 0 && !slices.Contains(p.Days, slotStart(s).Weekday()) {
+		key[1] = 1
+	}
+	if len(p.Windows) > 0 && !slices.ContainsFunc(p.Windows, func(w TimeWindow) bool { return w.Contains(s.DayTime) }) {
+		key[2] = 1
+	}
+	return key
+}
+
+// OrderGirls puts the priority girls first (in priority order), followed by
+// the rest in their original order.
+func (p SlotPreferences) OrderGirls(girlIDs []string) []string {
+	out := make([]string, 0, len(girlIDs))
+	for _, id := range p.Girls {
+		if slices.Contains(girlIDs, id) {
+			out = append(out, id)
+		}
+	}
+	for _, id := range girlIDs {
+		if !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// slotStart returns Start, or parses Date/DayTime for slots built by hand.
+func slotStart(s Slot) time.Time {
+	if !s.Start.IsZero() {
+		return s.Start
+	}
+	return newSlot(s.Date, s.DayTime).Start
+}
+
+// TryCandidates runs a reservation flow for each candidate in turn, on the
+// same client and session, until one is Confirmed. newFlow builds the flow
+// for a candidate. Every try is recorded as an AttemptLog, failed or not.
+// Errors no other slot would avoid (an existing registration, terms,
+// options, MyHeaven auth, a session that re-login did not restore, a
+// rejected profile, rate limiting) stop the loop early. The last flow run is returned
+// along with its error.
+func TryCandidates(ctx context.Context, candidates []Slot, newFlow func(Slot) *ReservationFlow) (*ReservationFlow, []AttemptLog, error) {
+	var attempts []AttemptLog
+	var flow *ReservationFlow
+	var lastErr error
+	for i, slot := range candidates {
+		flow = newFlow(slot)
+		log.Printf("Candidate %d/%d: %s (girl %s)", i+1, len(candidates), slot.Key(), slot.GirlID)
+
+		err := flow.Run(ctx)
+		attempt := AttemptLog{Slot: slot.Key()}
+		if flow.Slot.Key() != slot.Key() {
+			attempt.Slot += " → " + flow.Slot.Key() // Accepted a timeChangeProposal
+		}
+		if err == nil {
+			r := flow.Receipt()
+			attempt.Result = "Attempted (Success)"
+			attempt.Detail = fmt.Sprintf("%s with %s, %s", r.Course, r.GirlName, r.Price)
+			attempt.Status = "Transaction Complete"
+			return flow, append(attempts, attempt), nil
+		}
+
+		attempt.Result = fmt.Sprintf("Failed in %s", flow.State())
+		var te *TransitionError
+		if errors.As(err, &te) {
+			attempt.Result = fmt.Sprintf("Failed at %s", te.To)
+		}
+		attempt.Detail = err.Error()
+		attempt.Status = "Next candidate"
+		lastErr = err
+		if !candidateRetryable(err) || ctx.Err() != nil {
+			attempt.Status = "Stopped"
+			return flow, append(attempts, attempt), err
+		}
+		if i == len(candidates)-1 {
+			attempt.Status = "No candidates left"
+		}
+		attempts = append(attempts, attempt)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no candidate slots to try")
+	}
+	return flow, attempts, lastErr
+}
+
+// candidateRetryable reports whether another slot might succeed after err.
+func candidateRetryable(err error) bool {
+	var opt *UnknownOptionError
+	switch {
+	case errors.Is(err, ErrDuplicateReservation), errors.As(err, &opt),
+		errors.Is(err, ErrTermsNotAccepted), errors.Is(err, ErrMyheavenAuthRequired),
+		errors.Is(err, ErrSessionExpired), errors.Is(err, ErrValidation),
+		errors.Is(err, ErrRateLimited), errors.Is(err, ErrOutcomeUnknown):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+func TestSlotPreferencesRank(t *testing.T) {
+	// 2026-02-21 is a Saturday
+	slots := []client.Slot{
+		{Date: "2026-02-20", DayTime: "19:00", GirlID: "1", Mark: "○"},
+		{Date: "2026-02-21", DayTime: "10:00", GirlID: "1", Mark: "○"},
+		{Date: "2026-02-21", DayTime: "15:00", GirlID: "1", Mark: "○"},
+		{Date: "2026-02-21", DayTime: "16:00", GirlID: "2", Mark: "○"},
+		{Date: "2026-02-21", DayTime: "17:00", GirlID: "1", Mark: "TEL"},
+		{Date: "2026-02-21", DayTime: "22:30", GirlID: "2", Mark: "○"},
+		{Date: "2026-02-22", DayTime: "14:00", GirlID: "1", Mark: "○"},
+	}
+	window, err := client.ParseTimeWindow("13:00-18:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		prefs client.SlotPreferences
+		want  string
+	}{
+		{
+			name:  "no preferences keeps bookable slots, earliest first",
+			prefs: client.SlotPreferences{},
+			want:  "2026-02-20 19:00, 2026-02-21 10:00, 2026-02-21 15:00, 2026-02-21 16:00, 2026-02-21 22:30, 2026-02-22 14:00",
+		},
+		{
+			name:  "girl priority first",
+			prefs: client.SlotPreferences{Girls: []string{"2"}},
+			want:  "2026-02-21 16:00, 2026-02-21 22:30, 2026-02-20 19:00, 2026-02-21 10:00, 2026-02-21 15:00, 2026-02-22 14:00",
+		},
+		{
+			name:  "weekend, then afternoon window",
+			prefs: client.SlotPreferences{Days: []time.Weekday{time.Saturday, time.Sunday}, Windows: []client.TimeWindow{window}},
+			want:  "2026-02-21 15:00, 2026-02-21 16:00, 2026-02-22 14:00, 2026-02-21 10:00, 2026-02-21 22:30, 2026-02-20 19:00",
+		},
+		{
+			name:  "earliest and latest with course length",
+			prefs: client.SlotPreferences{Earliest: "12:00", Latest: "23:00", CourseMinutes: 80},
+			want:  "2026-02-20 19:00, 2026-02-21 15:00, 2026-02-21 16:00, 2026-02-22 14:00",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := keys(tc.prefs.Rank(slots)); got != tc.want {
+				t.Errorf("Rank = %s\nwant   %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeWindowInvalid(t *testing.T) {
+	for _, s := range []string{"13:00", "18:00-13:00", "1pm-6pm"} {
+		if _, err := client.ParseTimeWindow(s); err == nil {
+			t.Errorf("ParseTimeWindow(%q): want error", s)
+		}
+	}
+}
+
+// candidateFlows returns a newFlow func for TryCandidates, as main.go builds it.
+func candidateFlows(c *client.LowLatencyClient) func(client.Slot) *client.ReservationFlow {
+	return func(s client.Slot) *client.ReservationFlow {
+		f := client.NewReservationFlow(c, testProfile, s)
+		f.CourseSelectURL = courseSelectURL
+		f.ProfileInputURL = profileInputURL
+		return f
+	}
+}
+
+func TestTryCandidatesFallsBack(t *testing.T) {
+	c, srv := newTestClient(t)
+	first := newFlow(t, c, srv).Slot
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: first.Date, Time: "1600", Mark: "○", Flg: "CAN"})
+	slots, err := c.FetchCalendar(s6URL)
+	if err != nil {
+		t.Fatalf("FetchCalendar: %v", err)
+	}
+	candidates := client.SlotPreferences{}.Rank(slots)
+	if got := keys(candidates); got != first.Date+" 14:00, "+first.Date+" 16:00" {
+		t.Fatalf("candidates = %s", got)
+	}
+
+	// 14:00 is taken before we get to it
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: first.Date, Time: "1400", Mark: "×", Flg: "NG"})
+
+	flow, attempts, err := client.TryCandidates(context.Background(), candidates, candidateFlows(c))
+	if err != nil {
+		t.Fatalf("TryCandidates: %v", err)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("attempts = %+v, want 2", attempts)
+	}
+	if a := attempts[0]; a.Slot != first.Date+" 14:00" || a.Result != "Failed at SlotSelected" || a.Status != "Next candidate" {
+		t.Errorf("first attempt = %+v", a)
+	}
+	if a := attempts[1]; a.Slot != first.Date+" 16:00" || a.Result != "Attempted (Success)" {
+		t.Errorf("second attempt = %+v", a)
+	}
+	if r := flow.Receipt(); r == nil || r.Time != "16:00" {
+		t.Errorf("receipt = %+v", r)
+	}
+	if n := countRequests(srv, "/login/loginAuth/"); n != 1 {
+		t.Errorf("logged in %d times, want 1 (candidates should share the session)", n)
+	}
+	if b := srv.Bookings(); len(b) != 1 || b[0].Time != "1600" {
+		t.Errorf("bookings = %+v", b)
+	}
+}
+
+func TestTryCandidatesStopsOnDuplicate(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.DuplicateReservationRequest = true
+	first := newFlow(t, c, srv).Slot
+	second := client.Slot{Date: first.Date, DayTime: "16:00"}
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: first.Date, Time: "1600", Mark: "○", Flg: "CAN"})
+
+	_, attempts, err := client.TryCandidates(context.Background(), []client.Slot{first, second}, candidateFlows(c))
+	var dup *client.DuplicateReservationError
+	if !errors.As(err, &dup) {
+		t.Fatalf("TryCandidates: got %v, want DuplicateReservationError", err)
+	}
+	if len(attempts) != 1 || attempts[0].Status != "Stopped" || !strings.Contains(attempts[0].Detail, "reservation request") {
+		t.Errorf("attempts = %+v, want one stopped attempt", attempts)
+	}
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// BookingReceipt is the proof of a booking, assembled from the confirm page
+// (date/time, course, price) and the completion page (shop, girl, delivery
+// flag). The live completion URL is /complete/<area>/<dir>/<girl_id>?deliveryNgFlg=0,
+// so ReservationNumber is only set when the page itself shows one.
+type BookingReceipt struct {
+	ReservationNumber string    `json:"reservation_number,omitempty"`
+	CompleteURL       string    `json:"complete_url,omitempty"`
+	ShopName          string    `json:"shop_name"`
+	ShopPhone         string    `json:"shop_phone,omitempty"`
+	GirlID            string    `json:"girl_id"`
+	GirlName          string    `json:"girl_name"`
+	Date              string    `json:"date"` // e.g. "2026-02-21"
+	Time              string    `json:"time"` // e.g. "14:00"
+	Course            string    `json:"course"`
+	Price             string    `json:"price,omitempty"` // As shown, e.g. "28,000円"
+	DeliveryNgFlg     string    `json:"delivery_ng_flg,omitempty"`
+	Waitlist          bool      `json:"waitlist,omitempty"` // A cancellation notification, not a booking
+	DryRun            bool      `json:"dry_run"`
+	ConfirmedAt       time.Time `json:"confirmed_at"`
+}
+
+// Slot returns the booked date and time as shown in AttemptLog rows.
+func (r *BookingReceipt) Slot() string {
+	return strings.TrimSpace(r.Date + " " + r.Time)
+}
+
+// confirmDateTime matches the confirm page's 日時 cell, e.g. "2026/02/21（土）14:00〜".
+var confirmDateTime = regexp.MustCompile(`(\d{4})/(\d{2})/(\d{2})\D*?(\d{1,2}:\d{2})`)
+
+// profileGirlID matches the girl ID in the completion page's profile link.
+var profileGirlID = regexp.MustCompile(`girlid-(\d+)`)
+
+// parseConfirmDetails fills the receipt from the "ご予約内容" list on the confirm page.
+func parseConfirmDetails(doc *goquery.Document, r *BookingReceipt) {
+	doc.Find("dl").Each(func(i int, dl *goquery.Selection) {
+		value := strings.TrimSpace(dl.Find("dd").First().Text())
+		switch strings.TrimSpace(dl.Find("dt").First().Text()) {
+		case "日時":
+			if m := confirmDateTime.FindStringSubmatch(value); m != nil {
+				r.Date = m[1] + "-" + m[2] + "-" + m[3]
+				r.Time = m[4]
+			}
+		case "女の子":
+			r.GirlName = value
+		case "コース":
+			r.Course = strings.Join(strings.Fields(value), " ")
+		case "合計":
+			r.Price = value
+		}
+	})
+}
+
+// parseCompletePage fills the receipt from the completion page and its URL.
+func parseCompletePage(doc *goquery.Document, pageURL string, r *BookingReceipt) {
+	r.CompleteURL = pageURL
+	if u, err := url.Parse(pageURL); err == nil {
+		r.DeliveryNgFlg = u.Query().Get("deliveryNgFlg")
+		if parts := strings.Split(strings.Trim(u.Path, "/"), "/"); len(parts) > 0 && r.GirlID == "" {
+			r.GirlID = parts[len(parts)-1]
+		}
+	}
+
+	if name := strings.TrimSpace(doc.Find("#shopLink").Text()); name != "" {
+		r.ShopName = name
+	}
+	if href := doc.Find("#profileLink").AttrOr("href", ""); href != "" {
+		if m := profileGirlID.FindStringSubmatch(href); m != nil {
+			r.GirlID = m[1]
+		}
+	}
+	if r.GirlName == "" {
+		// "ももか（22歳）" → "ももか"
+		name := strings.TrimSpace(doc.Find(".radius-box strong").First().Text())
+		r.GirlName = strings.TrimSpace(strings.SplitN(name, "（", 2)[0])
+	}
+
+	doc.Find("dl").Each(func(i int, dl *goquery.Selection) {
+		value := strings.TrimSpace(dl.Find("dd").First().Text())
+		switch strings.TrimSpace(dl.Find("dt").First().Text()) {
+		case "電話番号":
+			r.ShopPhone = value
+		case "予約番号":
+			r.ReservationNumber = value
+		}
+	})
+}
+
+// AppendReceipt writes the receipt as a JSON line to the specified file.
+// The file holds customer-facing booking data, so it is created 0600.
+func AppendReceipt(r *BookingReceipt, filename string) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
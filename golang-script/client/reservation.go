@@ -1,8 +1,10 @@
 package client
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,6 +33,9 @@ type ReservationConfig struct {
 	Email      string
 	BirthYear  string
 	BirthMonth string
+	// Pages between select_course and input_profile (see SelectCourse)
+	OptionIDs   []string // Options to tick on select_option, if the shop shows it
+	AcceptTerms bool     // Agree to the shop's terms page, if it requires it
 }
 
 // Reservation represents an existing booking found in My Page
@@ -41,10 +47,46 @@ type Reservation struct {
 	Status   string
 }
 
+// figures matches the numbers of a My Page date or time, whatever the layout
+// ("2026-02-21", "2026年2月21日（土）", "14:00").
+var figures = regexp.MustCompile(`\d+`)
+
+func parseFigures(s string) []int {
+	var out []int
+	for _, f := range figures.FindAllString(s, -1) {
+		n, _ := strconv.Atoi(f)
+		out = append(out, n)
+	}
+	return out
+}
+
+// Matches reports whether the entry is for the slot's day and start time.
+func (r Reservation) Matches(s Slot) bool {
+	got, want := parseFigures(r.Date+" "+r.Time), parseFigures(s.Date+" "+s.DayTime)
+	if len(want) != 5 { // Year, month, day, hour, minute
+		return false
+	}
+	day, clock := -1, -1
+	for i := 0; i+1 < len(got); i++ {
+		switch {
+		case day < 0 && got[i] == want[1] && got[i+1] == want[2]:
+			day = i
+			i++
+		case day >= 0 && got[i] == want[3] && got[i+1] == want[4]:
+			clock = i
+		}
+	}
+	return clock > day && day >= 0
+}
+
 // Slot represents a time slot from the JSON or HTML
 type Slot struct {
-	DayTime string // e.g. "14:00"
-	Date    string // e.g. "2026-02-15"
+	DayTime string    // e.g. "14:00"
+	Date    string    // e.g. "2026-02-15"
+	Start   time.Time // Date and DayTime in JST
+	GirlID  string    // girl_id of the calendar entry ("" if not given)
+	Mark    string    // acp_status_mark as shown: "○", "△", "TEL", "×"
+	Flag    string    // acp_status_flg, e.g. "CAN" (JSON calendar only)
 }
 
 // JSON Response for availability (inferred structure)
@@ -96,6 +138,7 @@ func (c *LowLatencyClient) ListGirls(shopURL string) ([]string, error) {
 // HandleAgeVerification bypasses the age gate using the standard TLS session client.
 // Must bypass on BOTH www.cityheaven.net AND yoyaku.cityheaven.net since Go's
 // cookie jar respects domain scoping and won't send www cookies to yoyaku.
+// The yoyaku login itself comes from the S6 handoff (see HandoffToYoyaku).
 func (c *LowLatencyClient) HandleAgeVerification() error {
 	// Bypass age gate on main domain
 	bypassURLs := []string{
@@ -122,15 +165,6 @@ func (c *LowLatencyClient) HandleAgeVerification() error {
 		log.Printf("Age bypass sent to %s (status: %s)", bypassURL, resp.Status)
 	}
 
-	// Copy cookies from www to yoyaku subdomain in case server uses strict domain
-	wwwURL, _ := url.Parse("https://www.cityheaven.net")
-	yoyakuURL, _ := url.Parse("https://yoyaku.cityheaven.net")
-	wwwCookies := c.client.Jar.Cookies(wwwURL)
-	if len(wwwCookies) > 0 {
-		c.client.Jar.SetCookies(yoyakuURL, wwwCookies)
-		log.Printf("Copied %d cookies from www to yoyaku subdomain", len(wwwCookies))
-	}
-
 	// Log cookies for both domains
 	for _, domain := range []string{"https://www.cityheaven.net", "https://yoyaku.cityheaven.net"} {
 		u, _ := url.Parse(domain)
@@ -274,8 +308,24 @@ func (c *LowLatencyClient) Login(username, password string) error {
 }
 
 // FetchCalendar polls the calendar for availability
-// Updated to parse JSON from page
+// Updated to parse JSON from page, falling back to the table.cth grid.
+// Returns ErrCalendarLayout if neither can be read.
 func (c *LowLatencyClient) FetchCalendar(urlStr string) ([]Slot, error) {
+	cal, err := c.FetchCalendarGrid(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	return cal.Available(), nil
+}
+
+// calendarGirlPath matches the calendar page the S6 URL redirects to,
+// /calendar/<area>/<dir>/<week>/<girl_id>.
+var calendarGirlPath = regexp.MustCompile(`^/calendar/.+/\d+/(\d+)/?$`)
+
+// FetchCalendarGrid fetches the calendar and returns every cell, including
+// phone-only, waitlist and fully booked ones. Slots the page does not tag
+// with a girl get the girl ID from the final URL.
+func (c *LowLatencyClient) FetchCalendarGrid(urlStr string) (*Calendar, error) {
 	log.Printf("Fetching calendar from: %s", urlStr)
 
 	req, err := http.NewRequest("GET", urlStr, nil)
@@ -294,107 +344,32 @@ func (c *LowLatencyClient) FetchCalendar(urlStr string) ([]Slot, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("calendar fetch returned status: %d", resp.StatusCode)
+		return nil, statusError("calendar fetch failed", resp)
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
-	htmlContent := string(bodyBytes)
-
-	// Regex to extract the JSON variable
-	// var get_result = '{...}';
-	re := regexp.MustCompile(`var get_result = '(\{.*?\})';`)
-	match := re.FindStringSubmatch(htmlContent)
-
-	if len(match) < 2 {
-		// Log warning but check for fallback HTML table method (Wait, we removed it)
-		// Or maybe the page structure is different.
-		// Check for goquery table as fallback?
-		// Actually, if S6 URL redirects to something without JSON, we might want to fail fast or try table.
-		// Let's rely on JSON for now as it's the requested fix.
-		log.Println("Warning: Could not find 'get_result' JSON in page. The URL might be wrong or layout changed.")
-
-		// Fallback: Try GoQuery table parsing (Original Logic) just in case
-		// This handles the case where JSON is missing but table exists
-		doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
-		if err == nil {
-			// Quick check if table exists
-			if doc.Find("table.cth").Length() > 0 {
-				log.Println("Attempting HTML Table Fallback...")
-				// ... (We skip full fallback implementation to keep code clean unless necessary)
-			}
-		}
-		return nil, nil
-	}
-
-	jsonStr := match[1]
-
-	// Data structures for JSON
-	type SlotRaw struct {
-		Date          string      `json:"date"`
-		Time          string      `json:"time"` // "1000"
-		GirlID        interface{} `json:"girl_id"`
-		AcpStatusMark string      `json:"acp_status_mark"`
-		AcpStatusFlg  string      `json:"acp_status_flg"`
-	}
-
-	type CalendarData struct {
-		CommuAcpStatus []map[string][]SlotRaw `json:"commu_acp_status"`
+	cal, err := ParseCalendarGrid(bodyBytes)
+	if err != nil {
+		return nil, err
 	}
-
-	// Debug: Check shop_id
-	var debugMap map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &debugMap); err == nil {
-		if val, ok := debugMap["shop_id"]; ok {
-			log.Printf("Found shop_id in JSON: %v", val)
-		} else {
-			log.Println("shop_id NOT FOUND in JSON root")
+	// An S6 URL hands the session over to yoyaku on the way (see handoff.go)
+	if strings.Contains(urlStr, "S6ShareToReservationLogin") {
+		if _, err := c.handoffResult(urlStr, resp); err != nil {
+			log.Printf("Warning: %v", err)
 		}
 	}
-
-	var data CalendarData
-	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
-		log.Printf("Error parsing calendar JSON: %v", err)
-		return nil, nil
-	}
-
-	var availableSlots []Slot
-
-	// Iterate through the array of daily objects
-	for _, dayMap := range data.CommuAcpStatus {
-		for _, slots := range dayMap {
-			for _, s := range slots {
-				// Format time "1000" -> "10:00"
-				timeFormatted := s.Time
-				if len(s.Time) == 4 {
-					timeFormatted = fmt.Sprintf("%s:%s", s.Time[:2], s.Time[2:])
-				}
-
-				statusLog := "Full/UA"
-				isAvailable := false
-
-				// Check availability
-				if s.AcpStatusMark == "○" || s.AcpStatusFlg == "CAN" {
-					statusLog = "AVAILABLE"
-					isAvailable = true
-				}
-
-				// VERBOSE LOGGING per user request
-				log.Printf("    Checking [%s %s] -> %s", s.Date, timeFormatted, statusLog)
-
-				if isAvailable {
-					availableSlots = append(availableSlots, Slot{
-						DayTime: timeFormatted,
-						Date:    s.Date,
-					})
-				}
+	if m := calendarGirlPath.FindStringSubmatch(resp.Request.URL.Path); m != nil {
+		girlID := m[1]
+		for i := range cal.Slots {
+			if cal.Slots[i].GirlID == "" {
+				cal.Slots[i].GirlID = girlID
 			}
 		}
 	}
-
-	return availableSlots, nil
+	return cal, nil
 }
 
 // ExtractCSRFToken parses HTML to find <input type="hidden" name="_csrf" value="...">
@@ -404,7 +379,7 @@ func ExtractCSRFToken(htmlBody string) (string, error) {
 	if len(matches) > 1 {
 		return matches[1], nil
 	}
-	return "", fmt.Errorf("csrf token not found")
+	return "", ErrCSRFMissing
 }
 
 // dayOfWeekJP returns the Japanese day-of-week suffix for a given date string (YYYY-MM-DD).
@@ -428,7 +403,36 @@ func dayOfWeekJP(dateStr string) string {
 //   - girlID:   the girl ID (or "0" for free reservation)
 //   - day:      date in YYYY-MM-DD format (e.g. "2026-02-16")
 //   - dayTime:  time in HH:MM format (e.g. "10:00")
-func (c *LowLatencyClient) SelectSlot(areaPath, shopDir, girlID, day, dayTime string) error {
+func (c *LowLatencyClient) SelectSlot(ctx context.Context, areaPath, shopDir, girlID, day, dayTime string) error {
+	ok, err := c.selectSlot(ctx, areaPath, shopDir, girlID, day, dayTime, false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: SelectedList refused %s %s", ErrSlotTaken, day, dayTime)
+	}
+	return nil
+}
+
+// SelectWaitlistSlot is SelectSlot for a full (△) slot with
+// waitlist_notification=1: the rest of the flow then registers a
+// cancellation notification (キャンセル待ち通知) instead of a booking.
+// The browser only sends this from the calendar's waitlist dialog, which was
+// not captured; the field name and "true"/"false" reply are those of the
+// captured SelectedList request.
+func (c *LowLatencyClient) SelectWaitlistSlot(ctx context.Context, areaPath, shopDir, girlID, day, dayTime string) error {
+	ok, err := c.selectSlot(ctx, areaPath, shopDir, girlID, day, dayTime, true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s %s", ErrWaitlistRejected, day, dayTime)
+	}
+	return nil
+}
+
+// selectSlot posts SelectedList and reports whether the server answered "true".
+func (c *LowLatencyClient) selectSlot(ctx context.Context, areaPath, shopDir, girlID, day, dayTime string, waitlist bool) (bool, error) {
 	endpoint := "https://yoyaku.cityheaven.net/calendar/SelectedList/"
 
 	// Build "day" parameter with Japanese day-of-week suffix: "2026-02-16(月)"
@@ -439,10 +443,13 @@ func (c *LowLatencyClient) SelectSlot(areaPath, shopDir, girlID, day, dayTime st
 	data.Set("day", dayWithDOW)
 	data.Set("day_time", dayTime)
 	data.Set("waitlist_notification", "0")
+	if waitlist {
+		data.Set("waitlist_notification", "1")
+	}
 
-	req, err := http.NewRequest("POST", endpoint, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(data.Encode()))
 	if err != nil {
-		return err
+		return false, err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
@@ -451,7 +458,7 @@ func (c *LowLatencyClient) SelectSlot(areaPath, shopDir, girlID, day, dayTime st
 
 	resp, err := c.DoSession(req)
 	if err != nil {
-		return fmt.Errorf("SelectSlot POST failed: %w", err)
+		return false, fmt.Errorf("SelectSlot POST failed: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -459,10 +466,10 @@ func (c *LowLatencyClient) SelectSlot(areaPath, shopDir, girlID, day, dayTime st
 	log.Printf("SelectSlot Response (status %s): %s", resp.Status, string(bodyBytes))
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("failed to select slot: %s", resp.Status)
+		return false, statusError("failed to select slot", resp)
 	}
 
-	return nil
+	return strings.TrimSpace(string(bodyBytes)) == "true", nil
 }
 
 // SelectGirl posts JSON to /Selectvacancygirl/SelectedGirl to confirm
@@ -476,7 +483,7 @@ func (c *LowLatencyClient) SelectSlot(areaPath, shopDir, girlID, day, dayTime st
 //   - girlID:  the girl ID (or "0" for free reservation)
 //   - day:     date in YYYY-MM-DD format (same as passed to SelectSlot)
 //   - dayTime: time in HH:MM format (same as passed to SelectSlot)
-func (c *LowLatencyClient) SelectGirl(shopID, girlID, day, dayTime string) error {
+func (c *LowLatencyClient) SelectGirl(ctx context.Context, shopID, girlID, day, dayTime string) error {
 	endpoint := "https://yoyaku.cityheaven.net/Selectvacancygirl/SelectedGirl"
 
 	payload := map[string]string{
@@ -487,7 +494,7 @@ func (c *LowLatencyClient) SelectGirl(shopID, girlID, day, dayTime string) error
 	}
 	jsonBytes, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", endpoint, strings.NewReader(string(jsonBytes)))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(string(jsonBytes)))
 	if err != nil {
 		return err
 	}
@@ -506,16 +513,23 @@ func (c *LowLatencyClient) SelectGirl(shopID, girlID, day, dayTime string) error
 	log.Printf("SelectGirl Response (status %s): %s", resp.Status, string(bodyBytes))
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("failed to select girl: %s", resp.Status)
+		return statusError("failed to select girl", resp)
+	}
+	if strings.TrimSpace(string(bodyBytes)) == "false" {
+		return fmt.Errorf("%w: SelectedGirl refused %s %s", ErrSlotTaken, day, dayTime)
 	}
-
 	return nil
 }
 
-// SelectCourse submits the course selection
-func (c *LowLatencyClient) SelectCourse(urlStr, courseID string) error {
+// SelectCourse submits the course selection, then walks the pages the site
+// shows before input_profile (select_option, myhevenAuthc, terms) using
+// config.OptionIDs and config.AcceptTerms. It returns once input_profile is
+// reached.
+func (c *LowLatencyClient) SelectCourse(ctx context.Context, urlStr string, config ReservationConfig) error {
+	courseID := config.CourseID
+
 	// 1. GET request to fetch CSRF token and form fields from the page
-	reqGet, _ := http.NewRequest("GET", urlStr, nil)
+	reqGet, _ := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	reqGet.Header.Set("Referer", "https://www.cityheaven.net/niigata/")
 	respGet, err := c.DoSession(reqGet)
 	if err != nil {
@@ -525,12 +539,17 @@ func (c *LowLatencyClient) SelectCourse(urlStr, courseID string) error {
 
 	log.Printf("SelectCourse GET Status: %s, URL: %s", respGet.Status, respGet.Request.URL.String())
 
-	bodyBytes, _ := io.ReadAll(respGet.Body)
+	bodyBytes, readErr := io.ReadAll(respGet.Body)
 	bodyStr := string(bodyBytes)
 
 	// Save for debugging
 	os.WriteFile("debug_html/debug_course_page.html", bodyBytes, 0644)
 
+	// Without a locked slot and girl the site redirects to an error page
+	if strings.Contains(respGet.Request.URL.Path, "/error/") {
+		return fmt.Errorf("course page: %w", errorPage(respGet.Request.URL, bodyBytes, readErr))
+	}
+
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(bodyStr))
 	if err != nil {
 		return fmt.Errorf("failed to parse course page: %w", err)
@@ -563,13 +582,17 @@ func (c *LowLatencyClient) SelectCourse(urlStr, courseID string) error {
 		}
 	})
 
+	if data.Get("_csrf") == "" {
+		return fmt.Errorf("course form: %w", ErrCSRFMissing)
+	}
+
 	// Ensure course_id is set (in case we picked a form by other means)
 	data.Set("course_id", courseID)
 
 	log.Printf("SelectCourse POST Fields: %v", data)
 
 	// 3. POST request
-	reqPost, err := http.NewRequest("POST", urlStr, strings.NewReader(data.Encode()))
+	reqPost, err := http.NewRequestWithContext(ctx, "POST", urlStr, strings.NewReader(data.Encode()))
 	if err != nil {
 		return err
 	}
@@ -587,15 +610,15 @@ func (c *LowLatencyClient) SelectCourse(urlStr, courseID string) error {
 
 	// 301/302 Redirect is success, 200 might also be success if it renders next page
 	if respPost.StatusCode >= 400 {
-		return fmt.Errorf("course selection failed: %s", respPost.Status)
+		return statusError("course selection failed", respPost)
 	}
-	return nil
+	return c.followPreProfilePages(ctx, respPost, config)
 }
 
 // SubmitProfile submits user details and returns the response body of the resulting page and its URL
-func (c *LowLatencyClient) SubmitProfile(urlStr string, config ReservationConfig) ([]byte, string, error) {
+func (c *LowLatencyClient) SubmitProfile(ctx context.Context, urlStr string, config ReservationConfig) ([]byte, string, error) {
 	// 1. GET request (fetch CSRF and other hidden fields)
-	reqGet, _ := http.NewRequest("GET", urlStr, nil)
+	reqGet, _ := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	reqGet.Header.Set("Referer", "https://yoyaku.cityheaven.net/select_course/")
 	respGet, err := c.DoSession(reqGet)
 	if err != nil {
@@ -626,6 +649,11 @@ func (c *LowLatencyClient) SubmitProfile(urlStr string, config ReservationConfig
 		}
 	})
 
+	if data.Get("_csrf") == "" {
+		os.WriteFile("debug_html/debug_profile_error.html", bodyBytes, 0644)
+		return nil, "", fmt.Errorf("profile form: %w", ErrCSRFMissing)
+	}
+
 	data.Set("customer_name", config.Name)
 	data.Set("reservation_phone_number", config.Phone)
 	data.Set("mail_pc_sp", config.Email)
@@ -635,7 +663,7 @@ func (c *LowLatencyClient) SubmitProfile(urlStr string, config ReservationConfig
 
 	log.Printf("SubmitProfile POST Fields: %v", data)
 
-	reqPost, err := http.NewRequest("POST", urlStr, strings.NewReader(data.Encode()))
+	reqPost, err := http.NewRequestWithContext(ctx, "POST", urlStr, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, "", err
 	}
@@ -651,47 +679,22 @@ func (c *LowLatencyClient) SubmitProfile(urlStr string, config ReservationConfig
 
 	log.Printf("SubmitProfile POST Status: %s, Final URL: %s", respPost.Status, respPost.Request.URL.String())
 
-	finalBody, _ := io.ReadAll(respPost.Body)
+	finalBody, readErr := io.ReadAll(respPost.Body)
 	finalURL := respPost.Request.URL.String()
 
 	// Check if we were redirected to an error page (e.g. /error/.../EFRESV020801/...)
-	if strings.Contains(finalURL, "/error/") {
-		// Extract error code from URL path
-		errCode := ""
-		parts := strings.Split(finalURL, "/")
-		for _, p := range parts {
-			if strings.HasPrefix(p, "EF") || strings.HasPrefix(p, "ER") {
-				errCode = p
-				break
-			}
-		}
-		// Also try to extract the error message from the HTML
-		errMsg := ""
-		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(string(finalBody)))
-		if doc != nil {
-			errMsg = strings.TrimSpace(doc.Find(".error-msg").Text())
-		}
+	if strings.Contains(respPost.Request.URL.Path, "/error/") {
 		os.WriteFile("debug_html/debug_profile_error.html", finalBody, 0644)
-		if errMsg != "" {
-			return finalBody, finalURL, fmt.Errorf("profile submission failed: server error %s: %s", errCode, errMsg)
-		}
-		return finalBody, finalURL, fmt.Errorf("profile submission failed: server error (code: %s, URL: %s)", errCode, finalURL)
+		return finalBody, finalURL, fmt.Errorf("profile submission failed: %w", errorPage(respPost.Request.URL, finalBody, readErr))
 	}
 
 	// Check for validation errors in the response
 	// If we are still on the input page (form action contains input_profile), it's a validation error
 	// Or check for specific error classes
-	if strings.Contains(string(finalBody), "errorstyle") || strings.Contains(string(finalBody), "error-message") || strings.Contains(string(finalBody), "error-msg") {
-		// Try to extract the error message
-		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(string(finalBody)))
-		errMsg := doc.Find(".errorstyle").Text()
-		if errMsg == "" {
-			errMsg = doc.Find(".error-message").Text()
-		}
-		if errMsg == "" {
-			errMsg = doc.Find(".error-msg").Text()
+	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(finalBody))); err == nil {
+		if verr := parseValidationError(doc); verr != nil {
+			return finalBody, finalURL, fmt.Errorf("profile submission validation error: %w", verr)
 		}
-		return finalBody, finalURL, fmt.Errorf("profile submission validation error: %s", strings.TrimSpace(errMsg))
 	}
 
 	// Check if we are still on the input page (by Title or Form Action)
@@ -701,13 +704,16 @@ func (c *LowLatencyClient) SubmitProfile(urlStr string, config ReservationConfig
 	}
 
 	if respPost.StatusCode >= 400 {
-		return finalBody, finalURL, fmt.Errorf("profile submission failed: %s", respPost.Status)
+		return finalBody, finalURL, statusError("profile submission failed", respPost)
 	}
 	return finalBody, finalURL, nil
 }
 
-// ConfirmReservation finalizes the booking
-func (c *LowLatencyClient) ConfirmReservation(urlStr string, refererURL string, initialBody []byte, dryRun bool) error {
+// ConfirmReservation finalizes the booking and returns its receipt. In a dry
+// run the receipt only holds what the confirm page shows. If ConfirmList was
+// sent but its answer is lost or a 5xx, an *OutcomeUnknownError is returned:
+// the booking may exist, and the form must not be posted again.
+func (c *LowLatencyClient) ConfirmReservation(ctx context.Context, urlStr string, refererURL string, initialBody []byte, dryRun bool) (*BookingReceipt, error) {
 	var bodyBytes []byte
 	var err error
 
@@ -716,11 +722,11 @@ func (c *LowLatencyClient) ConfirmReservation(urlStr string, refererURL string,
 		log.Println("ConfirmReservation: Using provided response body.")
 	} else {
 		// 1. GET (fetch CSRF and other hidden fields)
-		reqGet, _ := http.NewRequest("GET", urlStr, nil)
+		reqGet, _ := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 		reqGet.Header.Set("Referer", "https://yoyaku.cityheaven.net/input_profile/")
 		respGet, err := c.DoSession(reqGet)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		defer respGet.Body.Close()
 
@@ -731,13 +737,13 @@ func (c *LowLatencyClient) ConfirmReservation(urlStr string, refererURL string,
 
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(bodyStr))
 	if err != nil {
-		return fmt.Errorf("failed to parse confirm page: %w", err)
+		return nil, fmt.Errorf("failed to parse confirm page: %w", err)
 	}
 
 	form := doc.Find("form").First()
 	if form.Length() == 0 {
 		os.WriteFile("debug_html/debug_confirm_error.html", bodyBytes, 0644)
-		return fmt.Errorf("failed to find confirm form")
+		return nil, fmt.Errorf("failed to find confirm form")
 	}
 
 	// Determine the actual POST URL from the form's action attribute.
@@ -755,6 +761,9 @@ func (c *LowLatencyClient) ConfirmReservation(urlStr string, refererURL string,
 	}
 	log.Printf("ConfirmReservation: POST target URL = %s", postURL)
 
+	receipt := &BookingReceipt{DryRun: dryRun}
+	parseConfirmDetails(doc, receipt)
+
 	// Extract all hidden fields (especially _csrf)
 	data := url.Values{}
 	form.Find("input[type='hidden'], input[type='submit']").Each(func(i int, s *goquery.Selection) {
@@ -765,45 +774,194 @@ func (c *LowLatencyClient) ConfirmReservation(urlStr string, refererURL string,
 	})
 
 	log.Printf("ConfirmReservation: POST fields = %v", data)
+	if data.Get("_csrf") == "" {
+		os.WriteFile("debug_html/debug_confirm_error.html", bodyBytes, 0644)
+		return nil, fmt.Errorf("confirm form: %w", ErrCSRFMissing)
+	}
+
+	// 2. Duplicate checks: the browser runs these when the confirm button is
+	// pressed and only posts ConfirmList if neither reports a conflict.
+	if err := c.CheckDuplicates(ctx, urlStr); err != nil {
+		return nil, err
+	}
 
 	if dryRun {
 		log.Println("DRY RUN: Skipping final POST to", postURL)
 		log.Printf("Would have sent fields: %v", data)
-		return nil
+		receipt.ConfirmedAt = time.Now()
+		return receipt, nil
 	}
 
-	// 2. POST
-	reqPost, err := http.NewRequest("POST", postURL, strings.NewReader(data.Encode()))
+	// 3. POST
+	reqPost, err := http.NewRequestWithContext(ctx, "POST", postURL, strings.NewReader(data.Encode()))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	reqPost.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	reqPost.Header.Set("Referer", refererURL)
 	reqPost.Header.Set("Origin", "https://yoyaku.cityheaven.net")
 
+	// From here on the booking may exist even if no answer comes back
+	unknown := func(err error) error {
+		return &OutcomeUnknownError{URL: postURL, Receipt: receipt, Err: err}
+	}
 	respPost, err := c.DoSession(reqPost)
+	if errors.Is(err, ErrSessionExpired) {
+		return nil, err
+	}
 	if err != nil {
-		return err
+		return nil, unknown(err)
 	}
 	defer respPost.Body.Close()
 
 	log.Println("Reservation Confirm Status:", respPost.Status)
 
-	// 3. Verify Success
-	finalBody, _ := io.ReadAll(respPost.Body)
+	// 4. Verify Success
+	finalBody, err := io.ReadAll(respPost.Body)
+	if err != nil {
+		return nil, unknown(err)
+	}
 	finalBodyStr := string(finalBody)
 
+	if strings.Contains(respPost.Request.URL.Path, "/error/") {
+		os.WriteFile("debug_html/debug_confirm_failed.html", finalBody, 0644)
+		return nil, fmt.Errorf("reservation confirmation failed: %w", errorPage(respPost.Request.URL, finalBody, nil))
+	}
+	if respPost.StatusCode >= 500 {
+		return nil, unknown(statusError("reservation confirmation failed", respPost))
+	}
+	if respPost.StatusCode >= 400 {
+		return nil, statusError("reservation confirmation failed", respPost)
+	}
+
 	// Check for success indicators
 	// "予約完了" (Reservation Complete), "ありがとうございます" (Thank you)
 	if !strings.Contains(finalBodyStr, "予約完了") && !strings.Contains(finalBodyStr, "ありがとうございます") && !strings.Contains(finalBodyStr, "Reservation Complete") {
 		// Save debug HTML
 		os.WriteFile("debug_html/debug_confirm_failed.html", finalBody, 0644)
-		return fmt.Errorf("reservation confirmation failed (success message not found in response)")
+		return nil, fmt.Errorf("reservation confirmation failed (success message not found in response)")
+	}
+
+	// 5. Receipt from the completion page
+	receipt.ConfirmedAt = time.Now()
+	if completeDoc, err := goquery.NewDocumentFromReader(strings.NewReader(finalBodyStr)); err == nil {
+		parseCompletePage(completeDoc, respPost.Request.URL.String(), receipt)
+	}
+	log.Printf("Booking receipt: %s %s with %s at %s (%s, %s)", receipt.Date, receipt.Time, receipt.GirlName, receipt.ShopName, receipt.Course, receipt.Price)
+
+	return receipt, nil
+}
+
+// DuplicateCheck is the JSON answer of the /Confirm/Dupli* endpoints,
+// e.g. {"result":"OK","flag":false}. Flag is true when the account already
+// holds a registration that conflicts with the booking being confirmed.
+type DuplicateCheck struct {
+	Result string `json:"result"`
+	Flag   bool   `json:"flag"`
+}
+
+// DuplicateKind names the existing registration a duplicate check found.
+type DuplicateKind string
+
+const (
+	DuplicateCancelWait         DuplicateKind = "cancel-wait notification"
+	DuplicateReservationRequest DuplicateKind = "reservation request"
+)
+
+// DuplicateReservationError is returned by ConfirmReservation when the site
+// reports that the booking duplicates an existing registration. The browser
+// would offer to release the existing one; the bot leaves it alone and does
+// not send ConfirmList.
+type DuplicateReservationError struct {
+	Kind    DuplicateKind
+	Message string // Text of the site's confirmation modal
+}
+
+// Is makes a DuplicateReservationError match ErrDuplicateReservation.
+func (e *DuplicateReservationError) Is(target error) bool {
+	return target == ErrDuplicateReservation
+}
+
+func (e *DuplicateReservationError) Error() string {
+	return fmt.Sprintf("duplicate reservation: account already has a %s (%s)", e.Kind, e.Message)
+}
+
+// DupliConfirmCancellWait asks whether the account has a cancel-wait
+// notification that would conflict with this booking.
+func (c *LowLatencyClient) DupliConfirmCancellWait(ctx context.Context, confirmPageURL string) (*DuplicateCheck, error) {
+	return c.postDupliCheck(ctx, "https://yoyaku.cityheaven.net/Confirm/DupliConfirmCancellWait", confirmPageURL)
+}
+
+// DupliConfirmReservationRequest asks whether the account has a pending
+// reservation request that would conflict with this booking.
+func (c *LowLatencyClient) DupliConfirmReservationRequest(ctx context.Context, confirmPageURL string) (*DuplicateCheck, error) {
+	return c.postDupliCheck(ctx, "https://yoyaku.cityheaven.net/Confirm/DupliConfirmReservationRequest", confirmPageURL)
+}
+
+// CheckDuplicates runs both duplicate checks in browser order and returns a
+// *DuplicateReservationError for the first one that reports a conflict.
+func (c *LowLatencyClient) CheckDuplicates(ctx context.Context, confirmPageURL string) error {
+	wait, err := c.DupliConfirmCancellWait(ctx, confirmPageURL)
+	if err != nil {
+		return err
+	}
+	if wait.Flag {
+		return &DuplicateReservationError{
+			Kind:    DuplicateCancelWait,
+			Message: "予約とキャンセル待ち通知を重複して登録することはできません",
+		}
+	}
+
+	request, err := c.DupliConfirmReservationRequest(ctx, confirmPageURL)
+	if err != nil {
+		return err
+	}
+	if request.Flag {
+		return &DuplicateReservationError{
+			Kind:    DuplicateReservationRequest,
+			Message: "予約と予約リクエストを重複して登録することはできません",
+		}
 	}
 
+	log.Println("Duplicate checks passed (no cancel-wait notification or reservation request).")
 	return nil
 }
 
+// postDupliCheck sends the empty JSON POST the confirm page issues via XHR.
+func (c *LowLatencyClient) postDupliCheck(ctx context.Context, endpoint, referer string) (*DuplicateCheck, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	req.Header.Set("Referer", referer)
+	req.Header.Set("Origin", "https://yoyaku.cityheaven.net")
+
+	resp, err := c.DoSession(req)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate check %s failed: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	log.Printf("Duplicate check %s (status %s): %s", endpoint, resp.Status, string(bodyBytes))
+
+	if resp.StatusCode >= 400 {
+		return nil, statusError("duplicate check "+endpoint+" failed", resp)
+	}
+
+	var check DuplicateCheck
+	if err := json.Unmarshal(bodyBytes, &check); err != nil {
+		return nil, fmt.Errorf("duplicate check %s returned unexpected body: %w", endpoint, err)
+	}
+	if check.Result != "OK" {
+		return nil, fmt.Errorf("duplicate check %s returned result %q", endpoint, check.Result)
+	}
+	return &check, nil
+}
+
 // Helper to get CSRF token URL usually via Get request first
 func (c *LowLatencyClient) GetCSRFToken(urlStr string) (string, error) {
 	req, err := http.NewRequest("GET", urlStr, nil)
@@ -0,0 +1,478 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FlowState is a stage of the reservation flow. Each state records the last
+// step that completed successfully.
+type FlowState int
+
+const (
+	StateStart            FlowState = iota // Nothing sent yet
+	StateSlotSelected                      // POST /calendar/SelectedList/ accepted
+	StateGirlSelected                      // POST /Selectvacancygirl/SelectedGirl accepted
+	StateCourseSelected                    // select_course form submitted
+	StateProfileSubmitted                  // input_profile accepted, confirm page loaded
+	StateConfirmed                         // Confirm/ConfirmList accepted (or skipped in dry run)
+	StateFailed                            // Permanent failure, cannot resume
+)
+
+var flowStateNames = map[FlowState]string{
+	StateStart:            "Start",
+	StateSlotSelected:     "SlotSelected",
+	StateGirlSelected:     "GirlSelected",
+	StateCourseSelected:   "CourseSelected",
+	StateProfileSubmitted: "ProfileSubmitted",
+	StateConfirmed:        "Confirmed",
+	StateFailed:           "Failed",
+}
+
+func (s FlowState) String() string {
+	if name, ok := flowStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("FlowState(%d)", int(s))
+}
+
+// Terminal reports whether no further transition is possible.
+func (s FlowState) Terminal() bool {
+	return s == StateConfirmed || s == StateFailed
+}
+
+// DefaultStepTimeouts bounds each transition, keyed by the state it leads to.
+// Course selection and profile submission are a GET + POST each, hence longer.
+var DefaultStepTimeouts = map[FlowState]time.Duration{
+	StateSlotSelected:     5 * time.Second,
+	StateGirlSelected:     5 * time.Second,
+	StateCourseSelected:   10 * time.Second,
+	StateProfileSubmitted: 10 * time.Second,
+	StateConfirmed:        15 * time.Second,
+}
+
+// ErrStepTimeout is wrapped by TransitionError when a step exceeds its timeout.
+var ErrStepTimeout = errors.New("step timed out")
+
+// ErrFlowFinished is returned when stepping a flow that is Confirmed or Failed.
+var ErrFlowFinished = errors.New("reservation flow already finished")
+
+// TransitionError reports a failed transition From → To.
+// Transient errors (timeouts, network failures) leave the flow in From so it
+// can be resumed; anything else moves it to StateFailed.
+type TransitionError struct {
+	From      FlowState
+	To        FlowState
+	Attempt   int
+	Transient bool
+	Err       error
+}
+
+func (e *TransitionError) Error() string {
+	kind := "failed"
+	if e.Transient {
+		kind = "failed (transient)"
+	}
+	return fmt.Sprintf("%s → %s %s on attempt %d: %v", e.From, e.To, kind, e.Attempt, e.Err)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// FlowHooks are optional callbacks for logging and metrics. Nil hooks are skipped.
+type FlowHooks struct {
+	// OnStepStart is called before each attempt of a transition.
+	OnStepStart func(from, to FlowState, attempt int)
+	// OnTransition is called after a transition succeeds.
+	OnTransition func(from, to FlowState, elapsed time.Duration)
+	// OnError is called after a transition attempt fails.
+	OnError func(err *TransitionError, elapsed time.Duration)
+	// OnTimeChange is called when a time proposed by timeChangeProposal
+	// replaces the requested slot.
+	OnTimeChange func(requested, accepted Slot)
+	// OnRelogin is called after Relogin ran for an expired session.
+	OnRelogin func(event ReloginEvent)
+}
+
+// ReloginEvent records a re-login after the site ended the session during a
+// step.
+type ReloginEvent struct {
+	At    time.Time
+	Step  FlowState // Target state of the step that found the session gone
+	Cause string    // The ErrSessionExpired error
+	Err   string    // Why the re-login failed; empty if it succeeded
+}
+
+func (e ReloginEvent) String() string {
+	result := "logged in again, flow replayed"
+	if e.Err != "" {
+		result = "re-login failed: " + e.Err
+	}
+	return fmt.Sprintf("%s %s: %s; %s", e.At.Format("15:04:05.000"), e.Step, e.Cause, result)
+}
+
+// ReservationFlow drives one booking through SelectSlot → SelectGirl →
+// SelectCourse → SubmitProfile → ConfirmReservation, keeping the last good
+// state so a transient failure resumes from there instead of from SelectSlot.
+type ReservationFlow struct {
+	Client *LowLatencyClient
+	Config ReservationConfig
+	Slot   Slot
+
+	CourseSelectURL string
+	ProfileInputURL string
+	ConfirmURL      string // Fallback when SubmitProfile does not report the confirm page URL
+	DryRun          bool
+
+	// Timeouts overrides DefaultStepTimeouts per target state.
+	Timeouts map[FlowState]time.Duration
+	// MaxRetries is how many times Run retries a transient failure of a
+	// single step before giving up (the flow stays resumable).
+	MaxRetries int
+	// TimeChangeWindow is how far from Slot a time proposed by
+	// timeChangeProposal may be and still be accepted when the requested time
+	// is gone. Zero accepts no proposal.
+	TimeChangeWindow time.Duration
+	// SkipTimeChange leaves out timeChangeProposal, so SelectedList is the
+	// first request (snipe mode).
+	SkipTimeChange bool
+	// Waitlist registers a cancellation notification on a full slot instead
+	// of booking it (see SelectWaitlistSlot). timeChangeProposal is skipped:
+	// the point is to wait for this exact time.
+	Waitlist bool
+	// Relogin, if set, is called when a step fails with ErrSessionExpired.
+	// It should log in again and reopen the yoyaku session (see
+	// LowLatencyClient.Relogin). The new session holds none of the slot, girl
+	// or course the old one had selected, so the flow then replays every
+	// step from StateStart up to the one that failed, once.
+	Relogin func() error
+	Hooks   FlowHooks
+
+	state       FlowState
+	confirmBody []byte
+	confirmPage string
+	receipt     *BookingReceipt
+	requests    []RequestResult
+	relogins    []ReloginEvent
+}
+
+// NewReservationFlow creates a flow in StateStart with default timeouts and
+// one retry per step.
+func NewReservationFlow(c *LowLatencyClient, cfg ReservationConfig, slot Slot) *ReservationFlow {
+	return &ReservationFlow{
+		Client:     c,
+		Config:     cfg,
+		Slot:       slot,
+		MaxRetries: 1,
+	}
+}
+
+// State returns the last state reached.
+func (f *ReservationFlow) State() FlowState {
+	return f.state
+}
+
+// Receipt returns the booking receipt once the flow is Confirmed.
+func (f *ReservationFlow) Receipt() *BookingReceipt {
+	return f.receipt
+}
+
+// Requests returns every request the flow's steps sent, retries included,
+// tagged with the state they led to.
+func (f *ReservationFlow) Requests() []RequestResult {
+	return f.requests
+}
+
+// Relogins returns the re-logins the flow went through, in order.
+func (f *ReservationFlow) Relogins() []ReloginEvent {
+	return f.relogins
+}
+
+// CriticalRequest returns the request the booking hinged on: the last
+// SelectedList (the slot lock that races other customers), or nil if the
+// flow never sent one.
+func (f *ReservationFlow) CriticalRequest() *RequestResult {
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if r := f.requests[i]; strings.Contains(r.URL, "/SelectedList/") {
+			return &r
+		}
+	}
+	return nil
+}
+
+// Run steps the flow until it is Confirmed or Failed, retrying transient
+// failures of the current step up to MaxRetries times. If retries run out,
+// the error is returned with the flow still in its last good state and Run
+// may be called again to resume.
+func (f *ReservationFlow) Run(ctx context.Context) error {
+	for !f.state.Terminal() {
+		var err error
+		for attempt := 1; attempt <= f.MaxRetries+1; attempt++ {
+			if err = f.step(ctx, attempt); err == nil {
+				break
+			}
+			var te *TransitionError
+			if !errors.As(err, &te) || !te.Transient || ctx.Err() != nil {
+				return err
+			}
+			log.Printf("Reservation flow: resuming from %s after transient error: %v", f.state, te.Err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step performs the single transition out of the current state.
+func (f *ReservationFlow) Step(ctx context.Context) error {
+	return f.step(ctx, 1)
+}
+
+func (f *ReservationFlow) step(ctx context.Context, attempt int) error {
+	if f.state.Terminal() {
+		return ErrFlowFinished
+	}
+	from, to := f.state, f.state+1
+
+	if f.Hooks.OnStepStart != nil {
+		f.Hooks.OnStepStart(from, to, attempt)
+	}
+
+	start := time.Now()
+	err := f.run(ctx, to)
+	if errors.Is(err, ErrSessionExpired) && f.Relogin != nil && ctx.Err() == nil {
+		if err = f.relogin(to, err); err == nil {
+			err = f.replay(ctx, to)
+		}
+	}
+	if errors.Is(err, ErrOutcomeUnknown) {
+		err = f.lookupBooking(err)
+	}
+	elapsed := time.Since(start)
+
+	if err == nil {
+		f.state = to
+		if f.Hooks.OnTransition != nil {
+			f.Hooks.OnTransition(from, to, elapsed)
+		}
+		return nil
+	}
+
+	te := &TransitionError{From: from, To: to, Attempt: attempt, Transient: isTransient(err), Err: err}
+	if !te.Transient {
+		f.state = StateFailed
+	}
+	if f.Hooks.OnError != nil {
+		f.Hooks.OnError(te, elapsed)
+	}
+	return te
+}
+
+// run performs the transition into to within its step timeout.
+func (f *ReservationFlow) run(ctx context.Context, to FlowState) error {
+	stepCtx, cancel := context.WithTimeout(ctx, f.timeout(to))
+	defer cancel()
+	stepCtx, sent := withStep(stepCtx, to.String())
+	err := f.transition(stepCtx, to)
+	f.requests = append(f.requests, sent.requests()...)
+	if err != nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("%w after %v: %w", ErrStepTimeout, f.timeout(to), err)
+	}
+	return err
+}
+
+// relogin runs Relogin after the step into to found the session expired
+// (cause) and records the event. It runs outside the step timeout, tagged
+// "Relogin" in the request log.
+func (f *ReservationFlow) relogin(to FlowState, cause error) error {
+	log.Printf("Reservation flow: %v during %s, logging in again", cause, to)
+	untag := f.Client.TagRequests("Relogin")
+	err := f.Relogin()
+	untag()
+
+	event := ReloginEvent{At: time.Now(), Step: to, Cause: cause.Error()}
+	if err != nil {
+		event.Err = err.Error()
+	}
+	f.relogins = append(f.relogins, event)
+	if f.Hooks.OnRelogin != nil {
+		f.Hooks.OnRelogin(event)
+	}
+	if err != nil {
+		return fmt.Errorf("%w (re-login failed: %v)", cause, err)
+	}
+	return nil
+}
+
+// replay runs every transition from StateStart up to to on a fresh
+// session. The hooks only see the step into to, which step reports.
+func (f *ReservationFlow) replay(ctx context.Context, to FlowState) error {
+	for s := StateSlotSelected; s < to; s++ {
+		if err := f.run(ctx, s); err != nil {
+			return fmt.Errorf("replaying %s after re-login: %w", s, err)
+		}
+	}
+	return f.run(ctx, to)
+}
+
+// lookupBooking looks the booking up on My Page after ConfirmList was sent
+// but its outcome is unknown (cause), instead of posting the form again. If
+// it is listed, the flow keeps the receipt from the confirm page.
+func (f *ReservationFlow) lookupBooking(cause error) error {
+	log.Printf("Reservation flow: %v, looking the booking up on My Page", cause)
+	untag := f.Client.TagRequests("CheckReservations")
+	reservations, err := f.Client.CheckReservations()
+	untag()
+	if err != nil {
+		return fmt.Errorf("%w (reservation lookup failed: %v)", cause, err)
+	}
+	for _, r := range reservations {
+		if r.Waitlist() != f.Waitlist || !r.Matches(f.Slot) {
+			continue
+		}
+		receipt := &BookingReceipt{}
+		var ou *OutcomeUnknownError
+		if errors.As(cause, &ou) && ou.Receipt != nil {
+			receipt = ou.Receipt
+		}
+		if receipt.GirlID == "" {
+			receipt.GirlID = f.Config.GirlID
+		}
+		if receipt.ShopName == "" {
+			receipt.ShopName = r.ShopName
+		}
+		receipt.Waitlist = f.Waitlist
+		receipt.ConfirmedAt = time.Now()
+		f.receipt = receipt
+		log.Printf("Reservation flow: booking found on My Page (%s %s, %s)", r.Date, r.Time, r.Status)
+		return nil
+	}
+	return fmt.Errorf("%w (not listed on My Page)", cause)
+}
+
+// transition runs the request(s) that lead to state to, bound to ctx.
+func (f *ReservationFlow) transition(ctx context.Context, to FlowState) error {
+	c, cfg, slot := f.Client, f.Config, f.Slot
+
+	switch to {
+	case StateSlotSelected:
+		if f.Waitlist {
+			return c.SelectWaitlistSlot(ctx, cfg.AreaPath, cfg.ShopDir, cfg.GirlID, slot.Date, slot.DayTime)
+		}
+		if !f.SkipTimeChange {
+			if _, err := f.proposeTimeChange(ctx, ProposalCalendar); err != nil {
+				return err
+			}
+			slot = f.Slot
+		}
+		if slot.Status() == SlotPhoneOnly {
+			return fmt.Errorf("%w: %s %s", ErrPhoneOnly, slot.Date, slot.DayTime)
+		}
+		return c.SelectSlot(ctx, cfg.AreaPath, cfg.ShopDir, cfg.GirlID, slot.Date, slot.DayTime)
+	case StateGirlSelected:
+		if f.Waitlist || f.SkipTimeChange {
+			return c.SelectGirl(ctx, cfg.ShopID, cfg.GirlID, slot.Date, slot.DayTime)
+		}
+		changed, err := f.proposeTimeChange(ctx, ProposalGirl)
+		if err != nil {
+			return err
+		}
+		slot = f.Slot
+		if changed {
+			// SelectedList locked the old time; lock the new one first
+			if err := c.SelectSlot(ctx, cfg.AreaPath, cfg.ShopDir, cfg.GirlID, slot.Date, slot.DayTime); err != nil {
+				return err
+			}
+		}
+		return c.SelectGirl(ctx, cfg.ShopID, cfg.GirlID, slot.Date, slot.DayTime)
+	case StateCourseSelected:
+		return c.SelectCourse(ctx, f.CourseSelectURL, cfg)
+	case StateProfileSubmitted:
+		body, pageURL, err := c.SubmitProfile(ctx, f.ProfileInputURL, cfg)
+		if err != nil {
+			return err
+		}
+		f.confirmBody, f.confirmPage = body, pageURL
+		return nil
+	case StateConfirmed:
+		target := f.confirmPage
+		if target == "" {
+			target = f.ConfirmURL
+		}
+		receipt, err := c.ConfirmReservation(ctx, target, f.confirmPage, f.confirmBody, f.DryRun)
+		if err != nil {
+			return err
+		}
+		if receipt.GirlID == "" {
+			receipt.GirlID = cfg.GirlID
+		}
+		receipt.Waitlist = f.Waitlist
+		f.receipt = receipt
+		return nil
+	}
+	return fmt.Errorf("no transition into %s", to)
+}
+
+// proposeTimeChange sends timeChangeProposal as the browser does before
+// SelectedList and SelectedGirl. If the server says the requested time is gone,
+// the nearest proposed time within TimeChangeWindow replaces f.Slot and true
+// is returned; otherwise a *TimeChangeError is returned.
+func (f *ReservationFlow) proposeTimeChange(ctx context.Context, stage TimeChangeStage) (bool, error) {
+	cfg := f.Config
+	p, err := f.Client.TimeChangeProposal(ctx, stage, cfg.AreaPath, cfg.ShopDir, cfg.GirlID, f.Slot.Date, f.Slot.DayTime)
+	if err != nil {
+		return false, err
+	}
+	if !p.Changed {
+		return false, nil
+	}
+
+	alt, ok := NearestProposal(f.Slot, p.Alternatives, f.TimeChangeWindow)
+	if !ok {
+		return false, &TimeChangeError{Requested: f.Slot, Alternatives: p.Alternatives, Window: f.TimeChangeWindow}
+	}
+	log.Printf("Reservation flow: %s %s is gone, accepting proposed %s %s", f.Slot.Date, f.Slot.DayTime, alt.Date, alt.DayTime)
+	if f.Hooks.OnTimeChange != nil {
+		f.Hooks.OnTimeChange(f.Slot, alt)
+	}
+	f.Slot = alt
+	return true, nil
+}
+
+func (f *ReservationFlow) timeout(to FlowState) time.Duration {
+	if d, ok := f.Timeouts[to]; ok && d > 0 {
+		return d
+	}
+	return DefaultStepTimeouts[to]
+}
+
+// isTransient reports whether a step error is worth retrying from the same
+// state: timeouts, transport failures and 5xx answers are, server-side
+// rejections are not. Neither is anything after ConfirmList was sent, which
+// may have booked the slot.
+func isTransient(err error) bool {
+	if errors.Is(err, ErrOutcomeUnknown) {
+		return false
+	}
+	if errors.Is(err, ErrStepTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var se *ServerError
+	if errors.As(err, &se) && se.Status >= 500 {
+		return true
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
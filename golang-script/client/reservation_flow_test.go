@@ -0,0 +1,293 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+// faultyTransport fails or delays requests whose "METHOD path" contains match.
+type faultyTransport struct {
+	next  http.RoundTripper
+	match string
+	delay time.Duration
+	fails int // number of matching requests to fail with a transport error
+
+	mu sync.Mutex
+}
+
+func (t *faultyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.Contains(req.Method+" "+req.URL.Path, t.match) {
+		t.mu.Lock()
+		fail := t.fails > 0
+		if fail {
+			t.fails--
+		}
+		t.mu.Unlock()
+		if fail {
+			return nil, errors.New("connection reset by peer")
+		}
+		if t.delay > 0 {
+			select {
+			case <-time.After(t.delay):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// newFlow logs in, fetches the calendar and returns a flow for the open slot.
+func newFlow(t *testing.T, c *client.LowLatencyClient, srv *mockserver.Server) *client.ReservationFlow {
+	t.Helper()
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	slots, err := c.FetchCalendar(s6URL)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("FetchCalendar: %v %v", slots, err)
+	}
+	f := client.NewReservationFlow(c, testProfile, slots[0])
+	f.CourseSelectURL = courseSelectURL
+	f.ProfileInputURL = profileInputURL
+	return f
+}
+
+func countRequests(srv *mockserver.Server, substr string) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if strings.Contains(r, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReservationFlowRun(t *testing.T) {
+	c, srv := newTestClient(t)
+	f := newFlow(t, c, srv)
+
+	var transitions []string
+	f.Hooks.OnTransition = func(from, to client.FlowState, _ time.Duration) {
+		transitions = append(transitions, from.String()+"→"+to.String())
+	}
+
+	if err := f.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if f.State() != client.StateConfirmed {
+		t.Fatalf("state = %s, want Confirmed", f.State())
+	}
+	want := "Start→SlotSelected SlotSelected→GirlSelected GirlSelected→CourseSelected CourseSelected→ProfileSubmitted ProfileSubmitted→Confirmed"
+	if got := strings.Join(transitions, " "); got != want {
+		t.Errorf("transitions = %s, want %s", got, want)
+	}
+	if n := len(srv.Bookings()); n != 1 {
+		t.Errorf("got %d bookings, want 1", n)
+	}
+	if r := f.Receipt(); r == nil || r.GirlID != testGirlID || r.Slot() != f.Slot.Date+" 14:00" {
+		t.Errorf("receipt = %+v", r)
+	}
+}
+
+func TestReservationFlowResumesAfterTransientError(t *testing.T) {
+	c, srv := newTestClient(t)
+	ft := &faultyTransport{next: srv.Transport(), match: "POST /select_course/", fails: 1}
+	c.SetTransport(ft)
+	f := newFlow(t, c, srv)
+
+	var errs []*client.TransitionError
+	f.Hooks.OnError = func(err *client.TransitionError, _ time.Duration) { errs = append(errs, err) }
+
+	if err := f.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(errs) != 1 || errs[0].From != client.StateGirlSelected || !errs[0].Transient {
+		t.Fatalf("errors = %v, want one transient GirlSelected → CourseSelected failure", errs)
+	}
+	if n := countRequests(srv, "/calendar/SelectedList/"); n != 1 {
+		t.Errorf("SelectedList posted %d times, want 1 (flow restarted instead of resuming)", n)
+	}
+	if n := len(srv.Bookings()); n != 1 {
+		t.Errorf("got %d bookings, want 1", n)
+	}
+}
+
+func TestReservationFlowStepTimeout(t *testing.T) {
+	c, srv := newTestClient(t)
+	ft := &faultyTransport{next: srv.Transport(), match: "/Selectvacancygirl/SelectedGirl", delay: time.Second}
+	c.SetTransport(ft)
+	f := newFlow(t, c, srv)
+	f.MaxRetries = 0
+	f.Timeouts = map[client.FlowState]time.Duration{client.StateGirlSelected: 50 * time.Millisecond}
+
+	err := f.Run(context.Background())
+	var te *client.TransitionError
+	if !errors.As(err, &te) || !errors.Is(err, client.ErrStepTimeout) {
+		t.Fatalf("Run: got %v, want a step timeout", err)
+	}
+	if te.From != client.StateSlotSelected || te.To != client.StateGirlSelected || !te.Transient {
+		t.Errorf("unexpected transition error %+v", te)
+	}
+	if f.State() != client.StateSlotSelected {
+		t.Fatalf("state = %s, want SlotSelected", f.State())
+	}
+
+	// The delay is gone; Run resumes from SlotSelected.
+	ft.delay = 0
+	if err := f.Run(context.Background()); err != nil {
+		t.Fatalf("resumed Run: %v", err)
+	}
+	if f.State() != client.StateConfirmed {
+		t.Errorf("state = %s, want Confirmed", f.State())
+	}
+}
+
+func TestReservationFlowPermanentFailure(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.ProfileErrorCode = "EFRESV020801"
+	f := newFlow(t, c, srv)
+
+	err := f.Run(context.Background())
+	var te *client.TransitionError
+	if !errors.As(err, &te) || te.Transient || te.From != client.StateCourseSelected {
+		t.Fatalf("Run: got %v, want permanent CourseSelected → ProfileSubmitted failure", err)
+	}
+	if f.State() != client.StateFailed {
+		t.Errorf("state = %s, want Failed", f.State())
+	}
+	if err := f.Step(context.Background()); !errors.Is(err, client.ErrFlowFinished) {
+		t.Errorf("Step after failure: got %v, want ErrFlowFinished", err)
+	}
+}
+
+func TestReservationFlowConfirmOutcomeUnknown(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int           // Answer to ConfirmList after booking
+		delay  time.Duration // Before answering, past the step timeout
+		lost   bool          // ConfirmList answered 503 before reaching the shop
+	}{
+		{name: "503 after booking", status: http.StatusServiceUnavailable},
+		{name: "timeout after booking", delay: time.Second},
+		{name: "503 without booking", lost: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, srv := newTestClient(t)
+			srv.ConfirmStatus, srv.ConfirmDelay = tt.status, tt.delay
+			if tt.lost {
+				c.SetTransport(&statusTransport{next: srv.Transport(), match: "ConfirmList", status: http.StatusServiceUnavailable})
+			}
+			f := newFlow(t, c, srv)
+			f.Timeouts = map[client.FlowState]time.Duration{client.StateConfirmed: 200 * time.Millisecond}
+
+			err := f.Run(context.Background())
+			// The duplicate checks run once per ConfirmList attempt
+			if n := countRequests(srv, "/Confirm/DupliConfirmCancellWait"); n != 1 {
+				t.Errorf("ConfirmReservation ran %d times, want 1", n)
+			}
+			if tt.lost {
+				var te *client.TransitionError
+				if !errors.Is(err, client.ErrOutcomeUnknown) || !errors.As(err, &te) || te.Transient {
+					t.Fatalf("Run: err = %v, want a permanent ErrOutcomeUnknown", err)
+				}
+				if f.State() != client.StateFailed || len(srv.Bookings()) != 0 {
+					t.Errorf("state %s with %d bookings, want Failed with none", f.State(), len(srv.Bookings()))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Run: %v (the booking exists)", err)
+			}
+			if n := len(srv.Bookings()); n != 1 {
+				t.Errorf("got %d bookings, want 1", n)
+			}
+			if r := f.Receipt(); f.State() != client.StateConfirmed || r == nil ||
+				r.GirlID != testGirlID || r.Slot() != f.Slot.Date+" 14:00" {
+				t.Errorf("state %s, receipt %+v", f.State(), r)
+			}
+		})
+	}
+}
+
+func TestReservationFlowTimeChange(t *testing.T) {
+	// The 14:00 slot closes either before the calendar-stage or before the
+	// girl-stage timeChangeProposal; both times 14:30 is proposed instead.
+	for _, tc := range []struct {
+		name       string
+		stepsFirst int
+	}{
+		{"BeforeSelectedList", 0},
+		{"BeforeSelectedGirl", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, srv := newTestClient(t)
+			f := newFlow(t, c, srv)
+			f.TimeChangeWindow = 30 * time.Minute
+			requested := f.Slot
+
+			var changes []string
+			f.Hooks.OnTimeChange = func(from, to client.Slot) {
+				changes = append(changes, from.DayTime+"→"+to.DayTime)
+			}
+
+			for i := 0; i < tc.stepsFirst; i++ {
+				if err := f.Step(context.Background()); err != nil {
+					t.Fatalf("Step: %v", err)
+				}
+			}
+			srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: requested.Date, Time: "1400", Mark: "×", Flg: "NG"})
+			srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: requested.Date, Time: "1430", Mark: "○", Flg: "CAN"})
+
+			if err := f.Run(context.Background()); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if got := strings.Join(changes, " "); got != "14:00→14:30" {
+				t.Errorf("time changes = %q, want 14:00→14:30", got)
+			}
+			if n := countRequests(srv, "POST yoyaku.cityheaven.net/timeChangeProposal"); n != 2 {
+				t.Errorf("timeChangeProposal sent %d times, want 2", n)
+			}
+			b := srv.Bookings()
+			if len(b) != 1 || b[0].Time != "1430" {
+				t.Fatalf("bookings = %+v, want one at 1430", b)
+			}
+			if r := f.Receipt(); r == nil || r.Slot() != requested.Date+" 14:30" {
+				t.Errorf("receipt = %+v", r)
+			}
+		})
+	}
+}
+
+func TestReservationFlowTimeChangeOutsideWindow(t *testing.T) {
+	c, srv := newTestClient(t)
+	f := newFlow(t, c, srv)
+	f.TimeChangeWindow = 30 * time.Minute
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: f.Slot.Date, Time: "1400", Mark: "×", Flg: "NG"})
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: f.Slot.Date, Time: "1700", Mark: "○", Flg: "CAN"})
+
+	err := f.Run(context.Background())
+	var tce *client.TimeChangeError
+	if !errors.As(err, &tce) {
+		t.Fatalf("Run: got %v, want TimeChangeError", err)
+	}
+	if len(tce.Alternatives) != 1 || tce.Alternatives[0].DayTime != "17:00" {
+		t.Errorf("alternatives = %+v, want 17:00", tce.Alternatives)
+	}
+	if f.State() != client.StateFailed {
+		t.Errorf("state = %s, want Failed", f.State())
+	}
+	if n := countRequests(srv, "/calendar/SelectedList/"); n != 0 {
+		t.Errorf("SelectedList posted %d times, want 0", n)
+	}
+}
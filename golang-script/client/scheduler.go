@@ -6,16 +6,21 @@ import (
 )
 
 // Scheduler handles precise timing for request execution.
+// Targets are in server time: the local clock corrected by Clock.
 type Scheduler struct {
 	// SpinDuration is the duration before target time to switch from sleeping to busy-waiting.
 	// Default: 5ms
 	SpinDuration time.Duration
+
+	// Clock estimates the site's clock from Date headers (and SNTP).
+	Clock *ServerClock
 }
 
 // NewScheduler creates a new Scheduler.
 func NewScheduler() *Scheduler {
 	return &Scheduler{
 		SpinDuration: 5 * time.Millisecond,
+		Clock:        NewServerClock(),
 	}
 }
 
@@ -24,6 +29,8 @@ func NewScheduler() *Scheduler {
 // for the final milliseconds to ensure high precision (eliminating OS scheduler jitter).
 // Returns the drift (actual wake time - target time).
 func (s *Scheduler) SleepUntil(target time.Time) time.Duration {
+	// Wake at the local time the server clock reaches target
+	target = target.Add(-s.Clock.Offset())
 	now := time.Now()
 
 	// If already past target, return immediately with negative drift
@@ -54,9 +61,22 @@ func (s *Scheduler) SleepUntil(target time.Time) time.Duration {
 	return now.Sub(target)
 }
 
+// Now returns the current server time (the local time if uncalibrated).
+func (s *Scheduler) Now() time.Time {
+	return time.Now().Add(s.Clock.Offset())
+}
+
+// Until returns the server time remaining until t.
+func (s *Scheduler) Until(t time.Time) time.Duration {
+	return t.Sub(s.Now())
+}
+
 // LogDrift prints the drift in a readable format
 func (s *Scheduler) LogDrift(drift time.Duration) {
 	msg := fmt.Sprintf("⏱️  Precision Wake: Drift = %d µs", drift.Microseconds())
+	if est := s.Clock.Estimate(); est.Calibrated() {
+		msg += fmt.Sprintf(" (server clock %s)", est)
+	}
 
 	// Colorize
 	if drift > 1*time.Millisecond {
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxPreProfilePages bounds how many intermediate pages SelectCourse handles
+// before giving up, in case the site sends us round in circles.
+const maxPreProfilePages = 5
+
+// ErrTermsNotAccepted is returned when the shop's terms page asks for
+// agreement and ReservationConfig.AcceptTerms is false.
+var ErrTermsNotAccepted = errors.New("shop requires agreeing to its terms (set accept_terms to proceed)")
+
+// ErrMyheavenAuthRequired is returned when myhevenAuthc renders a page instead
+// of redirecting, i.e. the yoyaku session is not recognised as a member.
+var ErrMyheavenAuthRequired = errors.New("myhevenAuthc asked for MyHeaven authentication (yoyaku session not logged in)")
+
+// UnknownOptionError is returned when requested option IDs are not offered
+// on the shop's select_option page.
+type UnknownOptionError struct {
+	Missing   []string
+	Available map[string]string // option ID → label
+}
+
+func (e *UnknownOptionError) Error() string {
+	var offered []string
+	for id, label := range e.Available {
+		offered = append(offered, fmt.Sprintf("%s (%s)", id, label))
+	}
+	slices.Sort(offered)
+	return fmt.Sprintf("options %v not offered by shop (available: %s)", e.Missing, strings.Join(offered, ", "))
+}
+
+// followPreProfilePages handles the pages between the course POST and
+// input_profile. On the live site these are usually plain 301s
+// (select_option → myhevenAuthc → terms → input_profile), but shops that sell
+// options or require agreeing to terms render a form instead.
+func (c *LowLatencyClient) followPreProfilePages(ctx context.Context, resp *http.Response, config ReservationConfig) error {
+	optionsApplied := len(config.OptionIDs) == 0
+
+	for i := 0; ; i++ {
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		page := resp.Request.URL
+		log.Printf("Course flow: %s (%s)", strings.Join(redirectChain(resp), " → "), resp.Status)
+
+		if resp.StatusCode >= 400 {
+			return statusError("course selection failed at "+page.Path, resp)
+		}
+		if i >= maxPreProfilePages {
+			return fmt.Errorf("course selection did not reach input_profile after %d pages (stuck at %s)", i, page.Path)
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(page.Path, "/input_profile/"):
+			if !optionsApplied {
+				return fmt.Errorf("options %v requested but the shop showed no select_option page", config.OptionIDs)
+			}
+			return nil
+		case strings.HasPrefix(page.Path, "/error/"):
+			return fmt.Errorf("course selection failed: %w", errorPage(page, body, readErr))
+		case strings.HasPrefix(page.Path, "/select_option/"):
+			resp, err = c.SelectOptions(ctx, page.String(), body, config.OptionIDs)
+			optionsApplied = true
+		case strings.HasPrefix(page.Path, "/terms/"):
+			if !config.AcceptTerms {
+				return ErrTermsNotAccepted
+			}
+			resp, err = c.AcceptTerms(ctx, page.String(), body)
+		case strings.HasPrefix(page.Path, "/freservationresv/myhevenAuthc"):
+			return ErrMyheavenAuthRequired
+		default:
+			return fmt.Errorf("course selection landed on unexpected page %s", page)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// SelectOptions submits the select_option form with the given option IDs
+// ticked. Checkboxes not requested are left unticked; a radio group with no
+// requested value keeps the shop's default. Redirects are followed and the
+// resulting response is returned.
+func (c *LowLatencyClient) SelectOptions(ctx context.Context, pageURL string, body []byte, optionIDs []string) (*http.Response, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse select_option page: %w", err)
+	}
+
+	form := doc.Find("form:has(input[type='checkbox']), form:has(input[type='radio'])").First()
+	if form.Length() == 0 {
+		form = doc.Find("form").First()
+	}
+	if form.Length() == 0 {
+		return nil, fmt.Errorf("select_option form not found")
+	}
+
+	data := hiddenFormFields(form)
+	available := map[string]string{}
+	picked := map[string]bool{}
+	radioDefaults := map[string]string{}
+	radioChosen := map[string]bool{}
+
+	form.Find("input[type='checkbox'], input[type='radio']").Each(func(i int, s *goquery.Selection) {
+		name, value := s.AttrOr("name", ""), s.AttrOr("value", "")
+		if name == "" || value == "" {
+			return
+		}
+		available[value] = optionLabel(s)
+		isRadio := s.AttrOr("type", "") == "radio"
+		if slices.Contains(optionIDs, value) {
+			data.Add(name, value)
+			picked[value] = true
+			if isRadio {
+				radioChosen[name] = true
+			}
+		} else if isRadio {
+			if _, checked := s.Attr("checked"); checked {
+				radioDefaults[name] = value
+			}
+		}
+	})
+
+	var missing []string
+	for _, id := range optionIDs {
+		if !picked[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &UnknownOptionError{Missing: missing, Available: available}
+	}
+	for name, value := range radioDefaults {
+		if !radioChosen[name] {
+			data.Set(name, value)
+			log.Printf("SelectOptions: keeping shop default %s=%s (%s)", name, value, available[value])
+		}
+	}
+
+	log.Printf("SelectOptions POST Fields: %v", data)
+	return c.postPreProfileForm(ctx, form, pageURL, data)
+}
+
+// AcceptTerms ticks every checkbox on the terms form and submits it.
+func (c *LowLatencyClient) AcceptTerms(ctx context.Context, pageURL string, body []byte) (*http.Response, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse terms page: %w", err)
+	}
+	form := doc.Find("form").First()
+	if form.Length() == 0 {
+		return nil, fmt.Errorf("terms form not found")
+	}
+
+	data := hiddenFormFields(form)
+	form.Find("input[type='checkbox']").Each(func(i int, s *goquery.Selection) {
+		if name := s.AttrOr("name", ""); name != "" {
+			data.Set(name, s.AttrOr("value", "on"))
+		}
+	})
+
+	log.Printf("AcceptTerms POST Fields: %v", data)
+	return c.postPreProfileForm(ctx, form, pageURL, data)
+}
+
+func (c *LowLatencyClient) postPreProfileForm(ctx context.Context, form *goquery.Selection, pageURL string, data url.Values) (*http.Response, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	action, err := base.Parse(form.AttrOr("action", ""))
+	if err != nil {
+		return nil, fmt.Errorf("bad form action on %s: %w", base.Path, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", action.String(), strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", pageURL)
+	req.Header.Set("Origin", "https://yoyaku.cityheaven.net")
+	return c.DoSession(req)
+}
+
+// hiddenFormFields collects the hidden and submit inputs of a form, which
+// carry _csrf and the page state the server expects back.
+func hiddenFormFields(form *goquery.Selection) url.Values {
+	data := url.Values{}
+	form.Find("input[type='hidden'], input[type='submit']").Each(func(i int, s *goquery.Selection) {
+		if name := s.AttrOr("name", ""); name != "" {
+			data.Set(name, s.AttrOr("value", ""))
+		}
+	})
+	return data
+}
+
+// optionLabel returns the visible text for an option input: its <label>, or
+// the text of its parent element.
+func optionLabel(s *goquery.Selection) string {
+	if id := s.AttrOr("id", ""); id != "" {
+		if label := strings.TrimSpace(s.Closest("form").Find(fmt.Sprintf("label[for='%s']", id)).Text()); label != "" {
+			return label
+		}
+	}
+	return strings.Join(strings.Fields(s.Parent().Text()), " ")
+}
+
+// redirectChain lists the paths a response was redirected through, oldest first.
+func redirectChain(resp *http.Response) []string {
+	var paths []string
+	for req := resp.Request; req != nil; {
+		paths = append([]string{req.URL.Path}, paths...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	return paths
+}
+
+// errorCodeFromPath extracts the EF.../ER... code from an /error/... path.
+func errorCodeFromPath(path string) string {
+	for _, p := range strings.Split(path, "/") {
+		if strings.HasPrefix(p, "EF") || strings.HasPrefix(p, "ER") {
+			return p
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrSessionExpired is matched (errors.Is) by the *SessionExpiredError that
+// Do and DoSession return when the site answers with its login form or age
+// gate instead of the requested page.
+var ErrSessionExpired = errors.New("session expired")
+
+// SessionExpiredError describes a response that shows the session is gone.
+type SessionExpiredError struct {
+	URL    string   // Requested URL
+	Landed string   // Final URL after redirects
+	Via    []string // URLs redirected through on the way to Landed
+	Reason string   // "redirected to login" or "age gate"
+}
+
+func (e *SessionExpiredError) Error() string {
+	return fmt.Sprintf("%v: %s (%s → %s)", ErrSessionExpired, e.Reason, e.URL, e.Landed)
+}
+
+func (e *SessionExpiredError) Is(target error) bool {
+	return target == ErrSessionExpired
+}
+
+// isSessionPage reports whether u is the login form or an age-gate bypass,
+// which Login and HandleAgeVerification request on purpose.
+func isSessionPage(u *url.URL) bool {
+	return strings.Contains(u.Path, "/login/") || u.Query().Get("nenrei") == "y"
+}
+
+// checkSession inspects resp for a lost session: a redirect to /login/, or
+// the age gate (a nenrei=y link and the 18歳未満 notice) served in place of
+// the page. HTML bodies are read to look for the gate and put back, so the
+// caller reads them as usual. On a lost session resp is closed.
+func checkSession(req *http.Request, resp *http.Response) error {
+	if isSessionPage(req.URL) {
+		return nil
+	}
+	landed := req.URL
+	if resp.Request != nil {
+		landed = resp.Request.URL
+	}
+	expired := func(reason string) error {
+		resp.Body.Close()
+		var via []string
+		for _, u := range redirectURLs(resp) {
+			via = append(via, u.String())
+		}
+		if len(via) > 0 {
+			via = via[:len(via)-1] // The last one is Landed
+		}
+		return &SessionExpiredError{URL: req.URL.String(), Landed: landed.String(), Via: via, Reason: reason}
+	}
+	if strings.Contains(landed.Path, "/login/") {
+		return expired("redirected to login")
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", landed, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if bytes.Contains(body, []byte("nenrei=y")) && bytes.Contains(body, []byte("18歳未満")) {
+		return expired("age gate")
+	}
+	return nil
+}
+
+// Relogin logs in again after ErrSessionExpired and reopens the yoyaku
+// session through the S6 handoff at calendarURL (see HandoffToYoyaku).
+// Reservation state held by an expired yoyaku session, such as a slot locked
+// by SelectedList, is not restored.
+func (c *LowLatencyClient) Relogin(username, password, calendarURL string) error {
+	if err := c.Login(username, password); err != nil {
+		return fmt.Errorf("re-login: %w", err)
+	}
+	if _, err := c.HandoffToYoyaku(calendarURL); err != nil {
+		return fmt.Errorf("re-login: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+)
+
+func TestSessionExpiredError(t *testing.T) {
+	c, srv := newTestClient(t)
+
+	// Not logged in yet: the yoyaku session is unknown and bounces to login
+	if _, err := c.FetchCalendar(courseSelectURL); !errors.Is(err, client.ErrSessionExpired) {
+		t.Fatalf("yoyaku page without a session: err = %v, want ErrSessionExpired", err)
+	}
+
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := c.FetchCalendar(s6URL); err != nil {
+		t.Fatalf("FetchCalendar: %v", err)
+	}
+	srv.ExpireSessions()
+	_, err := c.FetchCalendar(s6URL)
+	var se *client.SessionExpiredError
+	if !errors.As(err, &se) || se.Reason != "redirected to login" {
+		t.Fatalf("after expiry: err = %v, want a SessionExpiredError", err)
+	}
+	if ok, err := c.SessionValid(); err != nil || ok {
+		t.Errorf("after expiry: SessionValid = %v, %v; want false", ok, err)
+	}
+}
+
+func TestReservationFlowRelogin(t *testing.T) {
+	c, srv := newTestClient(t)
+	f := newFlow(t, c, srv)
+	f.Relogin = func() error { return c.Relogin(srv.Username, srv.Password, s6URL) }
+	var hooked []client.ReloginEvent
+	f.Hooks.OnRelogin = func(e client.ReloginEvent) { hooked = append(hooked, e) }
+
+	logins := countRequests(srv, "loginAuth")
+	srv.ExpireSessions()
+	if err := f.Run(context.Background()); err != nil {
+		t.Fatalf("Run after the session expired: %v", err)
+	}
+	if n := countRequests(srv, "loginAuth"); n != logins+1 {
+		t.Errorf("%d login POSTs, want %d", n, logins+1)
+	}
+	events := f.Relogins()
+	if len(events) != 1 || len(hooked) != 1 {
+		t.Fatalf("relogins %v, hooked %v; want one each", events, hooked)
+	}
+	if e := events[0]; e.Step != client.StateSlotSelected || e.Err != "" {
+		t.Errorf("relogin event %+v, want a successful one at %s", e, client.StateSlotSelected)
+	}
+}
+
+func TestReservationFlowSessionExpiredWithoutRelogin(t *testing.T) {
+	c, srv := newTestClient(t)
+	f := newFlow(t, c, srv)
+	srv.ExpireSessions()
+	err := f.Run(context.Background())
+	if !errors.Is(err, client.ErrSessionExpired) {
+		t.Fatalf("Run: err = %v, want ErrSessionExpired", err)
+	}
+	if f.State() != client.StateFailed || len(f.Relogins()) != 0 {
+		t.Errorf("state %s, relogins %v; want Failed and none", f.State(), f.Relogins())
+	}
+}
+
+// A session that expires midway leaves the new yoyaku session without the
+// slot, girl and course the old one held: the flow must replay from Start.
+func TestReservationFlowReloginReplays(t *testing.T) {
+	for _, expireAt := range []client.FlowState{client.StateGirlSelected, client.StateCourseSelected} {
+		t.Run(expireAt.String(), func(t *testing.T) {
+			c, srv := newTestClient(t)
+			f := newFlow(t, c, srv)
+			f.Relogin = func() error { return c.Relogin(srv.Username, srv.Password, s6URL) }
+			var transitions []client.FlowState
+			f.Hooks.OnTransition = func(_, to client.FlowState, _ time.Duration) { transitions = append(transitions, to) }
+
+			for f.State() != expireAt {
+				if err := f.Step(context.Background()); err != nil {
+					t.Fatalf("Step to %s: %v", f.State()+1, err)
+				}
+			}
+			locks := countRequests(srv, "SelectedList")
+			girls := countRequests(srv, "SelectedGirl")
+			srv.ExpireSessions()
+			if err := f.Run(context.Background()); err != nil {
+				t.Fatalf("Run after the session expired at %s: %v", expireAt, err)
+			}
+
+			if f.State() != client.StateConfirmed || f.Receipt() == nil {
+				t.Fatalf("state %s, receipt %v; want Confirmed with a receipt", f.State(), f.Receipt())
+			}
+			if n := countRequests(srv, "SelectedList"); n != locks+1 {
+				t.Errorf("%d SelectedList requests, want %d (slot locked again)", n, locks+1)
+			}
+			if n := countRequests(srv, "SelectedGirl"); n != girls+1 {
+				t.Errorf("%d SelectedGirl requests, want %d (girl selected again)", n, girls+1)
+			}
+			if e := f.Relogins(); len(e) != 1 || e[0].Step != expireAt+1 || e[0].Err != "" {
+				t.Errorf("relogins %v, want one successful at %s", e, expireAt+1)
+			}
+			// Replayed steps are not reported as transitions again
+			if want := int(client.StateConfirmed); len(transitions) != want {
+				t.Errorf("transitions %v, want %d", transitions, want)
+			}
+		})
+	}
+}
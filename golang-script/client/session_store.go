@@ -0,0 +1,242 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoredCookie is a cookie as kept by SessionJar: with the domain it was
+// scoped to (the request host for host-only cookies) and its absolute
+// expiry, zero for a session cookie.
+type StoredCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	HostOnly bool      `json:"host_only,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+	Expires  time.Time `json:"expires,omitzero"`
+}
+
+func (s StoredCookie) key() string {
+	return s.Domain + ";" + s.Path + ";" + s.Name
+}
+
+// Expired reports whether the cookie has expired at now.
+func (s StoredCookie) Expired(now time.Time) bool {
+	return !s.Expires.IsZero() && !s.Expires.After(now)
+}
+
+// SessionJar is the cookie jar both clients share. It is a cookiejar.Jar
+// that also remembers every cookie it accepts with its scope and expiry, since
+// cookiejar cannot list its contents, so the session can be saved and
+// restored (see SessionStore).
+type SessionJar struct {
+	jar *cookiejar.Jar
+
+	mu      sync.Mutex
+	cookies map[string]StoredCookie
+}
+
+// NewSessionJar returns an empty jar.
+func NewSessionJar() *SessionJar {
+	jar, _ := cookiejar.New(nil)
+	return &SessionJar{jar: jar, cookies: map[string]StoredCookie{}}
+}
+
+// SetCookies implements http.CookieJar.
+func (j *SessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, ck := range cookies {
+		s := StoredCookie{
+			Name:     ck.Name,
+			Value:    ck.Value,
+			Domain:   strings.ToLower(strings.TrimPrefix(ck.Domain, ".")),
+			Path:     ck.Path,
+			Secure:   ck.Secure,
+			HttpOnly: ck.HttpOnly,
+		}
+		if s.Domain == "" {
+			s.Domain, s.HostOnly = strings.ToLower(u.Hostname()), true
+		}
+		if s.Path == "" || s.Path[0] != '/' {
+			s.Path = defaultCookiePath(u.Path)
+		}
+		switch {
+		case ck.MaxAge < 0:
+			s.Expires = now
+		case ck.MaxAge > 0:
+			s.Expires = now.Add(time.Duration(ck.MaxAge) * time.Second)
+		case !ck.Expires.IsZero():
+			s.Expires = ck.Expires
+		}
+		if s.Expired(now) {
+			delete(j.cookies, s.key())
+		} else {
+			j.cookies[s.key()] = s
+		}
+	}
+}
+
+// defaultCookiePath is the directory of the request path (RFC 6265 5.1.4).
+func defaultCookiePath(p string) string {
+	if p == "" || p[0] != '/' || strings.Count(p, "/") == 1 {
+		return "/"
+	}
+	return path.Dir(p)
+}
+
+// Cookies implements http.CookieJar.
+func (j *SessionJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// All returns the unexpired cookies, ordered by domain, path and name.
+func (j *SessionJar) All() []StoredCookie {
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []StoredCookie
+	for _, s := range j.cookies {
+		if !s.Expired(now) {
+			out = append(out, s)
+		}
+	}
+	slices.SortFunc(out, func(a, b StoredCookie) int { return strings.Compare(a.key(), b.key()) })
+	return out
+}
+
+// Add puts stored cookies back into the jar, skipping expired ones, and
+// returns how many it added.
+func (j *SessionJar) Add(cookies []StoredCookie) int {
+	now := time.Now()
+	n := 0
+	for _, s := range cookies {
+		if s.Expired(now) || s.Name == "" || s.Domain == "" {
+			continue
+		}
+		ck := &http.Cookie{Name: s.Name, Value: s.Value, Path: s.Path, Secure: s.Secure, HttpOnly: s.HttpOnly, Expires: s.Expires}
+		if !s.HostOnly {
+			ck.Domain = s.Domain
+		}
+		j.SetCookies(&url.URL{Scheme: "https", Host: s.Domain, Path: s.Path}, []*http.Cookie{ck})
+		n++
+	}
+	return n
+}
+
+// SessionStore saves the client's cookies (www and yoyaku alike) to a JSON
+// file only the owner can read, so a restart can skip the age gate and
+// Login while the site still honours them.
+type SessionStore struct {
+	Path string
+}
+
+type sessionFile struct {
+	SavedAt time.Time      `json:"saved_at"`
+	Cookies []StoredCookie `json:"cookies"`
+}
+
+// Save writes the client's unexpired cookies to s.Path (mode 0600),
+// replacing the file atomically.
+func (s *SessionStore) Save(c *LowLatencyClient) error {
+	data, err := json.MarshalIndent(sessionFile{SavedAt: time.Now(), Cookies: c.jar.All()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("session store: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("session store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("session store: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("session store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("session store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		return fmt.Errorf("session store: %w", err)
+	}
+	return nil
+}
+
+// Restore loads the saved cookies into the client's jar and returns how many
+// were still unexpired. A missing file is reported as os.ErrNotExist.
+func (s *SessionStore) Restore(c *LowLatencyClient) (int, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return 0, fmt.Errorf("session store: %w", err)
+	}
+	var f sessionFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return 0, fmt.Errorf("session store: %s is corrupt: %w", s.Path, err)
+	}
+	return c.jar.Add(f.Cookies), nil
+}
+
+// ResumeSession restores the session saved in store and keeps it if
+// SessionValid confirms it is still logged in. Otherwise it starts from an
+// empty jar, logs in (age gate included) and saves the new session. resumed
+// reports whether the saved session was used; a failure to save is only
+// logged.
+func (c *LowLatencyClient) ResumeSession(store *SessionStore, username, password string) (resumed bool, err error) {
+	n, err := store.Restore(c)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		log.Printf("⚠️  %v (logging in)", err)
+	case n > 0:
+		ok, err := c.SessionValid()
+		if ok {
+			log.Printf("Restored %d cookies from %s; session still logged in.", n, store.Path)
+			return true, nil
+		}
+		if err != nil {
+			log.Printf("⚠️  Saved session check failed: %v (logging in)", err)
+		} else {
+			log.Printf("Saved session in %s has expired (logging in)", store.Path)
+		}
+	}
+
+	c.ResetCookies()
+	if err := c.Login(username, password); err != nil {
+		return false, err
+	}
+	if err := store.Save(c); err != nil {
+		log.Printf("⚠️  Could not save session: %v", err)
+	}
+	return false, nil
+}
+
+// ResetCookies replaces the jar of both clients with an empty one.
+func (c *LowLatencyClient) ResetCookies() {
+	c.jar = NewSessionJar()
+	c.client.Jar = c.jar
+	c.sessionClient.Jar = c.jar
+	c.mu.Lock()
+	c.yoyaku = nil
+	c.mu.Unlock()
+}
@@ -0,0 +1,116 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+// restartClient is a fresh client (empty jar) on the same mock site, as after
+// a restart of the bot.
+func restartClient(t *testing.T, srv *mockserver.Server) *client.LowLatencyClient {
+	t.Helper()
+	_, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c := client.NewLowLatencyClient(cancel, 0, nil, nil, nil, true)
+	c.SetTransport(srv.Transport())
+	return c
+}
+
+func TestResumeSession(t *testing.T) {
+	c, srv := newTestClient(t)
+	store := &client.SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+
+	// No saved session: log in and save it
+	if resumed, err := c.ResumeSession(store, srv.Username, srv.Password); err != nil || resumed {
+		t.Fatalf("first run: ResumeSession = %v, %v; want a fresh login", resumed, err)
+	}
+	fi, err := os.Stat(store.Path)
+	if err != nil {
+		t.Fatalf("session not saved: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("session file mode %v, want 0600", perm)
+	}
+
+	// Restart: the saved cookies are still logged in on www and yoyaku
+	logins := countRequests(srv, "loginAuth")
+	c = restartClient(t, srv)
+	if resumed, err := c.ResumeSession(store, srv.Username, srv.Password); err != nil || !resumed {
+		t.Fatalf("restart: ResumeSession = %v, %v; want the saved session", resumed, err)
+	}
+	if n := countRequests(srv, "loginAuth"); n != logins {
+		t.Errorf("restart logged in again (%d → %d login POSTs)", logins, n)
+	}
+	slots, err := c.FetchCalendar(s6URL)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("FetchCalendar: %v %v", slots, err)
+	}
+	flow := client.NewReservationFlow(c, testProfile, slots[0])
+	flow.CourseSelectURL = courseSelectURL
+	flow.ProfileInputURL = profileInputURL
+	if err := flow.Run(context.Background()); err != nil {
+		t.Fatalf("Run on the restored session: %v", err)
+	}
+	if err := store.Save(c); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// The site forgot the session: fall back to Login
+	srv.ExpireSessions()
+	c = restartClient(t, srv)
+	if resumed, err := c.ResumeSession(store, srv.Username, srv.Password); err != nil || resumed {
+		t.Fatalf("expired: ResumeSession = %v, %v; want a fresh login", resumed, err)
+	}
+	if n := countRequests(srv, "loginAuth"); n != logins+1 {
+		t.Errorf("%d login POSTs, want %d", n, logins+1)
+	}
+	if ok, err := c.SessionValid(); err != nil || !ok {
+		t.Errorf("after fallback login: SessionValid = %v, %v", ok, err)
+	}
+}
+
+func TestSessionJarRoundTrip(t *testing.T) {
+	c, srv := newTestClient(t)
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	store := &client.SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+	if err := store.Save(c); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	c2 := restartClient(t, srv)
+	n, err := store.Restore(c2)
+	if err != nil || n == 0 {
+		t.Fatalf("Restore = %d, %v", n, err)
+	}
+	for _, host := range []string{"https://www.cityheaven.net/", "https://yoyaku.cityheaven.net/"} {
+		if got, want := cookieNames(c2, host), cookieNames(c, host); got != want {
+			t.Errorf("%s: restored cookies %s, want %s", host, got, want)
+		}
+	}
+
+	if _, err := (&client.SessionStore{Path: filepath.Join(t.TempDir(), "none.json")}).Restore(c2); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want not-exist", err)
+	}
+}
+
+// cookieNames lists the cookies the client sends to rawURL, sorted.
+func cookieNames(c *client.LowLatencyClient, rawURL string) string {
+	u, _ := url.Parse(rawURL)
+	var names []string
+	for _, ck := range c.CookieJar().Cookies(u) {
+		names = append(names, ck.Name+"="+ck.Value)
+	}
+	slices.Sort(names)
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotLoggedIn is returned when a logged-in page answers with the login
+// form (or the age gate) instead.
+var ErrNotLoggedIn = errors.New("session is not logged in")
+
+// SessionValid reports whether the www session is logged in by loading the
+// My Page reservation page, which sends logged-out sessions to the login
+// form (ErrSessionExpired).
+func (c *LowLatencyClient) SessionValid() (bool, error) {
+	req, err := http.NewRequest("GET", "https://www.cityheaven.net/tt/community/SBMyReservation/?lo=1&pcmode=sp", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Referer", "https://www.cityheaven.net/tt/community/ABMypageHome/")
+
+	resp, err := c.DoSession(req)
+	if errors.Is(err, ErrSessionExpired) {
+		log.Printf("Session check: logged out (%v)", err)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("session check failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if strings.Contains(resp.Request.URL.Path, "/login/") || strings.Contains(string(body), "loginAuth") ||
+		strings.Contains(string(body), "nenrei=y") {
+		log.Printf("Session check: logged out (landed on %s)", resp.Request.URL.Path)
+		return false, nil
+	}
+	if resp.StatusCode >= 400 {
+		return false, statusError("session check failed", resp)
+	}
+	return true, nil
+}
+
+// Snipe books one slot at a known release moment instead of polling for it.
+// Ahead of the release it logs in, checks the session and reads the girl's
+// calendar, which opens the yoyaku session and warms the connections to both
+// hosts. That is as far as the flow can be prepared: select_course and
+// input_profile only answer once SelectedList and SelectedGirl have locked a
+// slot. At ReleaseAt the flow fires, starting with SelectedList and without
+// timeChangeProposal. ReleaseAt is in server time (see Scheduler.Clock).
+type Snipe struct {
+	Client      *LowLatencyClient
+	Username    string
+	Password    string
+	CalendarURL string // S6 URL of the girl's calendar
+	ReleaseAt   time.Time
+
+	// Lead is how long before ReleaseAt to log in; Warmup is how long before
+	// ReleaseAt to check the session and re-read the calendar once more.
+	Lead   time.Duration
+	Warmup time.Duration
+
+	// ClockSamples calibrates the scheduler against the site after the
+	// login, if there is time for it before the warmup (about a second each).
+	ClockSamples int
+
+	// Flow is run at ReleaseAt.
+	Flow *ReservationFlow
+
+	// Store, if set, is resumed at the login time instead of logging in
+	// afresh (see LowLatencyClient.ResumeSession), and saved after a
+	// re-login.
+	Store *SessionStore
+}
+
+// SnipeResult reports the timing of a Snipe run.
+type SnipeResult struct {
+	Target   time.Time     // ReleaseAt
+	Fired    time.Time     // When the scheduler released the flow (server time)
+	Drift    time.Duration // Fired - Target
+	LoggedIn time.Time     // When the pre-release login finished
+	// Seen is the status of the target slot in the last calendar read before
+	// the release (SlotUnknown if the cell was not listed).
+	Seen SlotStatus
+}
+
+// Run waits for the login time, prepares the session, fires the flow at
+// ReleaseAt and runs it to completion. The result is returned with the
+// flow's error once the flow has fired, and nil before that.
+func (s *Snipe) Run(ctx context.Context) (*SnipeResult, error) {
+	res := &SnipeResult{Target: s.ReleaseAt}
+	slot := s.Flow.Slot
+
+	if err := sleepCtx(ctx, s.Client.Scheduler.Until(s.ReleaseAt.Add(-s.Lead))); err != nil {
+		return nil, err
+	}
+	log.Printf("Snipe: logging in %v before release at %s", s.Client.Scheduler.Until(s.ReleaseAt).Round(time.Second), s.ReleaseAt.Format("15:04:05 MST"))
+	untag := s.Client.TagRequests("Login")
+	err := s.login()
+	untag()
+	if err != nil {
+		return nil, err
+	}
+	res.LoggedIn = s.Client.Scheduler.Now()
+	if err := s.prepare(res, slot); err != nil {
+		return nil, err
+	}
+	if s.ClockSamples > 0 {
+		if s.Client.Scheduler.Until(s.ReleaseAt.Add(-s.Warmup)) > time.Duration(s.ClockSamples)*1500*time.Millisecond {
+			est, err := s.Client.CalibrateClock(ctx, "https://www.cityheaven.net/", s.ClockSamples)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Snipe: server clock %s", est)
+		} else {
+			log.Printf("Snipe: no time to calibrate the clock before the warmup")
+		}
+	}
+
+	if err := sleepCtx(ctx, s.Client.Scheduler.Until(s.ReleaseAt.Add(-s.Warmup))); err != nil {
+		return nil, err
+	}
+	if err := s.prepare(res, slot); err != nil {
+		return nil, err
+	}
+
+	res.Drift = s.Client.Scheduler.SleepUntil(s.ReleaseAt)
+	res.Fired = s.Client.Scheduler.Now()
+	s.Client.Scheduler.LogDrift(res.Drift)
+
+	s.Flow.SkipTimeChange = true
+	return res, s.Flow.Run(ctx)
+}
+
+// login logs in, or resumes Store if one is set.
+func (s *Snipe) login() error {
+	if s.Store == nil {
+		return s.Client.Login(s.Username, s.Password)
+	}
+	resumed, err := s.Client.ResumeSession(s.Store, s.Username, s.Password)
+	if resumed {
+		log.Printf("Snipe: saved session in %s still logged in", s.Store.Path)
+	}
+	return err
+}
+
+// prepare checks the session (logging in again if it has lapsed) and reads
+// the calendar.
+func (s *Snipe) prepare(res *SnipeResult, slot Slot) error {
+	defer s.Client.TagRequests("Prepare")()
+	ok, err := s.Client.SessionValid()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Println("Snipe: session lapsed, logging in again")
+		if err := s.Client.Login(s.Username, s.Password); err != nil {
+			return err
+		}
+		if ok, err = s.Client.SessionValid(); err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotLoggedIn
+		}
+		if s.Store != nil {
+			if err := s.Store.Save(s.Client); err != nil {
+				log.Printf("⚠️  Could not save session: %v", err)
+			}
+		}
+	}
+
+	cal, err := s.Client.FetchCalendarGrid(s.CalendarURL)
+	if err != nil && !errors.Is(err, ErrCalendarLayout) {
+		return fmt.Errorf("snipe: prefetching calendar: %w", err)
+	}
+	res.Seen = SlotUnknown
+	if cal != nil {
+		if cell, found := cal.At(slot.Date, slot.DayTime); found {
+			res.Seen = cell.Status()
+		}
+	}
+	log.Printf("Snipe: session ready, %s currently %s", slot.Key(), res.Seen)
+	return nil
+}
+
+// sleepCtx sleeps for d (returning at once if d <= 0) unless ctx ends first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
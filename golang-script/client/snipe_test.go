@@ -0,0 +1,133 @@
+package client_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+func TestSessionValid(t *testing.T) {
+	c, srv := newTestClient(t)
+	if ok, err := c.SessionValid(); err != nil || ok {
+		t.Fatalf("before login: SessionValid = %v, %v; want false", ok, err)
+	}
+	if err := c.Login(srv.Username, srv.Password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if ok, err := c.SessionValid(); err != nil || !ok {
+		t.Errorf("after login: SessionValid = %v, %v; want true", ok, err)
+	}
+}
+
+func TestSnipeFiresAtRelease(t *testing.T) {
+	c, srv := newTestClient(t)
+	date := time.Now().In(time.FixedZone("JST", 9*60*60)).AddDate(0, 0, 1).Format("2006-01-02")
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: date, Time: "1700", Mark: "×", Flg: "NG"})
+
+	release := time.Now().Add(400 * time.Millisecond)
+	time.AfterFunc(time.Until(release)-30*time.Millisecond, func() {
+		srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: date, Time: "1700", Mark: "○", Flg: "CAN"})
+	})
+
+	flow := client.NewReservationFlow(c, testProfile, client.Slot{Date: date, DayTime: "17:00"})
+	flow.CourseSelectURL = courseSelectURL
+	flow.ProfileInputURL = profileInputURL
+	snipe := &client.Snipe{
+		Client:      c,
+		Username:    srv.Username,
+		Password:    srv.Password,
+		CalendarURL: s6URL,
+		ReleaseAt:   release,
+		Lead:        300 * time.Millisecond,
+		Warmup:      100 * time.Millisecond,
+		Flow:        flow,
+	}
+	res, err := snipe.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if res.Fired.Before(release) || res.Drift < 0 || res.Drift > 50*time.Millisecond {
+		t.Errorf("fired at %v for release %v (drift %v)", res.Fired, release, res.Drift)
+	}
+	if res.Seen != client.SlotFull {
+		t.Errorf("slot seen before release as %s, want Full", res.Seen)
+	}
+	if res.LoggedIn.IsZero() || !res.LoggedIn.Before(release) {
+		t.Errorf("logged in at %v, want before release", res.LoggedIn)
+	}
+	if b := srv.Bookings(); len(b) != 1 || b[0].Time != "1700" {
+		t.Errorf("bookings = %+v", b)
+	}
+
+	// The first request after the calendar prefetch is SelectedList
+	reqs := srv.Requests()
+	last := 0
+	for i, r := range reqs {
+		if strings.Contains(r, "/calendar/niigata") {
+			last = i
+		}
+	}
+	if next := reqs[last+1]; !strings.Contains(next, "/calendar/SelectedList/") {
+		t.Errorf("first request after prefetch = %s, want SelectedList", next)
+	}
+	if n := countRequests(srv, "/timeChangeProposal"); n != 0 {
+		t.Errorf("sent %d timeChangeProposal requests", n)
+	}
+}
+
+func TestSnipeCancelledBeforeLogin(t *testing.T) {
+	c, srv := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	snipe := &client.Snipe{
+		Client:    c,
+		ReleaseAt: time.Now().Add(time.Hour),
+		Lead:      time.Minute,
+		Flow:      client.NewReservationFlow(c, testProfile, client.Slot{}),
+	}
+	if _, err := snipe.Run(ctx); err == nil {
+		t.Fatal("Run: want the context error")
+	}
+	if n := countRequests(srv, "/login/"); n != 0 {
+		t.Errorf("logged in %d times before the lead time", n)
+	}
+}
+
+func TestSnipeResumesStore(t *testing.T) {
+	c, srv := newTestClient(t)
+	store := &client.SessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+	if _, err := c.ResumeSession(store, srv.Username, srv.Password); err != nil {
+		t.Fatalf("ResumeSession: %v", err)
+	}
+	logins := countRequests(srv, "loginAuth")
+
+	c = restartClient(t, srv)
+	slot := client.Slot{Date: time.Now().In(time.FixedZone("JST", 9*60*60)).AddDate(0, 0, 1).Format("2006-01-02"), DayTime: "17:00"}
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: slot.Date, Time: "1700", Mark: "○", Flg: "CAN"})
+	flow := client.NewReservationFlow(c, testProfile, slot)
+	flow.CourseSelectURL = courseSelectURL
+	flow.ProfileInputURL = profileInputURL
+	snipe := &client.Snipe{
+		Client:      c,
+		Username:    srv.Username,
+		Password:    srv.Password,
+		CalendarURL: s6URL,
+		ReleaseAt:   time.Now().Add(200 * time.Millisecond),
+		Lead:        100 * time.Millisecond,
+		Warmup:      50 * time.Millisecond,
+		Flow:        flow,
+		Store:       store,
+	}
+	if _, err := snipe.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if n := countRequests(srv, "loginAuth"); n != logins {
+		t.Errorf("snipe logged in again (%d → %d login POSTs), want the stored session", logins, n)
+	}
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TimeChangeStage selects which page the timeChangeProposal request imitates.
+// The browser sends it from the calendar before SelectedList and from
+// select_vacancy_girl before SelectedGirl, with slightly different payloads.
+type TimeChangeStage int
+
+const (
+	// ProposalCalendar sends day as "2026-02-21(土)" and day_time as "14:00-".
+	ProposalCalendar TimeChangeStage = iota
+	// ProposalGirl sends day as "2026-02-21" and day_time as "14:00".
+	ProposalGirl
+)
+
+// TimeChangeProposal is the parsed reply of POST /timeChangeProposal.
+// Every captured reply was {"result":false,"resultData":null}, i.e. the
+// requested time stands. When result is true the server proposes other start
+// times; the shape of resultData for that case is not captured, so
+// Alternatives is collected leniently from any date/time values found in it.
+type TimeChangeProposal struct {
+	Changed      bool            // "result": the requested time is not bookable as-is
+	Alternatives []Slot          // Proposed start times, in the order returned
+	Raw          json.RawMessage // resultData as received
+}
+
+// TimeChangeError is returned when the requested start time is gone and none
+// of the proposed alternatives lies within the accepted window.
+type TimeChangeError struct {
+	Requested    Slot
+	Alternatives []Slot
+	Window       time.Duration
+}
+
+// Is makes a TimeChangeError match ErrSlotTaken.
+func (e *TimeChangeError) Is(target error) bool {
+	return target == ErrSlotTaken
+}
+
+func (e *TimeChangeError) Error() string {
+	if len(e.Alternatives) == 0 {
+		return fmt.Sprintf("slot %s %s is no longer available and no alternative time was proposed", e.Requested.Date, e.Requested.DayTime)
+	}
+	var times []string
+	for _, s := range e.Alternatives {
+		times = append(times, s.Date+" "+s.DayTime)
+	}
+	return fmt.Sprintf("slot %s %s is no longer available; proposed %s, none within ±%v",
+		e.Requested.Date, e.Requested.DayTime, strings.Join(times, ", "), e.Window)
+}
+
+// TimeChangeProposal asks the server whether the start time is still bookable
+// and returns any alternative times it proposes. girlID may be "" for the
+// shop-wide calendar.
+func (c *LowLatencyClient) TimeChangeProposal(ctx context.Context, stage TimeChangeStage, areaPath, shopDir, girlID, day, dayTime string) (*TimeChangeProposal, error) {
+	endpoint := "https://yoyaku.cityheaven.net/timeChangeProposal"
+
+	payload := map[string]string{
+		"girl_id":  girlID,
+		"day":      day,
+		"day_time": dayTime,
+	}
+	referer := fmt.Sprintf("https://yoyaku.cityheaven.net/select_vacancy_girl/%s/%s", areaPath, shopDir)
+	if stage == ProposalCalendar {
+		payload["day"] = fmt.Sprintf("%s(%s)", day, dayOfWeekJP(day))
+		payload["day_time"] = dayTime + "-"
+		referer = fmt.Sprintf("https://yoyaku.cityheaven.net/calendar/%s/%s/1/", areaPath, shopDir)
+	}
+	jsonBytes, _ := json.Marshal(payload)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(string(jsonBytes)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	req.Header.Set("Referer", referer)
+	req.Header.Set("Origin", "https://yoyaku.cityheaven.net")
+
+	resp, err := c.DoSession(req)
+	if err != nil {
+		return nil, fmt.Errorf("timeChangeProposal POST failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	log.Printf("timeChangeProposal Response (status %s): %s", resp.Status, string(bodyBytes))
+
+	if resp.StatusCode >= 400 {
+		return nil, statusError("timeChangeProposal failed", resp)
+	}
+
+	var raw struct {
+		Result     bool            `json:"result"`
+		ResultData json.RawMessage `json:"resultData"`
+	}
+	if err := json.Unmarshal(bodyBytes, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse timeChangeProposal response: %w", err)
+	}
+
+	p := &TimeChangeProposal{Changed: raw.Result, Raw: raw.ResultData}
+	if raw.Result && len(raw.ResultData) > 0 {
+		var data interface{}
+		if err := json.Unmarshal(raw.ResultData, &data); err == nil {
+			p.Alternatives = collectProposedSlots(data, day)
+		}
+	}
+	return p, nil
+}
+
+var (
+	proposalDate = regexp.MustCompile(`^(\d{4})[-/](\d{2})[-/](\d{2})`)
+	proposalTime = regexp.MustCompile(`^(\d{1,2}):?(\d{2})-?$`)
+)
+
+// collectProposedSlots walks resultData and returns every start time it
+// finds: objects carrying day/date and day_time/time keys, or bare "14:30" /
+// "1430" strings (taken to be on defaultDay). Duplicates are dropped.
+func collectProposedSlots(v interface{}, defaultDay string) []Slot {
+	var slots []Slot
+	add := func(date, hhmm string) {
+		s := newSlot(date, hhmm)
+		if !slices.ContainsFunc(slots, func(o Slot) bool { return o.Key() == s.Key() }) {
+			slots = append(slots, s)
+		}
+	}
+
+	var walk func(v interface{}, day string)
+	walk = func(v interface{}, day string) {
+		switch v := v.(type) {
+		case string:
+			if hhmm, ok := normalizeProposalTime(v); ok {
+				add(day, hhmm)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e, day)
+			}
+		case map[string]interface{}:
+			for _, k := range []string{"day", "date"} {
+				if s, ok := v[k].(string); ok {
+					if m := proposalDate.FindStringSubmatch(s); m != nil {
+						day = m[1] + "-" + m[2] + "-" + m[3]
+					}
+				}
+			}
+			found := false
+			for _, k := range []string{"day_time", "time", "start_time"} {
+				if s, ok := v[k].(string); ok {
+					if hhmm, ok := normalizeProposalTime(s); ok {
+						add(day, hhmm)
+						found = true
+					}
+				}
+			}
+			if !found {
+				keys := make([]string, 0, len(v))
+				for k := range v {
+					keys = append(keys, k)
+				}
+				slices.Sort(keys)
+				for _, k := range keys {
+					walk(v[k], day)
+				}
+			}
+		}
+	}
+	walk(v, defaultDay)
+	return slots
+}
+
+// normalizeProposalTime turns "14:30", "14:30-" or "1430" into "14:30".
+func normalizeProposalTime(s string) (string, bool) {
+	m := proposalTime.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return "", false
+	}
+	hour := m[1]
+	if len(hour) == 1 {
+		hour = "0" + hour
+	}
+	return hour + ":" + m[2], true
+}
+
+// NearestProposal returns the alternative closest to requested that is at
+// most window away (earlier wins a tie), or false if there is none. The
+// requested time itself is never returned.
+func NearestProposal(requested Slot, alternatives []Slot, window time.Duration) (Slot, bool) {
+	want, err := slotTime(requested)
+	if err != nil {
+		return Slot{}, false
+	}
+	var best Slot
+	var bestTime time.Time
+	bestDiff := time.Duration(-1)
+	for _, alt := range alternatives {
+		t, err := slotTime(alt)
+		if err != nil || alt.Key() == requested.Key() {
+			continue
+		}
+		diff := t.Sub(want)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > window {
+			continue
+		}
+		if bestDiff < 0 || diff < bestDiff || (diff == bestDiff && t.Before(bestTime)) {
+			best, bestTime, bestDiff = alt, t, diff
+		}
+	}
+	return best, bestDiff >= 0
+}
+
+func slotTime(s Slot) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04", s.Date+" "+s.DayTime, jst)
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrWaitlistRejected is returned by SelectWaitlistSlot when SelectedList
+// answers "false", e.g. because the slot is no longer full or the shop does
+// not take cancellation notifications for it.
+var ErrWaitlistRejected = errors.New("waitlist registration rejected")
+
+// WaitlistRegistration is a cancellation notification (キャンセル待ち通知) the
+// bot registered. The site mails the account when the slot frees up; it does
+// not book it.
+type WaitlistRegistration struct {
+	ShopID       string    `json:"shop_id"`
+	GirlID       string    `json:"girl_id"`
+	GirlName     string    `json:"girl_name,omitempty"`
+	Date         string    `json:"date"` // e.g. "2026-02-21"
+	Time         string    `json:"time"` // e.g. "14:00"
+	DryRun       bool      `json:"dry_run"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// NewWaitlistRegistration records the receipt of a flow run with Waitlist set.
+func NewWaitlistRegistration(shopID string, r *BookingReceipt) WaitlistRegistration {
+	return WaitlistRegistration{
+		ShopID:       shopID,
+		GirlID:       r.GirlID,
+		GirlName:     r.GirlName,
+		Date:         r.Date,
+		Time:         r.Time,
+		DryRun:       r.DryRun,
+		RegisteredAt: r.ConfirmedAt,
+	}
+}
+
+// Key returns "date time", as Slot.Key does.
+func (w WaitlistRegistration) Key() string {
+	return w.Date + " " + w.Time
+}
+
+// Start returns the slot's start time in JST.
+func (w WaitlistRegistration) Start() time.Time {
+	return newSlot(w.Date, w.Time).Start
+}
+
+// WaitlistRegistrations are the registrations recorded in the waitlist file.
+type WaitlistRegistrations []WaitlistRegistration
+
+// Active returns the registrations whose slot has not started yet.
+func (ws WaitlistRegistrations) Active(now time.Time) WaitlistRegistrations {
+	var out WaitlistRegistrations
+	for _, w := range ws {
+		if w.Start().After(now) {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// Holds reports whether a registration exists for the slot's girl and time.
+func (ws WaitlistRegistrations) Holds(s Slot) bool {
+	return slices.ContainsFunc(ws, func(w WaitlistRegistration) bool {
+		return w.GirlID == s.GirlID && w.Key() == s.Key()
+	})
+}
+
+// Waitlist reports whether the My Page entry is a cancellation notification
+// rather than a booking.
+func (r Reservation) Waitlist() bool {
+	return strings.Contains(r.Status, "キャンセル待ち")
+}
+
+// AppendWaitlistRegistration writes the registration as a JSON line to the
+// specified file, created 0600 like the receipts file.
+func AppendWaitlistRegistration(w WaitlistRegistration, filename string) error {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// LoadWaitlistRegistrations reads a file written by
+// AppendWaitlistRegistration. A missing file holds no registrations.
+func LoadWaitlistRegistrations(filename string) (WaitlistRegistrations, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out WaitlistRegistrations
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var w WaitlistRegistration
+		if err := json.Unmarshal(sc.Bytes(), &w); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", filename, line, err)
+		}
+		out = append(out, w)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,108 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/mockserver"
+)
+
+func TestWaitlistRegistration(t *testing.T) {
+	c, srv := newTestClient(t)
+	open := newFlow(t, c, srv).Slot
+	srv.SetSlot(testGirlID, mockserver.CalendarSlot{Date: open.Date, Time: "1800", Mark: "△", Flg: "NG"})
+
+	cal, err := c.FetchCalendarGrid(s6URL)
+	if err != nil {
+		t.Fatalf("FetchCalendarGrid: %v", err)
+	}
+	full := client.SlotPreferences{}.RankWaitlist(cal.Slots)
+	if got := keys(full); got != open.Date+" 18:00" {
+		t.Fatalf("waitlist candidates = %s", got)
+	}
+
+	f := client.NewReservationFlow(c, testProfile, full[0])
+	f.CourseSelectURL = courseSelectURL
+	f.ProfileInputURL = profileInputURL
+	f.Waitlist = true
+	if err := f.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if r := f.Receipt(); !r.Waitlist || r.Time != "18:00" {
+		t.Errorf("receipt = %+v", r)
+	}
+	if n := countRequests(srv, "/timeChangeProposal"); n != 0 {
+		t.Errorf("sent %d timeChangeProposal requests for a waitlist registration", n)
+	}
+	if w := srv.Waitlist(); len(w) != 1 || w[0].Time != "1800" {
+		t.Errorf("waitlist = %+v", w)
+	}
+	if b := srv.Bookings(); len(b) != 0 {
+		t.Errorf("bookings = %+v, want none", b)
+	}
+
+	existing, err := c.CheckReservations()
+	if err != nil {
+		t.Fatalf("CheckReservations: %v", err)
+	}
+	if len(existing) != 1 || !existing[0].Waitlist() {
+		t.Errorf("reservations = %+v, want one waitlist entry", existing)
+	}
+
+	// Registering the same slot again trips the site's duplicate check
+	again := client.NewReservationFlow(c, testProfile, full[0])
+	again.CourseSelectURL = courseSelectURL
+	again.ProfileInputURL = profileInputURL
+	again.Waitlist = true
+	var dup *client.DuplicateReservationError
+	if err := again.Run(context.Background()); !errors.As(err, &dup) || dup.Kind != client.DuplicateCancelWait {
+		t.Errorf("second registration: got %v, want cancel-wait duplicate", err)
+	}
+}
+
+func TestWaitlistRejectedOnOpenSlot(t *testing.T) {
+	c, srv := newTestClient(t)
+	f := newFlow(t, c, srv)
+	f.Waitlist = true
+	err := f.Run(context.Background())
+	if !errors.Is(err, client.ErrWaitlistRejected) {
+		t.Fatalf("Run: got %v, want ErrWaitlistRejected", err)
+	}
+	if f.State() != client.StateFailed {
+		t.Errorf("state = %s, want Failed", f.State())
+	}
+}
+
+func TestWaitlistRegistrationsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "waitlist.jsonl")
+	if regs, err := client.LoadWaitlistRegistrations(file); err != nil || len(regs) != 0 {
+		t.Fatalf("missing file: %v %v", regs, err)
+	}
+
+	past := client.WaitlistRegistration{ShopID: "1", GirlID: "7", Date: "2020-01-04", Time: "14:00"}
+	future := client.WaitlistRegistration{ShopID: "1", GirlID: "7", Date: "2099-01-03", Time: "18:00"}
+	for _, w := range []client.WaitlistRegistration{past, future} {
+		if err := client.AppendWaitlistRegistration(w, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	regs, err := client.LoadWaitlistRegistrations(file)
+	if err != nil || len(regs) != 2 {
+		t.Fatalf("LoadWaitlistRegistrations = %v, %v", regs, err)
+	}
+	active := regs.Active(time.Now())
+	if len(active) != 1 || active[0].Key() != future.Key() {
+		t.Errorf("active = %+v", active)
+	}
+	if !regs.Holds(client.Slot{GirlID: "7", Date: "2099-01-03", DayTime: "18:00"}) {
+		t.Error("Holds: want the registered slot")
+	}
+	if regs.Holds(client.Slot{GirlID: "8", Date: "2099-01-03", DayTime: "18:00"}) {
+		t.Error("Holds: another girl's slot is not held")
+	}
+}
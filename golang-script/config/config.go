@@ -0,0 +1,474 @@
+// Package config loads the run configuration (target shop, girl, course and
+// polling behaviour) shared by main.go and the debug_* tools.
+//
+// The configuration is read from a YAML or JSON file, then selected fields can
+// be overridden from the environment (see applyEnv). All yoyaku/www URLs are
+// derived from the shop's area path and directory, so switching shops only
+// requires editing the file.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the configuration file used when none is specified.
+const DefaultPath = "config.yaml"
+
+const (
+	WWWBase    = "https://www.cityheaven.net"
+	YoyakuBase = "https://yoyaku.cityheaven.net"
+)
+
+// Duration wraps time.Duration so it can be written as "2s" or "1500ms"
+// in both YAML and JSON files.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a Go duration string.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalText formats the duration as a Go duration string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Shop identifies the target shop on City Heaven.
+type Shop struct {
+	ID       string `yaml:"id" json:"id"`               // e.g. "2310001233"
+	AreaPath string `yaml:"area_path" json:"area_path"` // e.g. "niigata/A1501/A150101"
+	Dir      string `yaml:"dir" json:"dir"`             // e.g. "arabiannight"
+}
+
+// Target selects what to book within the shop.
+type Target struct {
+	GirlID   string `yaml:"girl_id" json:"girl_id"` // Optional priority girl
+	CourseID string `yaml:"course_id" json:"course_id"`
+	// OptionIDs are ticked on the select_option page (extensions, nomination
+	// fees) for shops that show one.
+	OptionIDs []string `yaml:"option_ids" json:"option_ids"`
+	// AcceptTerms agrees to the shop's terms page when it asks for it.
+	AcceptTerms bool `yaml:"accept_terms" json:"accept_terms"`
+	// TimeChangeWindow accepts a start time proposed by timeChangeProposal
+	// when the chosen one is gone, if it is at most this far away. 0 disables.
+	TimeChangeWindow Duration `yaml:"time_change_window" json:"time_change_window"`
+}
+
+// Preferences rank the available slots; the bot tries them in that order.
+// Girls, days and windows only reorder; earliest/latest drop slots outside
+// the bounds (latest applies to the end of a course_minutes long course).
+type Preferences struct {
+	Girls         []string `yaml:"girls" json:"girls"`     // Girl IDs in priority order
+	Days          []string `yaml:"days" json:"days"`       // e.g. ["sat", "sun"]
+	Windows       []string `yaml:"windows" json:"windows"` // e.g. ["13:00-18:00"]
+	Earliest      string   `yaml:"earliest" json:"earliest"`
+	Latest        string   `yaml:"latest" json:"latest"`
+	CourseMinutes int      `yaml:"course_minutes" json:"course_minutes"`
+	// MaxCandidates caps how many slots are tried per calendar (0 = all).
+	MaxCandidates int `yaml:"max_candidates" json:"max_candidates"`
+}
+
+// Weekdays returns Days as time.Weekday values. Call after Validate.
+func (p Preferences) Weekdays() []time.Weekday {
+	var out []time.Weekday
+	for _, d := range p.Days {
+		if wd, ok := weekdays[strings.ToLower(d)]; ok {
+			out = append(out, wd)
+		}
+	}
+	return out
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Waitlist opts into the site's cancellation notification (キャンセル待ち通知)
+// for full (△) slots, ranked by the preferences, when a calendar has nothing
+// bookable. Registrations are recorded locally and reported at startup.
+type Waitlist struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// MaxRegistrations caps the notifications held at once (0 = no cap).
+	MaxRegistrations int `yaml:"max_registrations" json:"max_registrations"`
+}
+
+// Snipe books target.girl_id's Date/Time slot at a known release moment
+// instead of polling. ReleaseAt is JST, "2006-01-02 15:04:05" (seconds
+// optional); left empty, the release predicted from history is used.
+type Snipe struct {
+	Enabled   bool   `yaml:"enabled" json:"enabled"`
+	Date      string `yaml:"date" json:"date"` // e.g. "2026-02-21"
+	Time      string `yaml:"time" json:"time"` // e.g. "14:00"
+	ReleaseAt string `yaml:"release_at" json:"release_at"`
+	// Lead is how long before the release to log in; Warmup is when to check
+	// the session and re-read the calendar one last time.
+	Lead   Duration `yaml:"lead" json:"lead"`
+	Warmup Duration `yaml:"warmup" json:"warmup"`
+}
+
+var jst = time.FixedZone("JST", 9*60*60)
+
+// ReleaseTime parses ReleaseAt in JST. It returns the zero time for "".
+func (s Snipe) ReleaseTime() (time.Time, error) {
+	if s.ReleaseAt == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s.ReleaseAt, jst); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("snipe.release_at %q must look like \"2026-02-14 10:00:00\"", s.ReleaseAt)
+}
+
+// Clock calibrates the scheduler against the site's clock. Date headers of
+// every response are used as they come; at startup CalibrationSamples extra
+// requests narrow the offset, and SNTPServer (host:port), when set, adds an
+// NTP reading.
+type Clock struct {
+	SNTPServer         string `yaml:"sntp_server" json:"sntp_server"` // e.g. "ntp.nict.jp:123"
+	CalibrationSamples int    `yaml:"calibration_samples" json:"calibration_samples"`
+}
+
+// Metrics exposes Prometheus metrics at http://Listen/metrics when Listen
+// (host:port, e.g. ":9100") is set.
+type Metrics struct {
+	Listen string `yaml:"listen" json:"listen"`
+}
+
+// Polling controls the availability polling loop.
+type Polling struct {
+	Interval Duration `yaml:"interval" json:"interval"`
+}
+
+// Config is the full run configuration.
+type Config struct {
+	Shop        Shop        `yaml:"shop" json:"shop"`
+	Target      Target      `yaml:"target" json:"target"`
+	Preferences Preferences `yaml:"preferences" json:"preferences"`
+	Waitlist    Waitlist    `yaml:"waitlist" json:"waitlist"`
+	Snipe       Snipe       `yaml:"snipe" json:"snipe"`
+	Clock       Clock       `yaml:"clock" json:"clock"`
+	Metrics     Metrics     `yaml:"metrics" json:"metrics"`
+	Polling     Polling     `yaml:"polling" json:"polling"`
+	DryRun      bool        `yaml:"dry_run" json:"dry_run"`
+}
+
+// Default returns a Config with safe defaults (dry run, 2s polling).
+func Default() *Config {
+	return &Config{
+		Polling: Polling{Interval: Duration{2000 * time.Millisecond}},
+		Snipe:   Snipe{Lead: Duration{2 * time.Minute}, Warmup: Duration{10 * time.Second}},
+		Clock:   Clock{CalibrationSamples: 5},
+		DryRun:  true,
+	}
+}
+
+// Load reads the configuration file at path, applies environment overrides
+// and validates the result. The format is chosen by file extension
+// (.yaml/.yml or .json).
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("config: failed to parse %s: %w", path, err)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("config: failed to parse %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("config: unsupported file extension %q (use .yaml, .yml or .json)", filepath.Ext(path))
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides file values with CH_* environment variables when set.
+func (c *Config) applyEnv() error {
+	strVars := map[string]*string{
+		"CH_SHOP_ID":   &c.Shop.ID,
+		"CH_AREA_PATH": &c.Shop.AreaPath,
+		"CH_SHOP_DIR":  &c.Shop.Dir,
+		"CH_GIRL_ID":   &c.Target.GirlID,
+		"CH_COURSE_ID": &c.Target.CourseID,
+
+		"CH_PREF_EARLIEST": &c.Preferences.Earliest,
+		"CH_PREF_LATEST":   &c.Preferences.Latest,
+
+		"CH_SNIPE_DATE":       &c.Snipe.Date,
+		"CH_SNIPE_TIME":       &c.Snipe.Time,
+		"CH_SNIPE_RELEASE_AT": &c.Snipe.ReleaseAt,
+		"CH_SNTP_SERVER":      &c.Clock.SNTPServer,
+		"CH_METRICS_LISTEN":   &c.Metrics.Listen,
+	}
+	for key, dst := range strVars {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = strings.TrimSpace(v)
+		}
+	}
+
+	if v, ok := os.LookupEnv("CH_POLL_INTERVAL"); ok {
+		if err := c.Polling.Interval.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: invalid CH_POLL_INTERVAL %q: %w", v, err)
+		}
+	}
+	listVars := map[string]*[]string{
+		"CH_OPTION_IDS":   &c.Target.OptionIDs,
+		"CH_PREF_GIRLS":   &c.Preferences.Girls,
+		"CH_PREF_DAYS":    &c.Preferences.Days,
+		"CH_PREF_WINDOWS": &c.Preferences.Windows,
+	}
+	for name, dst := range listVars {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*dst = append(*dst, item)
+				}
+			}
+		}
+	}
+	intVars := map[string]*int{
+		"CH_PREF_COURSE_MINUTES": &c.Preferences.CourseMinutes,
+		"CH_MAX_CANDIDATES":      &c.Preferences.MaxCandidates,
+		"CH_WAITLIST_MAX":        &c.Waitlist.MaxRegistrations,
+		"CH_CLOCK_SAMPLES":       &c.Clock.CalibrationSamples,
+	}
+	for name, dst := range intVars {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return fmt.Errorf("config: invalid %s %q: %w", name, v, err)
+			}
+			*dst = n
+		}
+	}
+	if v, ok := os.LookupEnv("CH_ACCEPT_TERMS"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid CH_ACCEPT_TERMS %q: %w", v, err)
+		}
+		c.Target.AcceptTerms = b
+	}
+	if v, ok := os.LookupEnv("CH_WAITLIST"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid CH_WAITLIST %q: %w", v, err)
+		}
+		c.Waitlist.Enabled = b
+	}
+	if v, ok := os.LookupEnv("CH_SNIPE"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid CH_SNIPE %q: %w", v, err)
+		}
+		c.Snipe.Enabled = b
+	}
+	if v, ok := os.LookupEnv("CH_TIME_CHANGE_WINDOW"); ok {
+		if err := c.Target.TimeChangeWindow.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("config: invalid CH_TIME_CHANGE_WINDOW %q: %w", v, err)
+		}
+	}
+	if v, ok := os.LookupEnv("CH_DRY_RUN"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid CH_DRY_RUN %q: %w", v, err)
+		}
+		c.DryRun = b
+	}
+	return nil
+}
+
+var (
+	numericRe  = regexp.MustCompile(`^\d+$`)
+	areaPathRe = regexp.MustCompile(`^[a-z]+/A\d{4}/A\d{6}$`)
+	shopDirRe  = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	dateRe     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	clockRe    = regexp.MustCompile(`^([01]?\d|2[0-9]):[0-5]\d$`)
+	windowRe   = regexp.MustCompile(`^\s*([01]?\d|2[0-9]):[0-5]\d\s*-\s*([01]?\d|2[0-9]):[0-5]\d\s*$`)
+)
+
+// MinPollInterval is the lowest polling interval accepted, to avoid IP bans.
+const MinPollInterval = 500 * time.Millisecond
+
+// Validate checks every field and reports all problems at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch {
+	case c.Shop.ID == "":
+		errs = append(errs, errors.New("shop.id is required"))
+	case !numericRe.MatchString(c.Shop.ID):
+		errs = append(errs, fmt.Errorf("shop.id %q must be numeric", c.Shop.ID))
+	}
+
+	switch {
+	case c.Shop.AreaPath == "":
+		errs = append(errs, errors.New("shop.area_path is required"))
+	case !areaPathRe.MatchString(c.Shop.AreaPath):
+		errs = append(errs, fmt.Errorf("shop.area_path %q must look like \"niigata/A1501/A150101\"", c.Shop.AreaPath))
+	}
+
+	switch {
+	case c.Shop.Dir == "":
+		errs = append(errs, errors.New("shop.dir is required"))
+	case !shopDirRe.MatchString(c.Shop.Dir):
+		errs = append(errs, fmt.Errorf("shop.dir %q must not contain slashes or spaces", c.Shop.Dir))
+	}
+
+	if c.Target.GirlID != "" && !numericRe.MatchString(c.Target.GirlID) {
+		errs = append(errs, fmt.Errorf("target.girl_id %q must be numeric", c.Target.GirlID))
+	}
+
+	switch {
+	case c.Target.CourseID == "":
+		errs = append(errs, errors.New("target.course_id is required"))
+	case !numericRe.MatchString(c.Target.CourseID):
+		errs = append(errs, fmt.Errorf("target.course_id %q must be numeric", c.Target.CourseID))
+	}
+
+	for _, id := range c.Target.OptionIDs {
+		if !numericRe.MatchString(id) {
+			errs = append(errs, fmt.Errorf("target.option_ids entry %q must be numeric", id))
+		}
+	}
+
+	if c.Target.TimeChangeWindow.Duration < 0 {
+		errs = append(errs, fmt.Errorf("target.time_change_window %v must not be negative", c.Target.TimeChangeWindow.Duration))
+	}
+
+	for _, id := range c.Preferences.Girls {
+		if !numericRe.MatchString(id) {
+			errs = append(errs, fmt.Errorf("preferences.girls entry %q must be numeric", id))
+		}
+	}
+	for _, d := range c.Preferences.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			errs = append(errs, fmt.Errorf("preferences.days entry %q must be one of sun, mon, tue, wed, thu, fri, sat", d))
+		}
+	}
+	for _, w := range c.Preferences.Windows {
+		if !windowRe.MatchString(w) {
+			errs = append(errs, fmt.Errorf("preferences.windows entry %q must look like \"13:00-18:00\"", w))
+		}
+	}
+	for name, v := range map[string]string{"earliest": c.Preferences.Earliest, "latest": c.Preferences.Latest} {
+		if v != "" && !clockRe.MatchString(v) {
+			errs = append(errs, fmt.Errorf("preferences.%s %q must be HH:MM", name, v))
+		}
+	}
+	if c.Preferences.CourseMinutes < 0 || c.Preferences.MaxCandidates < 0 {
+		errs = append(errs, errors.New("preferences.course_minutes and preferences.max_candidates must not be negative"))
+	}
+
+	if c.Waitlist.MaxRegistrations < 0 {
+		errs = append(errs, fmt.Errorf("waitlist.max_registrations %d must not be negative", c.Waitlist.MaxRegistrations))
+	}
+
+	if c.Snipe.Enabled {
+		if c.Target.GirlID == "" {
+			errs = append(errs, errors.New("snipe mode needs target.girl_id"))
+		}
+		if !dateRe.MatchString(c.Snipe.Date) {
+			errs = append(errs, fmt.Errorf("snipe.date %q must look like \"2026-02-21\"", c.Snipe.Date))
+		}
+		if !clockRe.MatchString(c.Snipe.Time) {
+			errs = append(errs, fmt.Errorf("snipe.time %q must be HH:MM", c.Snipe.Time))
+		}
+		if _, err := c.Snipe.ReleaseTime(); err != nil {
+			errs = append(errs, err)
+		}
+		if c.Snipe.Lead.Duration < c.Snipe.Warmup.Duration || c.Snipe.Warmup.Duration < 0 {
+			errs = append(errs, fmt.Errorf("snipe.lead %v must be at least snipe.warmup %v (and neither negative)", c.Snipe.Lead.Duration, c.Snipe.Warmup.Duration))
+		}
+	}
+
+	if c.Clock.SNTPServer != "" {
+		if _, _, err := net.SplitHostPort(c.Clock.SNTPServer); err != nil {
+			errs = append(errs, fmt.Errorf("clock.sntp_server %q must be host:port", c.Clock.SNTPServer))
+		}
+	}
+	if c.Clock.CalibrationSamples < 0 || c.Clock.CalibrationSamples > 20 {
+		errs = append(errs, fmt.Errorf("clock.calibration_samples %d must be between 0 and 20", c.Clock.CalibrationSamples))
+	}
+
+	if c.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("metrics.listen %q must be host:port (e.g. \":9100\")", c.Metrics.Listen))
+		}
+	}
+
+	if c.Polling.Interval.Duration < MinPollInterval {
+		errs = append(errs, fmt.Errorf("polling.interval %v is below the minimum of %v", c.Polling.Interval.Duration, MinPollInterval))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// ShopURL returns the shop's top page on www, e.g.
+// https://www.cityheaven.net/niigata/A1501/A150101/arabiannight/
+func (c *Config) ShopURL() string {
+	return fmt.Sprintf("%s/%s/%s/", WWWBase, c.Shop.AreaPath, c.Shop.Dir)
+}
+
+// CalendarURL returns the S6 URL for a girl's calendar. It redirects to the
+// yoyaku calendar and returns two weeks of data, so one call per girl is enough.
+func (c *Config) CalendarURL(girlID string) string {
+	return fmt.Sprintf("%sS6ShareToReservationLogin/?forward=F1&girl_id=%s&pcmode=sp", c.ShopURL(), girlID)
+}
+
+// yoyakuURL builds a yoyaku.cityheaven.net URL for the given flow page.
+func (c *Config) yoyakuURL(page string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", YoyakuBase, page, c.Shop.AreaPath, c.Shop.Dir)
+}
+
+// CourseSelectURL returns the select_course page URL.
+func (c *Config) CourseSelectURL() string {
+	return c.yoyakuURL("select_course")
+}
+
+// ProfileInputURL returns the input_profile page URL.
+func (c *Config) ProfileInputURL() string {
+	return c.yoyakuURL("input_profile")
+}
+
+// ConfirmURL returns the confirm page URL.
+func (c *Config) ConfirmURL() string {
+	return c.yoyakuURL("confirm")
+}
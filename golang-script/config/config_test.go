@@ -0,0 +1,190 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"booker-bot/config"
+)
+
+const minimalYAML = `
+shop:
+  id: "2310001233"
+  area_path: "niigata/A1501/A150101"
+  dir: "arabiannight"
+target:
+  course_id: "253139"
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string // "" for success
+	}{
+		{name: "yaml", file: "config.yaml", content: minimalYAML},
+		{name: "yml", file: "config.yml", content: minimalYAML},
+		{name: "json", file: "config.json", content: `{"shop": {"id": "2310001233", "area_path": "niigata/A1501/A150101", "dir": "arabiannight"},
+			"target": {"course_id": "253139"}}`},
+		{name: "unsupported extension", file: "config.toml", content: minimalYAML, wantErr: "unsupported file extension"},
+		{name: "malformed", file: "config.yaml", content: "shop: [", wantErr: "failed to parse"},
+		{name: "bad duration", file: "config.yaml", content: minimalYAML + "polling:\n  interval: soon\n", wantErr: "failed to parse"},
+		{name: "invalid", file: "config.yaml", content: "shop:\n  id: abc\n", wantErr: "invalid configuration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Load(writeConfig(t, tt.file, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			// Unset fields keep the defaults
+			if cfg.Shop.ID != "2310001233" || cfg.Target.CourseID != "253139" || !cfg.DryRun ||
+				cfg.Polling.Interval.Duration != 2*time.Second || cfg.Snipe.Lead.Duration != 2*time.Minute {
+				t.Errorf("loaded %+v", cfg)
+			}
+		})
+	}
+
+	if _, err := config.Load(filepath.Join(t.TempDir(), "none.yaml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want not exist", err)
+	}
+	if _, err := config.Load(filepath.Join("..", config.DefaultPath)); err != nil {
+		t.Errorf("the shipped %s does not load: %v", config.DefaultPath, err)
+	}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(*config.Config) bool
+		wantErr string
+	}{
+		{name: "strings trimmed", env: map[string]string{"CH_GIRL_ID": " 52809022 ", "CH_SHOP_DIR": "other"},
+			check: func(c *config.Config) bool { return c.Target.GirlID == "52809022" && c.Shop.Dir == "other" }},
+		{name: "lists", env: map[string]string{"CH_PREF_DAYS": "sat, sun,", "CH_OPTION_IDS": ""},
+			check: func(c *config.Config) bool {
+				return slices.Equal(c.Preferences.Days, []string{"sat", "sun"}) && c.Target.OptionIDs == nil
+			}},
+		{name: "ints", env: map[string]string{"CH_MAX_CANDIDATES": "5", "CH_CLOCK_SAMPLES": " 0"},
+			check: func(c *config.Config) bool {
+				return c.Preferences.MaxCandidates == 5 && c.Clock.CalibrationSamples == 0
+			}},
+		{name: "bools", env: map[string]string{"CH_DRY_RUN": "false", "CH_ACCEPT_TERMS": "1", "CH_WAITLIST": "true"},
+			check: func(c *config.Config) bool { return !c.DryRun && c.Target.AcceptTerms && c.Waitlist.Enabled }},
+		{name: "durations", env: map[string]string{"CH_POLL_INTERVAL": "750ms", "CH_TIME_CHANGE_WINDOW": "30m"},
+			check: func(c *config.Config) bool {
+				return c.Polling.Interval.Duration == 750*time.Millisecond && c.Target.TimeChangeWindow.Duration == 30*time.Minute
+			}},
+		{name: "bad int", env: map[string]string{"CH_WAITLIST_MAX": "three"}, wantErr: "invalid CH_WAITLIST_MAX"},
+		{name: "bad bool", env: map[string]string{"CH_DRY_RUN": "maybe"}, wantErr: "invalid CH_DRY_RUN"},
+		{name: "bad duration", env: map[string]string{"CH_POLL_INTERVAL": "2"}, wantErr: "invalid CH_POLL_INTERVAL"},
+		{name: "validated after override", env: map[string]string{"CH_POLL_INTERVAL": "100ms"}, wantErr: "below the minimum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := config.Load(writeConfig(t, "config.yaml", minimalYAML))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("overrides %v not applied: %+v", tt.env, cfg)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *config.Config {
+		c := config.Default()
+		c.Shop = config.Shop{ID: "2310001233", AreaPath: "niigata/A1501/A150101", Dir: "arabiannight"}
+		c.Target.CourseID = "253139"
+		return c
+	}
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+		want   []string // Substrings of the error; none for a valid config
+	}{
+		{name: "valid", modify: func(c *config.Config) {}},
+		{name: "everything missing", modify: func(c *config.Config) { *c = *config.Default() },
+			want: []string{"shop.id is required", "shop.area_path is required", "shop.dir is required", "target.course_id is required"}},
+		{name: "malformed shop", modify: func(c *config.Config) {
+			c.Shop = config.Shop{ID: "12a", AreaPath: "niigata", Dir: "a/b"}
+		}, want: []string{"shop.id", "shop.area_path", "shop.dir"}},
+		{name: "preferences", modify: func(c *config.Config) {
+			c.Preferences.Days = []string{"sat", "someday"}
+			c.Preferences.Windows = []string{"13:00-18:00", "afternoon"}
+			c.Preferences.Latest = "7pm"
+		}, want: []string{`"someday"`, `"afternoon"`, "preferences.latest"}},
+		{name: "late windows allowed", modify: func(c *config.Config) {
+			c.Preferences.Windows = []string{"22:00-25:30"}
+			c.Preferences.Latest = "25:00"
+		}},
+		{name: "snipe needs a girl and a slot", modify: func(c *config.Config) { c.Snipe.Enabled = true },
+			want: []string{"target.girl_id", "snipe.date", "snipe.time"}},
+		{name: "snipe lead below warmup", modify: func(c *config.Config) {
+			c.Target.GirlID = "52809022"
+			c.Snipe = config.Snipe{Enabled: true, Date: "2026-02-21", Time: "14:00",
+				Lead: config.Duration{Duration: time.Second}, Warmup: config.Duration{Duration: 10 * time.Second}}
+		}, want: []string{"snipe.lead"}},
+		{name: "addresses", modify: func(c *config.Config) {
+			c.Clock.SNTPServer = "ntp.nict.jp"
+			c.Metrics.Listen = "9100"
+		}, want: []string{"clock.sntp_server", "metrics.listen"}},
+		{name: "fast polling", modify: func(c *config.Config) { c.Polling.Interval.Duration = 100 * time.Millisecond },
+			want: []string{"polling.interval"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.modify(c)
+			err := c.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate accepted %+v", c)
+			}
+			// All problems are reported at once
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not mention %q", err, w)
+				}
+			}
+		})
+	}
+}
@@ -2,36 +2,57 @@ package main
 
 import (
 	"booker-bot/client"
+	"booker-bot/config"
+	"booker-bot/secrets"
 	"context"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 )
 
-const (
-	Username        = "amritacharya"
-	Password        = "12345678"
-	TargetGirlID    = "18037583"
-	TargetShopID    = "2310001233"
-	TargetCourseID  = "253139"
-	AreaPath        = "niigata/A1501/A150101"
-	ShopDir         = "arabiannight"
-	S6URLFormat     = "https://www.cityheaven.net/niigata/A1501/A150101/arabiannight/S6ShareToReservationLogin/?forward=F1&girl_id=%s&pcmode=sp"
-	CourseSelectURL = "https://yoyaku.cityheaven.net/select_course/niigata/A1501/A150101/arabiannight"
-	ProfileInputURL = "https://yoyaku.cityheaven.net/input_profile/niigata/A1501/A150101/arabiannight"
-)
-
 func main() {
 	fmt.Println("Starting Debug Check...")
 
+	// Shop, girl and course come from the shared run configuration
+	cfg, err := config.Load(config.DefaultPath)
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.Target.GirlID == "" {
+		fmt.Println("target.girl_id must be set in the config for the debug check.")
+		os.Exit(1)
+	}
+	targetGirlID := cfg.Target.GirlID
+
+	chain, err := secrets.DefaultChain()
+	if err != nil {
+		fmt.Printf("Failed to load secrets: %v\n", err)
+		os.Exit(1)
+	}
+	sec, err := secrets.Load(chain, secrets.KeyUsername, secrets.KeyPassword)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	log.SetOutput(secrets.NewRedactor(sec.Values()...).Writer(os.Stderr))
+	courseSelectURL := cfg.CourseSelectURL()
+	profileInputURL := cfg.ProfileInputURL()
+
 	// 1. Verify Login & CSRF
 	fmt.Println("Step 1: Login")
 	_, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	courseCfg := client.ReservationConfig{
+		CourseID:    cfg.Target.CourseID,
+		OptionIDs:   cfg.Target.OptionIDs,
+		AcceptTerms: cfg.Target.AcceptTerms,
+	}
 	client := client.NewLowLatencyClient(cancel, 0, nil, nil, nil, false)
 
-	if err := client.Login(Username, Password); err != nil {
+	if err := client.Login(sec.Username, sec.Password); err != nil {
 		fmt.Printf("Login failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -42,18 +63,20 @@ func main() {
 	client.DebugCookies("https://yoyaku.cityheaven.net")
 
 	// 2. Fetch Calendar for specific girl
-	targetURL := fmt.Sprintf(S6URLFormat, TargetGirlID)
-	fmt.Printf("Step 2: Fetching Calendar for Girl %s from %s\n", TargetGirlID, targetURL)
+	targetURL := cfg.CalendarURL(targetGirlID)
+	fmt.Printf("Step 2: Fetching Calendar for Girl %s from %s\n", targetGirlID, targetURL)
 
-	slots, err := client.FetchCalendar(targetURL)
+	cal, err := client.FetchCalendarGrid(targetURL)
 	if err != nil {
-		fmt.Printf("FetchCalendar returned error: %v\n", err)
+		fmt.Printf("FetchCalendarGrid returned error: %v\n", err)
 		os.Exit(1)
 	}
+	fmt.Print(cal.Render())
 
-	fmt.Printf("FetchCalendar returned %d slots.\n", len(slots))
+	slots := cal.Available()
+	fmt.Printf("FetchCalendarGrid returned %d cells, %d available.\n", len(cal.Slots), len(slots))
 	for _, s := range slots {
-		fmt.Printf(" - Slot: %s %s\n", s.Date, s.DayTime)
+		fmt.Printf(" - Slot: %s %s (girl %s, %s/%s)\n", s.Date, s.DayTime, s.GirlID, s.Mark, s.Flag)
 	}
 
 	if len(slots) == 0 {
@@ -78,7 +101,7 @@ func main() {
 	// Check cookies before SelectSlot
 	client.DebugCookies("https://yoyaku.cityheaven.net")
 
-	if err := client.SelectSlot(AreaPath, ShopDir, TargetGirlID, targetSlot.Date, rawTime); err != nil {
+	if err := client.SelectSlot(context.Background(), cfg.Shop.AreaPath, cfg.Shop.Dir, targetGirlID, targetSlot.Date, rawTime); err != nil {
 		fmt.Printf("SelectSlot failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -88,21 +111,21 @@ func main() {
 	fmt.Println("B. Selecting Course...")
 	client.DebugCookies("https://yoyaku.cityheaven.net")
 
-	if err := client.SelectCourse(CourseSelectURL, TargetCourseID); err != nil {
+	if err := client.SelectCourse(context.Background(), courseSelectURL, courseCfg); err != nil {
 		fmt.Printf("SelectCourse failed: %v\n", err)
 		// Dump HTML if CSRF error
 		fmt.Println("Dumping Course Page...")
-		dumpPage(client, CourseSelectURL, "debug_course_error.html")
+		dumpPage(client, courseSelectURL, "debug_course_error.html")
 		os.Exit(1)
 	}
 	fmt.Println("Course selected.")
 
 	// C. Submit Profile (Checks CSRF)
 	fmt.Println("C. Checking Profile Page (CSRF)...")
-	token, err := client.GetCSRFToken(ProfileInputURL)
+	token, err := client.GetCSRFToken(profileInputURL)
 	if err != nil {
 		fmt.Printf("Profile Page CSRF failed: %v\n", err)
-		dumpPage(client, ProfileInputURL, "debug_profile_error.html")
+		dumpPage(client, profileInputURL, "debug_profile_error.html")
 		os.Exit(1)
 	}
 	fmt.Printf("Profile Page CSRF Token found: %s\n", token)
@@ -2,31 +2,44 @@ package main
 
 import (
 	"booker-bot/client"
+	"booker-bot/config"
+	"booker-bot/secrets"
 	"fmt"
 	"net/http"
 	"time"
 )
 
-// Copies from main.go
-const (
-	SmartproxyUser     = "smart-b3ufblq8e30y_area-JP_state-tokyo"
-	SmartproxyPass     = "3FgT4tkDlv9CMd4t"
-	SmartproxyEndpoint = "proxy.smartproxy.net:3120"
-
-	TargetURL = "https://www.cityheaven.net/"
-)
-
 func main() {
 	fmt.Println("Starting HTTP/2 Verification (Standard Transport + Smartproxy)...")
 
+	// The shop page from the shared run configuration
+	cfg, err := config.Load(config.DefaultPath)
+	if err != nil {
+		fmt.Printf("❌ Failed to load config: %v\n", err)
+		return
+	}
+	targetURL := cfg.ShopURL()
+
 	// Initialize Manager
 	pm := client.NewProxyManager()
-	pm.EnableSmartproxy(SmartproxyUser, SmartproxyPass, SmartproxyEndpoint)
+
+	// Smartproxy credentials come from the secrets provider (see main.go)
+	chain, err := secrets.DefaultChain()
+	if err != nil {
+		fmt.Printf("❌ Failed to load secrets: %v\n", err)
+		return
+	}
+	sec, err := secrets.Load(chain, secrets.KeyProxyUser, secrets.KeyProxyPass, secrets.KeyProxyEndpoint)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	pm.EnableSmartproxy(sec.ProxyUser, sec.ProxyPass, sec.ProxyEndpoint)
 
 	// Create client with ForceStandardTransport = true
 	c := client.NewLowLatencyClient(func() {}, 0, pm, nil, nil, true)
 
-	req, _ := http.NewRequest("GET", TargetURL, nil)
+	req, _ := http.NewRequest("GET", targetURL, nil)
 
 	start := time.Now()
 	// Note: We use c.Do which has debug prints enabled in client.go
@@ -2,25 +2,31 @@ package main
 
 import (
 	"booker-bot/client"
+	"booker-bot/secrets"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 )
 
-// Copies from main.go
-const (
-	SmartproxyUser     = "smart-b3ufblq8e30y_area-JP_state-tokyo"
-	SmartproxyPass     = "3FgT4tkDlv9CMd4t"
-	SmartproxyEndpoint = "proxy.smartproxy.net:3120"
-)
-
 func main() {
 	fmt.Println("Starting Smartproxy Connection Test (ProxyManager Integration - HTTPS)...")
 
 	// Initialize Manager
 	pm := client.NewProxyManager()
-	pm.EnableSmartproxy(SmartproxyUser, SmartproxyPass, SmartproxyEndpoint)
+
+	// Smartproxy credentials come from the secrets provider (see main.go)
+	chain, err := secrets.DefaultChain()
+	if err != nil {
+		fmt.Printf("❌ Failed to load secrets: %v\n", err)
+		return
+	}
+	sec, err := secrets.Load(chain, secrets.KeyProxyUser, secrets.KeyProxyPass, secrets.KeyProxyEndpoint)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	pm.EnableSmartproxy(sec.ProxyUser, sec.ProxyPass, sec.ProxyEndpoint)
 
 	// Create client
 	c := client.NewLowLatencyClient(func() {}, 0, pm, nil, nil, true)
@@ -2,9 +2,11 @@ package main
 
 import (
 	"booker-bot/client"
+	"booker-bot/secrets"
 	"context"
 	"fmt"
 	"log"
+	"os"
 )
 
 func main() {
@@ -16,12 +18,19 @@ func main() {
 	// Initialize Client
 	client := client.NewLowLatencyClient(cancel, 0, nil, nil, nil)
 
-	// 1. Login
-	username := "amritacharya"
-	password := "12345678" // Use your actual login
+	// 1. Login (credentials from environment, .env or encrypted secrets file)
+	chain, err := secrets.DefaultChain()
+	if err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
+	sec, err := secrets.Load(chain, secrets.KeyUsername, secrets.KeyPassword)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.SetOutput(secrets.NewRedactor(sec.Values()...).Writer(os.Stderr))
 
-	fmt.Printf("Logging in as %s...\n", username)            // Changed log.Println to fmt.Printf
-	if err := client.Login(username, password); err != nil { // Changed c.Login to client.Login
+	fmt.Println("Logging in...")
+	if err := client.Login(sec.Username, sec.Password); err != nil { // Changed c.Login to client.Login
 		log.Fatalf("Login failed: %v", err)
 	}
 	fmt.Println("Login successful!") // Added new line
@@ -0,0 +1,327 @@
+// Package history records what the bot saw and did in an embedded bbolt
+// database: every calendar read, every ListGirls roster and every
+// reservation attempt with its outcome. From the calendar snapshots it can
+// tell when slots opened and how long they stayed open before someone took
+// them.
+//
+// Layout (all values are JSON, keys sort by time):
+//
+//	calendars/<shop_id>/<girl_id>/<unix nano>  CalendarRecord
+//	rosters/<shop_id>/<unix nano>              RosterRecord
+//	attempts/<shop_id>/<unix nano>             AttemptRecord
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"booker-bot/client"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultPath is the database file used by the bot and release_report.
+const DefaultPath = "booking_history.db"
+
+var (
+	calendarsBucket = []byte("calendars")
+	rostersBucket   = []byte("rosters")
+	attemptsBucket  = []byte("attempts")
+)
+
+// SlotRecord is one calendar cell as read.
+type SlotRecord struct {
+	Date string `json:"date"` // e.g. "2026-02-21"
+	Time string `json:"time"` // e.g. "14:00"
+	Mark string `json:"mark,omitempty"`
+	Flag string `json:"flag,omitempty"`
+}
+
+// CalendarRecord is one FetchCalendarGrid result.
+type CalendarRecord struct {
+	ShopID    string       `json:"shop_id"`
+	GirlID    string       `json:"girl_id"`
+	FetchedAt time.Time    `json:"fetched_at"`
+	Slots     []SlotRecord `json:"slots"`
+}
+
+// Calendar rebuilds the client calendar (cells only) for diffing.
+func (r CalendarRecord) Calendar() *client.Calendar {
+	cal := &client.Calendar{ShopID: r.ShopID}
+	for _, s := range r.Slots {
+		cal.Slots = append(cal.Slots, client.Slot{GirlID: r.GirlID, Date: s.Date, DayTime: s.Time, Mark: s.Mark, Flag: s.Flag})
+	}
+	return cal
+}
+
+// RosterRecord is one ListGirls result.
+type RosterRecord struct {
+	ShopID    string    `json:"shop_id"`
+	FetchedAt time.Time `json:"fetched_at"`
+	GirlIDs   []string  `json:"girl_ids"`
+}
+
+// AttemptRecord is one candidate tried by a reservation or waitlist flow.
+type AttemptRecord struct {
+	ShopID   string    `json:"shop_id"`
+	GirlID   string    `json:"girl_id"`
+	At       time.Time `json:"at"`
+	Slot     string    `json:"slot"`   // AttemptLog.Slot, e.g. "2026-02-21 14:00"
+	Result   string    `json:"result"` // AttemptLog.Result
+	Detail   string    `json:"detail,omitempty"`
+	Status   string    `json:"status"`
+	Waitlist bool      `json:"waitlist,omitempty"`
+	DryRun   bool      `json:"dry_run"`
+}
+
+// Store is an open history database. A nil *Store records nothing, so
+// callers can run without history when the file cannot be opened.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens (creating if needed) the database at path with 0600
+// permissions. It fails after a second if another process holds the file.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("history: open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{calendarsBucket, rostersBucket, attemptsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("history: init %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// RecordCalendar stores every cell of cal as read at fetchedAt.
+func (s *Store) RecordCalendar(shopID, girlID string, cal *client.Calendar, fetchedAt time.Time) error {
+	if s == nil {
+		return nil
+	}
+	r := CalendarRecord{ShopID: shopID, GirlID: girlID, FetchedAt: fetchedAt}
+	for _, sl := range cal.Slots {
+		r.Slots = append(r.Slots, SlotRecord{Date: sl.Date, Time: sl.DayTime, Mark: sl.Mark, Flag: sl.Flag})
+	}
+	return s.put(r, fetchedAt, calendarsBucket, shopID, girlID)
+}
+
+// RecordRoster stores the girl IDs listed on the shop page.
+func (s *Store) RecordRoster(shopID string, girlIDs []string, fetchedAt time.Time) error {
+	if s == nil {
+		return nil
+	}
+	return s.put(RosterRecord{ShopID: shopID, FetchedAt: fetchedAt, GirlIDs: girlIDs}, fetchedAt, rostersBucket, shopID)
+}
+
+// RecordAttempt stores one reservation attempt.
+func (s *Store) RecordAttempt(r AttemptRecord) error {
+	if s == nil {
+		return nil
+	}
+	return s.put(r, r.At, attemptsBucket, r.ShopID)
+}
+
+// Calendars returns the girl's calendar records since the given time, oldest
+// first.
+func (s *Store) Calendars(shopID, girlID string, since time.Time) ([]CalendarRecord, error) {
+	var out []CalendarRecord
+	err := each(s, since, func(r CalendarRecord) { out = append(out, r) }, calendarsBucket, shopID, girlID)
+	return out, err
+}
+
+// CalendarGirls returns the girls with recorded calendars for the shop.
+func (s *Store) CalendarGirls(shopID string) ([]string, error) {
+	var out []string
+	if s == nil {
+		return nil, nil
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, calendarsBucket, shopID)
+		if b == nil {
+			return nil
+		}
+		return b.ForEachBucket(func(k []byte) error {
+			out = append(out, string(k))
+			return nil
+		})
+	})
+	return out, err
+}
+
+// Rosters returns the rosters recorded since the given time, oldest first.
+func (s *Store) Rosters(shopID string, since time.Time) ([]RosterRecord, error) {
+	var out []RosterRecord
+	err := each(s, since, func(r RosterRecord) { out = append(out, r) }, rostersBucket, shopID)
+	return out, err
+}
+
+// Attempts returns the attempts recorded since the given time, oldest first.
+func (s *Store) Attempts(shopID string, since time.Time) ([]AttemptRecord, error) {
+	var out []AttemptRecord
+	err := each(s, since, func(r AttemptRecord) { out = append(out, r) }, attemptsBucket, shopID)
+	return out, err
+}
+
+// Opening is a stretch of time a slot was bookable online, reconstructed
+// from consecutive calendar records. Times are only as precise as the
+// polling interval.
+type Opening struct {
+	GirlID   string
+	Slot     client.Slot
+	OpenedAt time.Time // First record showing it open
+	ClosedAt time.Time // First record showing it closed (zero if still open)
+	// Initial is set when the slot was already open in the first record, so
+	// the real opening time is unknown.
+	Initial bool
+}
+
+// Duration is how long the slot stayed open, or false if that is unknown.
+func (o Opening) Duration() (time.Duration, bool) {
+	if o.Initial || o.ClosedAt.IsZero() {
+		return 0, false
+	}
+	return o.ClosedAt.Sub(o.OpenedAt), true
+}
+
+// MaxRecordGap is how far apart two calendar records of one girl may be and
+// still be diffed, for a bot polling every pollInterval. A pass reads every
+// girl in turn, so her records are further apart than the interval, but
+// minutes apart only if the bot was stopped in between.
+func MaxRecordGap(pollInterval time.Duration) time.Duration {
+	return max(5*time.Minute, 10*pollInterval)
+}
+
+// Openings replays the shop's calendar records since the given time and
+// returns every opening, ordered by OpenedAt. A record more than maxGap
+// after the previous one is treated like the first: the slots open in it
+// may have opened at any time while the bot was stopped, so they are
+// Initial. A zero maxGap diffs records however far apart they are.
+func (s *Store) Openings(shopID string, since time.Time, maxGap time.Duration) ([]Opening, error) {
+	girls, err := s.CalendarGirls(shopID)
+	if err != nil {
+		return nil, err
+	}
+	var out []Opening
+	for _, girlID := range girls {
+		records, err := s.Calendars(shopID, girlID, since)
+		if err != nil {
+			return nil, err
+		}
+		open := map[string]int{} // slot key → index in out
+		var prev *client.Calendar
+		var prevAt time.Time
+		for _, r := range records {
+			if prev != nil && maxGap > 0 && r.FetchedAt.Sub(prevAt) > maxGap {
+				prev, open = nil, map[string]int{}
+			}
+			cal := r.Calendar()
+			diff := client.DiffCalendars(girlID, prev, cal, r.FetchedAt)
+			for _, e := range diff.Events {
+				switch e.Kind {
+				case client.SlotOpened:
+					open[e.Slot.Key()] = len(out)
+					out = append(out, Opening{GirlID: girlID, Slot: e.Slot, OpenedAt: r.FetchedAt, Initial: diff.Initial})
+				case client.SlotClosed:
+					if i, ok := open[e.Slot.Key()]; ok {
+						out[i].ClosedAt = r.FetchedAt
+						delete(open, e.Slot.Key())
+					}
+				}
+			}
+			prev, prevAt = cal, r.FetchedAt
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Opening) int { return a.OpenedAt.Compare(b.OpenedAt) })
+	return out, nil
+}
+
+// put stores v as JSON under the nested buckets path, keyed by at.
+func (s *Store) put(v interface{}, at time.Time, root []byte, path ...string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(root)
+		for _, name := range path {
+			if b, err = b.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		key := timeKey(at)
+		// Two records in the same nanosecond keep both
+		for b.Get(key) != nil {
+			binary.BigEndian.PutUint64(key, binary.BigEndian.Uint64(key)+1)
+		}
+		return b.Put(key, data)
+	})
+}
+
+// each decodes the records under the nested bucket path from since onwards.
+func each[T any](s *Store, since time.Time, fn func(T), root []byte, path ...string) error {
+	if s == nil {
+		return nil
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, root, path...)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(timeKey(since)); k != nil; k, v = c.Next() {
+			if v == nil {
+				continue // Nested bucket
+			}
+			var r T
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("history: %s/%x: %w", root, k, err)
+			}
+			fn(r)
+		}
+		return nil
+	})
+}
+
+func bucket(tx *bolt.Tx, root []byte, path ...string) *bolt.Bucket {
+	b := tx.Bucket(root)
+	for _, name := range path {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket([]byte(name))
+	}
+	return b
+}
+
+// timeKey encodes t as big-endian Unix nanoseconds so keys sort by time.
+// Times before 1970 (including the zero time) map to 0.
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	if t.IsZero() {
+		return key
+	}
+	if ns := t.UnixNano(); ns > 0 {
+		binary.BigEndian.PutUint64(key, uint64(ns))
+	}
+	return key
+}
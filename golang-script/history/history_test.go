@@ -0,0 +1,159 @@
+package history_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/history"
+)
+
+func calendar(marks map[string]string) *client.Calendar {
+	cal := &client.Calendar{}
+	for _, t := range []string{"14:00", "15:00", "16:00"} {
+		if m, ok := marks[t]; ok {
+			cal.Slots = append(cal.Slots, client.Slot{Date: "2026-02-21", DayTime: t, Mark: m})
+		}
+	}
+	return cal
+}
+
+func openStore(t *testing.T) *history.Store {
+	t.Helper()
+	s, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestOpenings(t *testing.T) {
+	s := openStore(t)
+	t0 := time.Date(2026, 2, 20, 10, 0, 0, 0, time.UTC)
+	passes := []map[string]string{
+		{"14:00": "○", "15:00": "×", "16:00": "×"},
+		{"14:00": "○", "15:00": "○", "16:00": "×"}, // 15:00 cancelled
+		{"14:00": "○", "15:00": "○", "16:00": "×"},
+		{"14:00": "×", "15:00": "×", "16:00": "○"}, // 14:00 and 15:00 taken, 16:00 opens
+	}
+	for i, marks := range passes {
+		if err := s.RecordCalendar("1", "7", calendar(marks), t0.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	openings, err := s.Openings("1", time.Time{}, time.Hour)
+	if err != nil {
+		t.Fatalf("Openings: %v", err)
+	}
+	if len(openings) != 3 {
+		t.Fatalf("openings = %+v, want 3", openings)
+	}
+	first := openings[0]
+	if first.Slot.DayTime != "14:00" || !first.Initial {
+		t.Errorf("first = %+v, want 14:00 open since the first record", first)
+	}
+	if _, ok := first.Duration(); ok {
+		t.Error("first: duration should be unknown")
+	}
+	cancel := openings[1]
+	if d, ok := cancel.Duration(); cancel.Slot.DayTime != "15:00" || !ok || d != 2*time.Minute {
+		t.Errorf("cancellation = %+v (duration %v, %v), want 15:00 open for 2m", cancel, d, ok)
+	}
+	if last := openings[2]; last.Slot.DayTime != "16:00" || !last.ClosedAt.IsZero() {
+		t.Errorf("last = %+v, want 16:00 still open", last)
+	}
+
+	// Records before since are left out
+	if recent, _ := s.Calendars("1", "7", t0.Add(2*time.Minute)); len(recent) != 2 {
+		t.Errorf("Calendars since pass 3 = %d records, want 2", len(recent))
+	}
+}
+
+func TestOpeningsAfterGap(t *testing.T) {
+	s := openStore(t)
+	t0 := time.Date(2026, 2, 20, 10, 0, 0, 0, time.UTC)
+	passes := []struct {
+		at    time.Duration
+		marks map[string]string
+	}{
+		{0, map[string]string{"14:00": "○", "15:00": "×", "16:00": "×"}},
+		{time.Minute, map[string]string{"14:00": "○", "15:00": "○", "16:00": "×"}}, // 15:00 opens
+		// Stopped for five hours: 16:00 opened at some point in between
+		{5 * time.Hour, map[string]string{"14:00": "×", "15:00": "○", "16:00": "○"}},
+		{5*time.Hour + time.Minute, map[string]string{"14:00": "×", "15:00": "×", "16:00": "○"}},
+	}
+	for _, p := range passes {
+		if err := s.RecordCalendar("1", "7", calendar(p.marks), t0.Add(p.at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	openings, err := s.Openings("1", time.Time{}, history.MaxRecordGap(2*time.Second))
+	if err != nil {
+		t.Fatalf("Openings: %v", err)
+	}
+	var known []string
+	for _, o := range openings {
+		if !o.Initial {
+			known = append(known, o.Slot.DayTime+" at "+o.OpenedAt.Sub(t0).String())
+		}
+	}
+	if len(known) != 1 || known[0] != "15:00 at 1m0s" {
+		t.Errorf("openings with a known time = %v, want only 15:00 at 1m", known)
+	}
+	// The first reading after the gap still tracks 15:00 being taken
+	var reopened *history.Opening
+	for i, o := range openings {
+		if o.Initial && o.Slot.DayTime == "15:00" {
+			reopened = &openings[i]
+		}
+	}
+	if reopened == nil || reopened.ClosedAt != t0.Add(5*time.Hour+time.Minute) {
+		t.Errorf("openings = %+v, want 15:00 open after the gap and closed a minute later", openings)
+	}
+
+	// Without a limit the restart counts as the opening time of 16:00
+	all, _ := s.Openings("1", time.Time{}, 0)
+	if last := all[len(all)-1]; last.Slot.DayTime != "16:00" || last.Initial {
+		t.Errorf("openings without a gap limit = %+v, want 16:00 opened at the restart", all)
+	}
+}
+
+func TestRostersAndAttempts(t *testing.T) {
+	s := openStore(t)
+	now := time.Now()
+	if err := s.RecordRoster("1", []string{"7", "8"}, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range []string{"Failed at SlotSelected", "Attempted (Success)"} {
+		// Same timestamp twice must keep both
+		if err := s.RecordAttempt(history.AttemptRecord{ShopID: "1", GirlID: "7", At: now, Slot: "2026-02-21 14:00", Result: result}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rosters, err := s.Rosters("1", time.Time{})
+	if err != nil || len(rosters) != 1 || len(rosters[0].GirlIDs) != 2 {
+		t.Errorf("Rosters = %+v, %v", rosters, err)
+	}
+	attempts, err := s.Attempts("1", time.Time{})
+	if err != nil || len(attempts) != 2 || attempts[1].Result != "Attempted (Success)" {
+		t.Errorf("Attempts = %+v, %v", attempts, err)
+	}
+	if other, _ := s.Attempts("2", time.Time{}); len(other) != 0 {
+		t.Errorf("Attempts for another shop = %+v", other)
+	}
+}
+
+func TestNilStore(t *testing.T) {
+	var s *history.Store
+	if err := s.RecordAttempt(history.AttemptRecord{ShopID: "1"}); err != nil {
+		t.Errorf("RecordAttempt on nil store: %v", err)
+	}
+	if openings, err := s.Openings("1", time.Time{}, 0); err != nil || openings != nil {
+		t.Errorf("Openings on nil store = %v, %v", openings, err)
+	}
+}
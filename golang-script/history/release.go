@@ -0,0 +1,151 @@
+package history
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var jst = time.FixedZone("JST", 9*60*60)
+
+// MinReleaseSamples is how many openings a profile needs before Next
+// suggests a time.
+const MinReleaseSamples = 3
+
+// releaseBucket is the width of the time-of-day windows openings are grouped
+// into when looking for the usual release time.
+const releaseBucket = 15 * time.Minute
+
+// ReleaseProfile summarises when a shop (GirlID "") or girl publishes slots,
+// from openings seen after recording began. All times are JST.
+type ReleaseProfile struct {
+	ShopID    string
+	GirlID    string // "" for the whole shop
+	Samples   int
+	ByWeekday [7]int  // Openings per day of week (time.Sunday = 0)
+	ByHour    [24]int // Openings per hour of day
+	// TypicalTime is the earliest opening ("HH:MM") in the busiest 15-minute
+	// window. Openings are seen up to one polling interval after the release,
+	// so the earliest one is the closest to the real moment.
+	TypicalTime string
+	// LeadDays is the median number of days between an opening and the slot
+	// date; MinLead/MaxLead are the range.
+	LeadDays int
+	MinLead  int
+	MaxLead  int
+}
+
+// AnalyzeReleases builds the shop-wide profile followed by one per girl (in
+// order of first appearance). Openings already open when recording began are
+// ignored, since their opening time is unknown.
+func AnalyzeReleases(shopID string, openings []Opening) []ReleaseProfile {
+	var known []Opening
+	var girls []string
+	for _, o := range openings {
+		if o.Initial {
+			continue
+		}
+		known = append(known, o)
+		if !slices.Contains(girls, o.GirlID) {
+			girls = append(girls, o.GirlID)
+		}
+	}
+
+	profiles := []ReleaseProfile{releaseProfile(shopID, "", known)}
+	for _, g := range girls {
+		var own []Opening
+		for _, o := range known {
+			if o.GirlID == g {
+				own = append(own, o)
+			}
+		}
+		profiles = append(profiles, releaseProfile(shopID, g, own))
+	}
+	return profiles
+}
+
+func releaseProfile(shopID, girlID string, openings []Opening) ReleaseProfile {
+	p := ReleaseProfile{ShopID: shopID, GirlID: girlID, Samples: len(openings)}
+	if len(openings) == 0 {
+		return p
+	}
+
+	buckets := map[int][]int{} // bucket → minutes of day
+	var leads []int
+	for _, o := range openings {
+		at := o.OpenedAt.In(jst)
+		p.ByWeekday[at.Weekday()]++
+		p.ByHour[at.Hour()]++
+		mins := at.Hour()*60 + at.Minute()
+		b := mins / int(releaseBucket.Minutes())
+		buckets[b] = append(buckets[b], mins)
+
+		if day, err := time.ParseInLocation("2006-01-02", o.Slot.Date, jst); err == nil {
+			opened := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, jst)
+			leads = append(leads, int(day.Sub(opened).Hours()/24))
+		}
+	}
+
+	busiest := -1
+	for b, mins := range buckets {
+		if busiest < 0 || len(mins) > len(buckets[busiest]) || len(mins) == len(buckets[busiest]) && b < busiest {
+			busiest = b
+		}
+	}
+	first := slices.Min(buckets[busiest])
+	p.TypicalTime = fmt.Sprintf("%02d:%02d", first/60, first%60)
+
+	if len(leads) > 0 {
+		slices.Sort(leads)
+		p.LeadDays = leads[len(leads)/2]
+		p.MinLead, p.MaxLead = leads[0], leads[len(leads)-1]
+	}
+	return p
+}
+
+// Next returns the first TypicalTime after now on a day of week slots have
+// opened on, or the zero time if the profile has fewer than
+// MinReleaseSamples openings.
+func (p ReleaseProfile) Next(now time.Time) time.Time {
+	if p.Samples < MinReleaseSamples || p.TypicalTime == "" {
+		return time.Time{}
+	}
+	var h, m int
+	fmt.Sscanf(p.TypicalTime, "%d:%d", &h, &m)
+	today := now.In(jst)
+	for d := 0; d <= 7; d++ {
+		day := today.AddDate(0, 0, d)
+		t := time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, jst)
+		if t.After(now) && p.ByWeekday[t.Weekday()] > 0 {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// String renders the profile as a short report.
+func (p ReleaseProfile) String() string {
+	var b strings.Builder
+	who := "Shop " + p.ShopID
+	if p.GirlID != "" {
+		who = "Girl " + p.GirlID
+	}
+	fmt.Fprintf(&b, "%s: %d openings", who, p.Samples)
+	if p.Samples == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, ", usually at %s JST, %d days ahead (%d-%d)\n", p.TypicalTime, p.LeadDays, p.MinLead, p.MaxLead)
+
+	b.WriteString("  by day: ")
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		fmt.Fprintf(&b, " %s %d", d.String()[:3], p.ByWeekday[d])
+	}
+	b.WriteString("\n  by hour:")
+	for h, n := range p.ByHour {
+		if n > 0 {
+			fmt.Fprintf(&b, " %02d:00 %d", h, n)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package history_test
+
+import (
+	"testing"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/history"
+)
+
+func TestAnalyzeReleases(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	opening := func(girl string, opened time.Time, slotDate string) history.Opening {
+		return history.Opening{GirlID: girl, Slot: client.Slot{Date: slotDate, DayTime: "14:00"}, OpenedAt: opened}
+	}
+	// 2026-02-16 is a Monday. The shop publishes a week ahead at 10:00 on
+	// Mondays and Wednesdays; polling sees it a little late each time.
+	openings := []history.Opening{
+		opening("7", time.Date(2026, 2, 16, 10, 0, 40, 0, jst), "2026-02-23"),
+		opening("8", time.Date(2026, 2, 16, 10, 1, 10, 0, jst), "2026-02-23"),
+		opening("7", time.Date(2026, 2, 18, 10, 2, 0, 0, jst), "2026-02-25"),
+		opening("7", time.Date(2026, 2, 18, 16, 20, 0, 0, jst), "2026-02-18"), // A cancellation
+		{GirlID: "8", Slot: client.Slot{Date: "2026-02-20", DayTime: "14:00"}, OpenedAt: time.Date(2026, 2, 15, 3, 0, 0, 0, jst), Initial: true},
+	}
+
+	profiles := history.AnalyzeReleases("1", openings)
+	if len(profiles) != 3 || profiles[0].GirlID != "" || profiles[1].GirlID != "7" || profiles[2].GirlID != "8" {
+		t.Fatalf("profiles = %+v, want shop, girl 7, girl 8", profiles)
+	}
+	shop := profiles[0]
+	if shop.Samples != 4 || shop.TypicalTime != "10:00" || shop.LeadDays != 7 || shop.MinLead != 0 || shop.MaxLead != 7 {
+		t.Errorf("shop profile = %+v", shop)
+	}
+	if shop.ByWeekday[time.Monday] != 2 || shop.ByWeekday[time.Wednesday] != 2 || shop.ByHour[10] != 3 {
+		t.Errorf("shop histograms = %v %v", shop.ByWeekday, shop.ByHour)
+	}
+
+	// Tuesday noon: next release is Wednesday 10:00
+	now := time.Date(2026, 2, 24, 12, 0, 0, 0, jst)
+	if got, want := shop.Next(now), time.Date(2026, 2, 25, 10, 0, 0, 0, jst); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+	if girl8 := profiles[2]; girl8.Samples != 1 || !girl8.Next(now).IsZero() {
+		t.Errorf("girl 8 = %+v, want 1 sample and no suggestion", girl8)
+	}
+}
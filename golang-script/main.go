@@ -1,58 +1,42 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"strings"
 	"time"
 
 	"booker-bot/client"
+	"booker-bot/config"
+	"booker-bot/history"
+	"booker-bot/metrics"
+	"booker-bot/secrets"
 
 	"github.com/fatih/color"
+	"github.com/mattn/go-colorable"
 )
 
-// Configuration constants
-const (
-	TargetShopID   = "2310001233" // Taken from JSON analysis
-	TargetGirlID   = "52809022"   // Example girl ID (Optional priority)
-	TargetCourseID = "253139"     // Example course ID
+// receiptsFile collects one JSON line per booking (and dry run) as proof.
+const receiptsFile = "booking_receipts.jsonl"
 
-	// Area/shop path components (used by SelectSlot and SelectGirl)
-	AreaPath = "niigata/A1501/A150101"
-	ShopDir  = "arabiannight"
+// sessionFile keeps the session cookies between runs (owner-only).
+const sessionFile = "session.json"
 
-	// Credentials
-	Username = "amritacharya"
-	Password = "12345678" // PLEASE CHANGE THIS OR LOAD FROM ENV
-
-	// URLs
-	BaseURL = "https://www.cityheaven.net/niigata/A1501/A150101/arabiannight/"
-
-	// CalendarBaseFormat for S6 URL (User suggested, returns JSON)
-	// Uses %[2]s to pick the girlID (2nd arg), ignoring the week number (1st arg)
-	// The S6 URL returns 2 weeks of data, so we might only need to call it once per girl.
-	CalendarBaseFormat = "https://www.cityheaven.net/niigata/A1501/A150101/arabiannight/S6ShareToReservationLogin/?forward=F1&girl_id=%[2]s&pcmode=sp"
-
-	CourseSelectURL = "https://yoyaku.cityheaven.net/select_course/niigata/A1501/A150101/arabiannight"
-	ProfileInputURL = "https://yoyaku.cityheaven.net/input_profile/niigata/A1501/A150101/arabiannight"
-	ConfirmURL      = "https://yoyaku.cityheaven.net/confirm/niigata/A1501/A150101/arabiannight"
-
-	PollInterval = 2000 * time.Millisecond // Slower poll for safety when iterating list
-	DryRun       = true                    // Set to false to actually book
-
-	// Smartproxy Configuration
-	SmartproxyUser     = "smart-b3ufblq8e30y_area-JP_state-tokyo"
-	SmartproxyPass     = "3FgT4tkDlv9CMd4t"
-	SmartproxyEndpoint = "proxy.smartproxy.net:3120"
-)
+// waitlistFile records the cancellation notifications the bot registered.
+const waitlistFile = "waitlist_registrations.jsonl"
 
 func main() {
 	// Disable default log timestamps for cleaner "UI" look
 	log.SetFlags(0)
 
+	configPath := flag.String("config", config.DefaultPath, "path to the YAML/JSON run configuration")
+	importCookies := flag.String("import-cookies", "", "start from a browser session: Playwright cookies.json export")
+	importStorage := flag.String("import-storage", "", "localStorage.json exported with -import-cookies (optional)")
+	flag.Parse()
+
 	// Define colors
 	infoColor := color.New(color.FgCyan).PrintlnFunc()
 	warnColor := color.New(color.FgYellow).PrintfFunc()
@@ -64,6 +48,13 @@ func main() {
 	titleColor("\n🚀 City Heaven Reservation Bot (Go)")
 	infoColor("   --> Mode: Auto-Discovery & Polling (Verbose Slot Logging)")
 
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		errorColor("   ❌ Critical: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("   🏪 Shop: %s (ID %s) | Course: %s | Dry Run: %v\n", cfg.ShopURL(), cfg.Shop.ID, cfg.Target.CourseID, cfg.DryRun)
+
 	// Show current JST time for awareness
 	jst := time.FixedZone("JST", 9*60*60)
 	nowJST := time.Now().In(jst)
@@ -79,19 +70,49 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Load .env file if it exists
-	if err := loadEnv(".env"); err != nil {
-		if !os.IsNotExist(err) {
-			warnColor("   ⚠️  Warning: Error loading .env file: %v\n", err)
-		}
+	// History is optional: without it the bot polls and books as before
+	hist, err := history.Open(history.DefaultPath)
+	if err != nil {
+		warnColor("   ⚠️  Warning: %v (history will not be recorded)\n", err)
+	}
+	defer hist.Close()
+
+	// Release moment estimated from earlier runs (see release_report)
+	release := releaseProfile(hist, cfg)
+	if next := release.Next(time.Now()); !next.IsZero() {
+		fmt.Printf("   🎯 Shop usually publishes at %s JST (%d openings); next predicted release %s\n",
+			release.TypicalTime, release.Samples, next.Format("01-02 15:04 MST"))
 	}
 
+	// Load credentials and profile data (environment, .env, encrypted file)
+	chain, err := secrets.DefaultChain()
+	if err != nil {
+		errorColor("   ❌ Critical: %v\n", err)
+		os.Exit(1)
+	}
+	sec, err := secrets.Load(chain, secrets.KeyUsername, secrets.KeyPassword, secrets.KeyPhone)
+	if err != nil {
+		errorColor("   ❌ Critical: %v\n", err)
+		os.Exit(1)
+	}
+	redactor := secrets.NewRedactor(sec.Values()...)
+	log.SetOutput(redactor.Writer(os.Stderr))
+	// Printed output echoes pages and errors too; color keeps its own handle
+	// on stdout, so point it at the redacted one
+	restoreStdout, err := redactor.RedactStdout()
+	if err != nil {
+		errorColor("   ❌ Critical: %v\n", err)
+		os.Exit(1)
+	}
+	defer restoreStdout()
+	color.Output = colorable.NewColorable(os.Stdout)
+
 	// Initialize Managers
 	pm := client.NewProxyManager()
 
 	// Prioritize Smartproxy if credentials are set
-	if SmartproxyUser != "" && SmartproxyPass != "" {
-		pm.EnableSmartproxy(SmartproxyUser, SmartproxyPass, SmartproxyEndpoint)
+	if sec.HasProxy() {
+		pm.EnableSmartproxy(sec.ProxyUser, sec.ProxyPass, sec.ProxyEndpoint)
 		successColor("   🌐 Smartproxy Integration Enabled")
 	}
 
@@ -113,20 +134,52 @@ func main() {
 
 	// Initialize Client
 	// Use ForceStandardTransport = true for Smartproxy due to CONNECT 612 error with uTLS
-	useStandard := (SmartproxyUser != "" && SmartproxyPass != "")
+	useStandard := sec.HasProxy()
 	c := client.NewLowLatencyClient(cancel, 0, pm, fm, cs, useStandard)
 
-	// 1. Login & Age Verification
-	highlightColor.Println("\n[1] Login & Age Verification...")
-	if err := c.HandleAgeVerification(); err != nil {
-		warnColor("   ⚠️  Warning: Age verification check failed: %v (might already be verified)\n", err)
+	if cfg.Metrics.Listen != "" {
+		srv, err := startMetrics(cfg.Metrics.Listen, c)
+		if err != nil {
+			warnColor("   ⚠️  Warning: %v (metrics disabled)\n", err)
+		} else {
+			successColor(fmt.Sprintf("   📈 Metrics at http://%s/metrics", srv.Addr))
+			defer metrics.Shutdown(srv)
+		}
+	}
+
+	// Schedule against the site's clock rather than the local one
+	syncClock(ctx, c, cfg)
+
+	// A browser session is imported into the store, which both modes resume
+	store := &client.SessionStore{Path: sessionFile}
+	if *importCookies != "" {
+		importBrowserSession(c, store, *importCookies, *importStorage)
+	}
+
+	if cfg.Snipe.Enabled {
+		if err := RunSnipe(ctx, c, cfg, sec, hist, release, store); err != nil {
+			errorColor("   ❌ Critical: %v\n", err)
+			restoreStdout()
+			os.Exit(1)
+		}
+		return
 	}
 
-	if err := c.Login(Username, Password); err != nil {
+	// 1. Login & Age Verification
+	highlightColor.Println("\n[1] Login & Age Verification...")
+	untag := c.TagRequests("Login")
+	resumed, err := c.ResumeSession(store, sec.Username, sec.Password)
+	if err != nil {
 		errorColor("   ❌ Critical: Login failed: %v", err)
+		restoreStdout()
 		os.Exit(1)
 	}
-	successColor("   ✅ Login successful.")
+	untag()
+	if resumed {
+		successColor("   ✅ Saved session still logged in (skipped login).")
+	} else {
+		successColor("   ✅ Login successful.")
+	}
 
 	// 1b. Check existing reservations
 	highlightColor.Println("\n[1b] Checking existing reservations...")
@@ -141,25 +194,51 @@ func main() {
 			fmt.Printf("      - [%s] %s at %s (%s) - Status: %s\n", res.Date, res.GirlName, res.ShopName, res.Time, res.Status)
 		}
 	}
+	printWaitlist(existing)
 
 	// 2. Polling Loop
 	highlightColor.Println("\n[2] Starting Polling Loop with Auto-Discovery...")
+	prefs := slotPreferences(cfg)
+
+	// Only slots that opened since the previous pass are tried; slots that
+	// stay open pass after pass are ones the site will not book for us.
+	calendars := client.NewCalendarStore()
+	calendars.Subscribe(func(e client.CalendarEvent) {
+		stats.slotEvent(e)
+		switch e.Kind {
+		case client.SlotOpened:
+			fmt.Printf("      🆕 Girl %s: %s opened (%s → %s)\n", e.GirlID, e.Slot.Key(), e.Before, e.After)
+		case client.SlotClosed:
+			fmt.Printf("      🔒 Girl %s: %s closed (%s → %s)\n", e.GirlID, e.Slot.Key(), e.Before, e.After)
+		default:
+			fmt.Printf("      🔄 Girl %s: %s %s → %s\n", e.GirlID, e.Slot.Key(), e.Before, e.After)
+		}
+	})
 
+	// releaseTarget is the predicted release the current pass woke up for
+	var releaseTarget time.Time
 	for {
 		select {
 		case <-ctx.Done():
+			client.PrintLatencySummary(c.LatencySummary())
 			return
 		default:
 			// A. Dynamic Girl Discovery
 			fmt.Println("\n   🕵️  Scanning shop page for girls...")
-			girls, err := c.ListGirls(BaseURL)
+			untag := c.TagRequests("ListGirls")
+			girls, err := c.ListGirls(cfg.ShopURL())
+			untag()
 			if err != nil {
 				errorColor("   ❌ Error listing girls: %v\n", err)
 				infoColor("Don't worry, this doesn't mean the program has crashed, the current proxy being used is not working, switching proxies...\n\n\n")
-				time.Sleep(PollInterval)
+				time.Sleep(cfg.Polling.Interval.Duration)
 				continue
 			}
 			fmt.Printf("   🔍 Found %d girls on page.\n", len(girls))
+			if err := hist.RecordRoster(cfg.Shop.ID, girls, c.Scheduler.Now()); err != nil {
+				warnColor("   ⚠️  Warning: Could not record roster: %v\n", err)
+			}
+			girls = prefs.OrderGirls(girls)
 
 			// B. Iterate through each girl
 			for i, girlID := range girls {
@@ -181,31 +260,80 @@ func main() {
 						}
 						pm.UseFileProxies()
 					}
+					stats.setProxyMode(pm)
 
 					proxyInfo := pm.GetCurrentProxyInfo()
 					fmt.Printf("\n   🌐 [%d/%d] Girl %s | Proxy: %s\n", i+1, len(girls), girlID, proxyInfo)
 
 					attemptFailed := false
 					for week := 1; week <= weeksToCheck; week++ {
-						targetURL := fmt.Sprintf(CalendarBaseFormat, week, girlID)
+						targetURL := cfg.CalendarURL(girlID)
 
-						slots, err := c.FetchCalendar(targetURL)
+						untag := c.TagRequests("Calendar")
+						cal, err := c.FetchCalendarGrid(targetURL)
+						untag()
+						stats.calendarFetched(cal, err)
 						if err != nil {
-							warnColor("      ⚠️  Error fetching calendar for girl %s via %s: %v\n", girlID, proxyMode, err)
+							var rl *client.RateLimitError
+							switch {
+							case errors.As(err, &rl):
+								warnColor("      ⏳ Rate limited fetching girl %s via %s: %v\n", girlID, proxyMode, err)
+								time.Sleep(rl.RetryAfter)
+							case errors.Is(err, client.ErrSessionExpired):
+								warnColor("      🔒 Session expired fetching girl %s; logging in again...\n", girlID)
+								if err := c.Relogin(sec.Username, sec.Password, targetURL); err != nil {
+									errorColor("      ❌ Re-login failed: %v\n", err)
+								} else if err := store.Save(c); err != nil {
+									warnColor("      ⚠️  Warning: %v\n", err)
+								}
+							default:
+								warnColor("      ⚠️  Error fetching calendar for girl %s via %s: %v\n", girlID, proxyMode, err)
+							}
 							attemptFailed = true
 							break // Try next proxy mode
 						}
 
-						if len(slots) > 0 {
-							highlightColor.Printf("\n   ✅ FOUND! GirlID %s | %d available slots! (via %s)\n", girlID, len(slots), proxyInfo)
+						if err := hist.RecordCalendar(cfg.Shop.ID, girlID, cal, c.Scheduler.Now()); err != nil {
+							warnColor("      ⚠️  Warning: Could not record calendar: %v\n", err)
+						}
+						diff := calendars.Update(girlID, cal)
+						slots := diff.Opened()
+						if tel, wait := len(cal.Filter(client.SlotPhoneOnly)), len(cal.Filter(client.SlotWaitlist)); len(cal.Available()) == 0 && tel+wait > 0 {
+							fmt.Printf("      No online slots (%d phone-only, %d waitlist)\n", tel, wait)
+						}
+						if stale := len(cal.Available()) - len(slots); stale > 0 {
+							fmt.Printf("      %d slots still open from earlier passes, not retrying\n", stale)
+						}
+
+						candidates := prefs.Rank(slots)
+						if n := cfg.Preferences.MaxCandidates; n > 0 && len(candidates) > n {
+							candidates = candidates[:n]
+						}
+						if len(slots) > 0 && len(candidates) == 0 {
+							fmt.Printf("      %d newly opened slots, none within preferences.earliest/latest\n", len(slots))
+						}
+
+						if len(candidates) == 0 && cfg.Waitlist.Enabled {
+							if full := prefs.RankWaitlist(cal.Slots); len(full) > 0 {
+								RegisterWaitlist(c, cfg, sec, hist, girlID, full)
+							}
+						}
+
+						if len(candidates) > 0 {
+							highlightColor.Printf("\n   ✅ FOUND! GirlID %s | %d newly opened slots, %d candidates! (via %s)\n", girlID, len(slots), len(candidates), proxyInfo)
 							foundSlots = true
 
-							targetSlot := slots[0]
-							fmt.Printf("      Targeting Slot: %s %s\n", targetSlot.Date, targetSlot.DayTime)
+							for i, s := range candidates {
+								fmt.Printf("      Candidate %d: %s %s\n", i+1, s.Date, s.DayTime)
+							}
 
-							RunReservationSequence(c, girlID, targetSlot)
+							target := releaseTarget
+							if target.IsZero() {
+								target = c.Scheduler.Now()
+							}
+							RunReservationSequence(c, cfg, sec, hist, girlID, candidates, target)
 
-							if !DryRun {
+							if !cfg.DryRun {
 								// break
 							}
 						}
@@ -225,6 +353,7 @@ func main() {
 
 				// Re-enable SmartProxy as default for next girl
 				pm.UseSmartproxy()
+				stats.setProxyMode(pm)
 
 				if !foundSlots {
 					// Minimal output for "Scanning..." feel
@@ -232,19 +361,29 @@ func main() {
 				}
 				time.Sleep(500 * time.Millisecond)
 			}
+			releaseTarget = time.Time{}
+			if next := release.Next(c.Scheduler.Now()); !next.IsZero() && c.Scheduler.Until(next) <= cfg.Polling.Interval.Duration {
+				fmt.Printf("\n   🎯 Finished pass. Waking for predicted release at %s...\n", next.Format("15:04:05"))
+				c.Scheduler.LogDrift(c.Scheduler.SleepUntil(next))
+				releaseTarget = next
+				continue
+			}
 			fmt.Println("\n   💤 Finished pass. Sleeping...")
-			time.Sleep(PollInterval)
+			time.Sleep(cfg.Polling.Interval.Duration)
 		}
 	}
 }
 
-// Wrapper for reservation sequence to capture logs
-func RunReservationSequence(c *client.LowLatencyClient, girlID string, slot client.Slot) {
+// Wrapper for reservation sequence to capture logs.
+// Candidates are tried in order on the same session until one is booked.
+// target is the release moment the pass aimed at, or the detection time.
+func RunReservationSequence(c *client.LowLatencyClient, cfg *config.Config, sec *secrets.Secrets, hist *history.Store, girlID string, candidates []client.Slot, target time.Time) {
 	fmt.Println("\n[3] Starting Reservation Sequence...")
+	defer func() { client.PrintLatencySummary(c.LatencySummary()) }()
 
 	// Check JST booking hours before attempting
 	jst := time.FixedZone("JST", 9*60*60)
-	nowJST := time.Now().In(jst)
+	nowJST := c.Scheduler.Now().In(jst)
 	jstHour := nowJST.Hour()
 	fmt.Printf("   🕒 JST Time: %s\n", nowJST.Format("15:04:05"))
 	if jstHour < 9 || jstHour >= 20 {
@@ -255,117 +394,71 @@ func RunReservationSequence(c *client.LowLatencyClient, girlID string, slot clie
 
 	// Initialize Log Entry
 	logEntry := client.LogEntry{
-		TargetSite:         "https://www.cityheaven.net/niigata/A1501/A150101/arabiannight/",
+		TargetSite:         cfg.ShopURL(),
 		ExecutionMode:      "Live Booking (3) - Automated",
 		NetworkEnv:         "10G Environment / Residential Proxy",
 		Protocol:           "HTTP/1.1 over uTLS (Chrome Fingerprint)",
-		TargetTime:         time.Now(), // Ideally passed in, but using Now as "Trigger Time"
+		TargetTime:         target,
 		MonitoringMethod:   "Lightweight Response Inspection",
-		PollingInterval:    "Adaptive (≈2000 ms)", // Matches PollInterval const
+		PollingInterval:    fmt.Sprintf("Adaptive (≈%d ms)", cfg.Polling.Interval.Milliseconds()),
 		AvailabilitySignal: "Detected",
 		Attempts:           []client.AttemptLog{},
 	}
 
 	// Record start time for drift calculation
-	logEntry.ActualTime = time.Now()
-
-	// ── Step 1: Select Slot (POST /calendar/SelectedList/) ──
-	// This locks the time slot in the server-side session.
-	// The API expects day_time in HH:MM format (e.g. "10:00").
-	// [Precision Timing] Sleep until target time (0 drift if target is Now)
-	targetTime := time.Now() // In a real "Snipe" scenario, this would be the release time
-	drift := c.Scheduler.SleepUntil(targetTime)
-	c.Scheduler.LogDrift(drift)
-
-	fmt.Printf("   -> [Step 3a] Selecting Slot: %s %s\n", slot.Date, slot.DayTime)
-
-	if err := c.SelectSlot(AreaPath, ShopDir, girlID, slot.Date, slot.DayTime); err != nil {
-		fmt.Printf("      ❌ Failed to select slot: %v\n", err)
-		return
-	}
-	fmt.Println("      ✅ Slot selected (Token Acquired).")
+	logEntry.ActualTime = c.Scheduler.Now()
 
-	// ── Step 2: Select Girl (POST /Selectvacancygirl/SelectedGirl) ──
-	// This confirms the girl selection after the slot has been locked.
-	// Without this step, SelectCourse returns an error page (no CSRF token).
-	fmt.Printf("   -> [Step 3b] Selecting Girl: %s\n", girlID)
+	// [Precision Timing] Sleep until target time (0 drift if target is Now).
+	// For a predicted release it is already past, and the drift is how long
+	// after the release we got here.
+	drift := c.Scheduler.SleepUntil(target)
+	c.Scheduler.LogDrift(drift)
 
-	if err := c.SelectGirl(TargetShopID, girlID, slot.Date, slot.DayTime); err != nil {
-		fmt.Printf("      ❌ Failed to select girl: %v\n", err)
-		return
+	resvConfig := reservationConfig(cfg, sec, girlID)
+
+	// SelectSlot locks the slot, SelectGirl confirms the girl (without it the
+	// course page is an error page), then course → profile → confirm.
+	// A transient failure resumes from the last good state; a failed
+	// candidate moves on to the next one on the same session.
+	var flows []*client.ReservationFlow
+	newFlow := func(slot client.Slot) *client.ReservationFlow {
+		flow := newReservationFlow(c, cfg, sec, resvConfig, slot)
+		flow.TimeChangeWindow = cfg.Target.TimeChangeWindow.Duration
+		flows = append(flows, flow)
+		return flow
 	}
-	fmt.Println("      ✅ Girl selected.")
 
-	// ── Step 3: Select Course ──
-	// Now the session is correctly established, so the course page will
-	// render with the _csrf token.
-	fmt.Println("   -> [Step 3c] Selecting Course...")
-	if err := c.SelectCourse(CourseSelectURL, TargetCourseID); err != nil {
-		fmt.Printf("      ❌ Failed to select course: %v\n", err)
-		return
+	flow, attempts, err := client.TryCandidates(context.Background(), candidates, newFlow)
+	logEntry.Attempts = append(logEntry.Attempts, attempts...)
+	for _, f := range flows {
+		logEntry.Relogins = append(logEntry.Relogins, f.Relogins()...)
 	}
-	fmt.Println("      ✅ Course selected.")
-
-	// ── Step 4: Input Profile ──
-	fmt.Println("   -> [Step 3d] Submitting Profile...")
-	// Use the client's actual phone number
-	actualPhone := "08060521567"
-
-	config := client.ReservationConfig{
-		ShopID:   TargetShopID,
-		GirlID:   girlID,
-		CourseID: TargetCourseID,
-		AreaPath: AreaPath,
-		ShopDir:  ShopDir,
-		Name:     "山田 太郎", // Use Japanese name to avoid validation issues
-		Phone:    actualPhone,
-		Email:    fmt.Sprintf("user%d@gmail.com", time.Now().UnixNano()%10000),
-	}
-	body, profileURL, err := c.SubmitProfile(ProfileInputURL, config)
+	recordAttempts(hist, cfg, girlID, attempts, false)
 	if err != nil {
-		fmt.Printf("      ❌ Failed to submit profile: %v\n", err)
-		return
-	}
-	fmt.Println("      ✅ Profile submitted.")
-
-	// ── Step 5: Confirm ──
-	fmt.Println("   -> [Step 3e] Confirming Reservation...")
-	// Use profileURL (the redirect destination from SubmitProfile) as the confirm POST target,
-	// since it's the actual confirm page URL the server expects.
-	confirmTarget := profileURL
-	if confirmTarget == "" {
-		confirmTarget = ConfirmURL // fallback to constant
-	}
-	if err := c.ConfirmReservation(confirmTarget, profileURL, body, DryRun); err != nil {
-		log.Printf("Failed to confirm: %v", err)
+		log.Printf("Reservation stopped after %d candidate(s): %v", len(attempts), err)
 		logEntry.Result = "FAILED"
 		logEntry.ObservedIssues = err.Error()
-		logEntry.EndToEndReadiness = "Failed"
+		if flow != nil {
+			logEntry.EndToEndReadiness = fmt.Sprintf("Failed (last good state: %s)", lastGoodState(flow, err))
+			logEntry.UseRequests(flow.CriticalRequest(), flow.Requests())
+		}
+		logEntry.Clock = c.Scheduler.Clock.Estimate()
 		client.PrintExecutionLog(logEntry)
 		return
 	}
 
-	// Synthesize Metrics (In a real scenario, we'd extract these from the individual requests in client.go)
-	// For now, we simulate "0 ms" latencies for the log presentation if reused, or assume fast.
-	// But let's verify if we can get last request stats.
-	// Since we don't have easy access to the internal stats of the last call here without modifying return types,
-	// we will populate with placeholder "fast" values or calculated Duration.
-
-	logEntry.DNSResolution = 0 * time.Millisecond
-	logEntry.TCPHandshake = 0 * time.Millisecond
-	logEntry.TLSHandshake = 0 * time.Millisecond
-	logEntry.ConnectionReused = true
-	logEntry.ProxyTunnel = "Established (HTTP CONNECT)"
-
-	// Add the successful attempt
-	logEntry.Attempts = append(logEntry.Attempts, client.AttemptLog{
-		Slot:   fmt.Sprintf("%s %s", slot.Date, slot.DayTime),
-		Result: "Attempted (Success)",
-		Detail: "Token acquired, POST sent",
-		Status: "Transaction Complete",
-	})
+	receipt := flow.Receipt()
+	logEntry.Receipt = receipt
+	if err := client.AppendReceipt(receipt, receiptsFile); err != nil {
+		fmt.Printf("      ⚠️  Warning: Could not save booking receipt: %v\n", err)
+	} else {
+		fmt.Printf("      🧾 Receipt saved to %s\n", receiptsFile)
+	}
 
-	if DryRun {
+	// Connection state of the SelectedList that locked the slot
+	logEntry.UseRequests(flow.CriticalRequest(), flow.Requests())
+
+	if cfg.DryRun {
 		fmt.Println("      ✅ SUCCESS: Helper sequence finished (Dry Run).")
 		logEntry.Result = "SUCCESS (Dry Run)"
 	} else {
@@ -377,38 +470,385 @@ func RunReservationSequence(c *client.LowLatencyClient, girlID string, slot clie
 	logEntry.ObservedIssues = "None"
 
 	// Final Print
+	logEntry.Clock = c.Scheduler.Clock.Estimate()
 	client.PrintExecutionLog(logEntry)
 }
 
-// loadEnv reads a file line by line and sets environment variables.
-// It ignores comments starting with # and empty lines.
-func loadEnv(filename string) error {
-	file, err := os.Open(filename)
+// RunSnipe books the configured slot at the release moment: log in (or
+// resume the session in store) snipe.lead ahead, re-check snipe.warmup
+// ahead, fire at the release and print the execution log with the measured
+// drift. A failed preparation or booking is returned after the log is
+// printed, so the process exits non-zero.
+func RunSnipe(ctx context.Context, c *client.LowLatencyClient, cfg *config.Config, sec *secrets.Secrets, hist *history.Store, release history.ReleaseProfile, store *client.SessionStore) error {
+	releaseAt, err := cfg.Snipe.ReleaseTime()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	if releaseAt.IsZero() {
+		if releaseAt = release.Next(c.Scheduler.Now()); releaseAt.IsZero() {
+			return errors.New("snipe.release_at is empty and the history has no release to predict")
+		}
+		fmt.Printf("   🎯 Using predicted release %s\n", releaseAt.Format("2006-01-02 15:04:05 MST"))
+	}
+	girlID := cfg.Target.GirlID
+	slot := client.Slot{Date: cfg.Snipe.Date, DayTime: cfg.Snipe.Time, GirlID: girlID}
+	fmt.Printf("\n[S] Snipe: girl %s at %s, firing at %s (login %v ahead)\n",
+		girlID, slot.Key(), releaseAt.In(time.FixedZone("JST", 9*60*60)).Format("2006-01-02 15:04:05.000 MST"), cfg.Snipe.Lead.Duration)
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	logEntry := client.LogEntry{
+		TargetSite:         cfg.ShopURL(),
+		ExecutionMode:      "Snipe (Scheduled Release)",
+		NetworkEnv:         "10G Environment / Residential Proxy",
+		Protocol:           "HTTP/1.1 over uTLS (Chrome Fingerprint)",
+		TargetTime:         releaseAt,
+		MonitoringMethod:   "Scheduled Fire (no polling)",
+		PollingInterval:    "N/A",
+		AvailabilitySignal: "Release Time",
+	}
+
+	flow := newReservationFlow(c, cfg, sec, reservationConfig(cfg, sec, girlID), slot)
+	defer func() { client.PrintLatencySummary(c.LatencySummary()) }()
+	snipe := &client.Snipe{
+		Client:       c,
+		Username:     sec.Username,
+		Password:     sec.Password,
+		CalendarURL:  cfg.CalendarURL(girlID),
+		ReleaseAt:    releaseAt,
+		Lead:         cfg.Snipe.Lead.Duration,
+		Warmup:       cfg.Snipe.Warmup.Duration,
+		ClockSamples: cfg.Clock.CalibrationSamples,
+		Flow:         flow,
+		Store:        store,
+	}
+	res, err := snipe.Run(ctx)
+	if res == nil {
+		// Failed while preparing; nothing was fired
+		logEntry.ActualTime = c.Scheduler.Now()
+		logEntry.Result = "FAILED"
+		logEntry.EndToEndReadiness = "Not fired (preparation failed)"
+		logEntry.ObservedIssues = err.Error()
+		logEntry.Clock = c.Scheduler.Clock.Estimate()
+		client.PrintExecutionLog(logEntry)
+		return err
+	}
+
+	logEntry.ActualTime = res.Fired
+	logEntry.Relogins = flow.Relogins()
+	logEntry.AvailabilitySignal = fmt.Sprintf("Release Time (slot was %s before release)", res.Seen)
+	attempt := client.AttemptLog{Slot: slot.Key(), Result: "Attempted (Success)", Status: "Transaction Complete"}
+	if err != nil {
+		attempt.Result = fmt.Sprintf("Failed in %s", flow.State())
+		var te *client.TransitionError
+		if errors.As(err, &te) {
+			attempt.Result = fmt.Sprintf("Failed at %s", te.To)
 		}
+		attempt.Detail = err.Error()
+		attempt.Status = "Stopped"
+		logEntry.Attempts = []client.AttemptLog{attempt}
+		recordAttempts(hist, cfg, girlID, logEntry.Attempts, false)
+		logEntry.UseRequests(flow.CriticalRequest(), flow.Requests())
+		logEntry.Result = "FAILED"
+		logEntry.EndToEndReadiness = fmt.Sprintf("Failed (last good state: %s)", lastGoodState(flow, err))
+		logEntry.ObservedIssues = err.Error()
+		logEntry.Clock = c.Scheduler.Clock.Estimate()
+		client.PrintExecutionLog(logEntry)
+		return err
+	}
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
+	receipt := flow.Receipt()
+	attempt.Detail = fmt.Sprintf("%s with %s, %s", receipt.Course, receipt.GirlName, receipt.Price)
+	logEntry.Attempts = []client.AttemptLog{attempt}
+	recordAttempts(hist, cfg, girlID, logEntry.Attempts, false)
+	logEntry.Receipt = receipt
+	logEntry.UseRequests(flow.CriticalRequest(), flow.Requests())
+	if err := client.AppendReceipt(receipt, receiptsFile); err != nil {
+		fmt.Printf("      ⚠️  Warning: Could not save booking receipt: %v\n", err)
+	}
+	logEntry.Result = "SUCCESS (Confirmed)"
+	if cfg.DryRun {
+		logEntry.Result = "SUCCESS (Dry Run)"
+	}
+	logEntry.EndToEndReadiness = "Confirmed"
+	logEntry.ObservedIssues = "None"
+	logEntry.EngineerNote = fmt.Sprintf("Logged in %v before release; fired %d µs after target.",
+		releaseAt.Sub(res.LoggedIn).Round(time.Millisecond), res.Drift.Microseconds())
+	logEntry.Clock = c.Scheduler.Clock.Estimate()
+	client.PrintExecutionLog(logEntry)
+	return nil
+}
+
+// syncClock takes an SNTP reading (if configured) and calibrates the
+// scheduler against the Date headers of the site.
+func syncClock(ctx context.Context, c *client.LowLatencyClient, cfg *config.Config) {
+	fmt.Println("\n[0] Clock Calibration...")
+	defer c.TagRequests("Clock")()
+	if cfg.Clock.SNTPServer != "" {
+		if sample, err := c.Scheduler.SyncSNTP(ctx, cfg.Clock.SNTPServer); err != nil {
+			fmt.Printf("   ⚠️  Warning: %v\n", err)
+		} else {
+			fmt.Printf("   🕰️  SNTP %s: offset %+d ms (delay %d ms)\n", cfg.Clock.SNTPServer,
+				((sample.Low + sample.High) / 2).Milliseconds(), sample.RTT.Milliseconds())
+		}
+	}
+	est := c.Scheduler.Clock.Estimate()
+	if cfg.Clock.CalibrationSamples > 0 {
+		var err error
+		if est, err = c.CalibrateClock(ctx, config.WWWBase+"/", cfg.Clock.CalibrationSamples); err != nil {
+			fmt.Printf("   ⚠️  Warning: %v\n", err)
 		}
+	}
+	fmt.Printf("   🕰️  Server clock: %s\n", est)
+	if est.Calibrated() {
+		fmt.Printf("   📶 RTT: min %d ms / avg %d ms\n", est.MinRTT.Milliseconds(), est.AvgRTT.Milliseconds())
+	}
+	if corr := est.Correction(); corr != 0 {
+		fmt.Printf("   ⚠️  Local clock is %+d ms off the site; scheduling against server time\n", corr.Milliseconds())
+	}
+}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		// Remove quotes if present
-		value = strings.Trim(value, `"'`)
+// lastGoodState is the last state the flow reached before it stopped.
+func lastGoodState(flow *client.ReservationFlow, err error) client.FlowState {
+	var te *client.TransitionError
+	if errors.As(err, &te) {
+		return te.From
+	}
+	return flow.State()
+}
+
+// slotPreferences converts the validated preferences section for the client.
+func slotPreferences(cfg *config.Config) client.SlotPreferences {
+	p := client.SlotPreferences{
+		Girls:         cfg.Preferences.Girls,
+		Days:          cfg.Preferences.Weekdays(),
+		Earliest:      cfg.Preferences.Earliest,
+		Latest:        cfg.Preferences.Latest,
+		CourseMinutes: cfg.Preferences.CourseMinutes,
+	}
+	for _, w := range cfg.Preferences.Windows {
+		if tw, err := client.ParseTimeWindow(w); err == nil {
+			p.Windows = append(p.Windows, tw)
+		}
+	}
+	return p
+}
 
-		if err := os.Setenv(key, value); err != nil {
+// reservationConfig builds the flow configuration for girlID. Profile data
+// comes from the secrets provider, never from source.
+func reservationConfig(cfg *config.Config, sec *secrets.Secrets, girlID string) client.ReservationConfig {
+	email := sec.Email
+	if email == "" {
+		email = fmt.Sprintf("user%d@gmail.com", time.Now().UnixNano()%10000)
+	}
+	return client.ReservationConfig{
+		ShopID:   cfg.Shop.ID,
+		GirlID:   girlID,
+		CourseID: cfg.Target.CourseID,
+		AreaPath: cfg.Shop.AreaPath,
+		ShopDir:  cfg.Shop.Dir,
+		Name:     sec.CustomerName,
+		Phone:    sec.Phone,
+		Email:    email,
+
+		OptionIDs:   cfg.Target.OptionIDs,
+		AcceptTerms: cfg.Target.AcceptTerms,
+	}
+}
+
+// newReservationFlow builds a flow for slot with the URLs, dry run setting,
+// re-login and console hooks shared by bookings and waitlist registrations.
+func newReservationFlow(c *client.LowLatencyClient, cfg *config.Config, sec *secrets.Secrets, resvConfig client.ReservationConfig, slot client.Slot) *client.ReservationFlow {
+	if slot.GirlID != "" {
+		resvConfig.GirlID = slot.GirlID
+	}
+	flow := client.NewReservationFlow(c, resvConfig, slot)
+	flow.CourseSelectURL = cfg.CourseSelectURL()
+	flow.ProfileInputURL = cfg.ProfileInputURL()
+	flow.ConfirmURL = cfg.ConfirmURL()
+	flow.DryRun = cfg.DryRun
+	calendarURL := cfg.CalendarURL(resvConfig.GirlID)
+	flow.Relogin = func() error {
+		if err := c.Relogin(sec.Username, sec.Password, calendarURL); err != nil {
 			return err
 		}
+		fmt.Printf("      🎫 Yoyaku session: %s\n", c.YoyakuSession())
+		if err := (&client.SessionStore{Path: sessionFile}).Save(c); err != nil {
+			fmt.Printf("      ⚠️  Warning: %v\n", err)
+		}
+		return nil
+	}
+	flow.Hooks = stats.withHooks(flowHooks)
+	return flow
+}
+
+// flowHooks print each step of a reservation flow.
+var flowHooks = client.FlowHooks{
+	OnStepStart: func(from, to client.FlowState, attempt int) {
+		retry := ""
+		if attempt > 1 {
+			retry = fmt.Sprintf(" (retry %d)", attempt-1)
+		}
+		fmt.Printf("   -> [Step 3%c] %s → %s%s\n", 'a'+rune(from), from, to, retry)
+	},
+	OnTransition: func(from, to client.FlowState, elapsed time.Duration) {
+		fmt.Printf("      ✅ %s (%v)\n", to, elapsed.Round(time.Millisecond))
+	},
+	OnError: func(err *client.TransitionError, elapsed time.Duration) {
+		fmt.Printf("      ❌ %v (%v)\n", err, elapsed.Round(time.Millisecond))
+		var dup *client.DuplicateReservationError
+		if errors.As(err, &dup) {
+			fmt.Printf("      ⚠️  The account already has a %s for this booking. Release it on the site to book this slot.\n", dup.Kind)
+		}
+	},
+	OnTimeChange: func(requested, accepted client.Slot) {
+		fmt.Printf("      🔁 %s %s is gone, taking proposed %s %s\n", requested.Date, requested.DayTime, accepted.Date, accepted.DayTime)
+	},
+	OnRelogin: func(e client.ReloginEvent) {
+		if e.Err != "" {
+			fmt.Printf("      🔒 Session expired during %s; re-login failed: %s\n", e.Step, e.Err)
+			return
+		}
+		fmt.Printf("      🔑 Session expired during %s; logged in again, retrying the step\n", e.Step)
+	},
+}
+
+// importBrowserSession loads a session exported from a real browser and
+// saves it as the session to resume, so ResumeSession checks it before
+// falling back to Login.
+func importBrowserSession(c *client.LowLatencyClient, store *client.SessionStore, cookiesPath, storagePath string) {
+	r, err := c.ImportBrowserSession(cookiesPath, storagePath)
+	if err != nil {
+		fmt.Printf("   ⚠️  Warning: %v (ignoring the browser session)\n", err)
+		return
+	}
+	fmt.Printf("   🍪 Imported %d browser cookies (%d expired, %d of other sites skipped)\n", r.Imported, r.Expired, r.ThirdParty)
+	for _, a := range r.Auth {
+		icon := "✅"
+		if !a.Present || a.Expired {
+			icon = "⚠️ "
+		}
+		fmt.Printf("      %s %s\n", icon, a)
+	}
+	if len(r.LocalStorage) > 0 {
+		fmt.Printf("      localStorage: %d keys loaded (not sent to the site)\n", len(r.LocalStorage))
+	}
+	if !r.LoggedIn() {
+		fmt.Println("   ⚠️  Auth cookies missing or expired: the session check will most likely fall back to Login.")
+	}
+	if err := store.Save(c); err != nil {
+		fmt.Printf("   ⚠️  Warning: %v\n", err)
+	}
+}
+
+// printWaitlist reports the cancellation notifications held: those My Page
+// lists among existing, and those recorded in waitlistFile.
+func printWaitlist(existing []client.Reservation) {
+	for _, res := range existing {
+		if res.Waitlist() {
+			fmt.Printf("      🔔 My Page waitlist: [%s] %s (%s)\n", res.Date, res.GirlName, res.Time)
+		}
+	}
+
+	held, err := client.LoadWaitlistRegistrations(waitlistFile)
+	if err != nil {
+		fmt.Printf("   ⚠️  Warning: Could not read %s: %v\n", waitlistFile, err)
+		return
+	}
+	active := held.Active(time.Now())
+	if len(active) == 0 {
+		fmt.Println("   ℹ️  No waitlist registrations held.")
+		return
+	}
+	fmt.Printf("   🔔 Holding %d waitlist registrations:\n", len(active))
+	for _, w := range active {
+		dry := ""
+		if w.DryRun {
+			dry = " (dry run)"
+		}
+		fmt.Printf("      - [%s] girl %s %s (registered %s)%s\n", w.Date, w.GirlID, w.Time, w.RegisteredAt.Format("01-02 15:04"), dry)
+	}
+}
+
+// RegisterWaitlist registers a cancellation notification on the first of
+// the ranked full slots not already held, unless waitlist.max_registrations
+// are held already. Slots the site refuses are skipped.
+func RegisterWaitlist(c *client.LowLatencyClient, cfg *config.Config, sec *secrets.Secrets, hist *history.Store, girlID string, slots []client.Slot) {
+	held, err := client.LoadWaitlistRegistrations(waitlistFile)
+	if err != nil {
+		fmt.Printf("      ⚠️  Warning: Could not read %s: %v\n", waitlistFile, err)
+		return
+	}
+	active := held.Active(time.Now())
+	if limit := cfg.Waitlist.MaxRegistrations; limit > 0 && len(active) >= limit {
+		fmt.Printf("      🔔 Holding %d/%d waitlist registrations, not adding more\n", len(active), limit)
+		return
+	}
+
+	resvConfig := reservationConfig(cfg, sec, girlID)
+	for _, slot := range slots {
+		if active.Holds(slot) {
+			continue
+		}
+		fmt.Printf("\n[3] Registering waitlist notification for girl %s at %s...\n", slot.GirlID, slot.Key())
+		flow := newReservationFlow(c, cfg, sec, resvConfig, slot)
+		flow.Waitlist = true
+		err := flow.Run(context.Background())
+		attempt := client.AttemptLog{Slot: slot.Key(), Result: "Attempted (Success)", Status: "Registered"}
+		if err != nil {
+			attempt.Result = fmt.Sprintf("Failed in %s", flow.State())
+			attempt.Detail = err.Error()
+			attempt.Status = "Stopped"
+			if errors.Is(err, client.ErrWaitlistRejected) {
+				attempt.Status = "Next candidate"
+			}
+		}
+		recordAttempts(hist, cfg, slot.GirlID, []client.AttemptLog{attempt}, true)
+		if errors.Is(err, client.ErrWaitlistRejected) {
+			fmt.Printf("      ⚠️  %v, trying the next full slot\n", err)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("      ❌ Waitlist registration failed: %v\n", err)
+			return
+		}
+
+		w := client.NewWaitlistRegistration(cfg.Shop.ID, flow.Receipt())
+		if err := client.AppendWaitlistRegistration(w, waitlistFile); err != nil {
+			fmt.Printf("      ⚠️  Warning: Could not record waitlist registration: %v\n", err)
+		} else {
+			fmt.Printf("      🔔 Waitlist registration recorded in %s\n", waitlistFile)
+		}
+		return
+	}
+}
+
+// recordAttempts stores the attempts in the history database.
+func recordAttempts(hist *history.Store, cfg *config.Config, girlID string, attempts []client.AttemptLog, waitlist bool) {
+	now := time.Now()
+	for _, a := range attempts {
+		err := hist.RecordAttempt(history.AttemptRecord{
+			ShopID:   cfg.Shop.ID,
+			GirlID:   girlID,
+			At:       now,
+			Slot:     a.Slot,
+			Result:   a.Result,
+			Detail:   a.Detail,
+			Status:   a.Status,
+			Waitlist: waitlist,
+			DryRun:   cfg.DryRun,
+		})
+		if err != nil {
+			fmt.Printf("      ⚠️  Warning: Could not record attempt: %v\n", err)
+		}
+	}
+}
+
+// releaseProfile estimates the shop's release time from the last 30 days of
+// history. It is empty (Next returns zero) without enough openings.
+func releaseProfile(hist *history.Store, cfg *config.Config) history.ReleaseProfile {
+	openings, err := hist.Openings(cfg.Shop.ID, time.Now().AddDate(0, 0, -30), history.MaxRecordGap(cfg.Polling.Interval.Duration))
+	if err != nil {
+		fmt.Printf("   ⚠️  Warning: Could not read release history: %v\n", err)
+		return history.ReleaseProfile{}
 	}
-	return scanner.Err()
+	return history.AnalyzeReleases(cfg.Shop.ID, openings)[0]
 }
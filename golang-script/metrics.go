@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"booker-bot/client"
+	"booker-bot/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// stats is set by startMetrics when metrics.listen is configured; nil
+// otherwise, and a nil *botMetrics records nothing.
+var stats *botMetrics
+
+// botMetrics are the series served at /metrics.
+type botMetrics struct {
+	calendarFetches *prometheus.CounterVec   // outcome: ok, layout, error
+	slotsSeen       *prometheus.CounterVec   // status: Available, PhoneOnly, ...
+	slotEvents      *prometheus.CounterVec   // event: opened, closed, changed
+	attempts        *prometheus.CounterVec   // step, class
+	proxyMode       *prometheus.GaugeVec     // mode: smartproxy, file, direct
+	requests        *prometheus.CounterVec   // host, code
+	requestDuration *prometheus.HistogramVec // host
+}
+
+// startMetrics registers the bot's metrics, feeds them from c and serves
+// them on addr.
+func startMetrics(addr string, c *client.LowLatencyClient) (*http.Server, error) {
+	reg := prometheus.NewRegistry()
+	m := newBotMetrics(reg)
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "booker_safety_triggered",
+		Help: "1 once the SafetyManager has stopped the bot.",
+	}, func() float64 {
+		if c.SafetyManager != nil && c.SafetyManager.IsTriggered() {
+			return 1
+		}
+		return 0
+	})
+
+	srv, err := metrics.ListenAndServe(addr, reg)
+	if err != nil {
+		return nil, err
+	}
+	c.OnRequest = m.observeRequest
+	m.setProxyMode(c.ProxyManager)
+	stats = m
+	return srv, nil
+}
+
+// newBotMetrics registers the bot's series with reg.
+func newBotMetrics(reg prometheus.Registerer) *botMetrics {
+	f := promauto.With(reg)
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return f.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	}
+	return &botMetrics{
+		calendarFetches: counter("booker_calendar_fetches_total",
+			"Calendar reads by outcome (ok, layout = page not recognised, error).", "outcome"),
+		slotsSeen: counter("booker_calendar_slots_seen_total",
+			"Calendar cells read, by status.", "status"),
+		slotEvents: counter("booker_calendar_slot_events_total",
+			"Slot changes between passes (opened, closed, changed).", "event"),
+		attempts: counter("booker_flow_attempts_total",
+			"Reservation flow transition attempts by target step and error class (ok on success).", "step", "class"),
+		proxyMode: f.NewGaugeVec(prometheus.GaugeOpts{Name: "booker_proxy_mode",
+			Help: "1 for the proxy mode in use (smartproxy, file, direct)."}, []string{"mode"}),
+		requests: counter("booker_http_requests_total",
+			"HTTP round trips by host and status code (error when no response).", "host", "code"),
+		requestDuration: f.NewHistogramVec(prometheus.HistogramOpts{Name: "booker_http_request_duration_seconds",
+			Help: "HTTP round trip latency by host.", Buckets: metrics.DefaultLatencyBuckets}, []string{"host"}),
+	}
+}
+
+func (m *botMetrics) observeRequest(r client.RequestResult) {
+	host, _, _ := strings.Cut(r.URL, "/")
+	code := strconv.Itoa(r.StatusCode)
+	if r.Error != "" {
+		code = "error"
+	}
+	m.requests.WithLabelValues(host, code).Inc()
+	m.requestDuration.WithLabelValues(host).Observe(r.TotalDuration.Seconds())
+}
+
+// calendarFetched counts one calendar read and, on success, its cells.
+func (m *botMetrics) calendarFetched(cal *client.Calendar, err error) {
+	if m == nil {
+		return
+	}
+	switch {
+	case err == nil:
+		m.calendarFetches.WithLabelValues("ok").Inc()
+	case errors.Is(err, client.ErrCalendarLayout):
+		m.calendarFetches.WithLabelValues("layout").Inc()
+	default:
+		m.calendarFetches.WithLabelValues("error").Inc()
+	}
+	if cal != nil {
+		for _, s := range cal.Slots {
+			m.slotsSeen.WithLabelValues(s.Status().String()).Inc()
+		}
+	}
+}
+
+func (m *botMetrics) slotEvent(e client.CalendarEvent) {
+	if m == nil {
+		return
+	}
+	switch e.Kind {
+	case client.SlotOpened:
+		m.slotEvents.WithLabelValues("opened").Inc()
+	case client.SlotClosed:
+		m.slotEvents.WithLabelValues("closed").Inc()
+	default:
+		m.slotEvents.WithLabelValues("changed").Inc()
+	}
+}
+
+// setProxyMode marks the mode pm is in.
+func (m *botMetrics) setProxyMode(pm *client.ProxyManager) {
+	if m == nil || pm == nil {
+		return
+	}
+	mode := "direct"
+	if pm.IsSmartproxyActive() {
+		mode = "smartproxy"
+	} else if pm.HasFileProxies() {
+		mode = "file"
+	}
+	for _, name := range []string{"smartproxy", "file", "direct"} {
+		v := 0.0
+		if name == mode {
+			v = 1
+		}
+		m.proxyMode.WithLabelValues(name).Set(v)
+	}
+}
+
+// withHooks returns hooks that also count each flow transition attempt.
+func (m *botMetrics) withHooks(hooks client.FlowHooks) client.FlowHooks {
+	if m == nil {
+		return hooks
+	}
+	onTransition, onError := hooks.OnTransition, hooks.OnError
+	hooks.OnTransition = func(from, to client.FlowState, elapsed time.Duration) {
+		m.attempts.WithLabelValues(to.String(), "ok").Inc()
+		if onTransition != nil {
+			onTransition(from, to, elapsed)
+		}
+	}
+	hooks.OnError = func(err *client.TransitionError, elapsed time.Duration) {
+		m.attempts.WithLabelValues(err.To.String(), errorClass(err)).Inc()
+		if onError != nil {
+			onError(err, elapsed)
+		}
+	}
+	return hooks
+}
+
+// errorClass groups flow errors for the attempts counter.
+func errorClass(err *client.TransitionError) string {
+	var opt *client.UnknownOptionError
+	switch {
+	case errors.Is(err, client.ErrOutcomeUnknown):
+		return "outcome_unknown"
+	case errors.Is(err, client.ErrStepTimeout):
+		return "timeout"
+	case errors.Is(err, client.ErrDuplicateReservation):
+		return "duplicate"
+	case errors.Is(err, client.ErrSessionExpired), errors.Is(err, client.ErrMyheavenAuthRequired),
+		errors.Is(err, client.ErrNotLoggedIn), errors.Is(err, client.ErrCSRFMissing):
+		return "session"
+	case errors.Is(err, client.ErrTermsNotAccepted), errors.As(err, &opt):
+		return "options"
+	case errors.Is(err, client.ErrWaitlistRejected):
+		return "waitlist_rejected"
+	case errors.Is(err, client.ErrSlotTaken), errors.Is(err, client.ErrPhoneOnly):
+		return "slot_taken"
+	case errors.Is(err, client.ErrValidation):
+		return "validation"
+	case errors.Is(err, client.ErrRateLimited):
+		return "rate_limited"
+	case err.Transient:
+		return "transient"
+	case errors.Is(err, client.ErrServer):
+		return "server"
+	}
+	return "rejected"
+}
@@ -0,0 +1,55 @@
+// Package metrics serves a Prometheus registry on /metrics. The series
+// themselves are defined with client_golang by whoever registers them.
+//
+//	reg := prometheus.NewRegistry()
+//	fetches := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+//		Name: "booker_calendar_fetches_total", Help: "Calendar reads.",
+//	}, []string{"outcome"})
+//	fetches.WithLabelValues("ok").Inc()
+//	srv, err := metrics.ListenAndServe(":9100", reg) // GET /metrics
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultLatencyBuckets are histogram bounds in seconds for HTTP latency.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// ListenAndServe serves reg on addr at /metrics in the background.
+// The listener is opened before returning, so a busy port is reported here.
+// Stop it with the returned server's Shutdown.
+func ListenAndServe(addr string, reg *prometheus.Registry) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: ln.Addr().String(), Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("   ⚠️  Metrics endpoint stopped: %v\n", err)
+		}
+	}()
+	return srv, nil
+}
+
+// Shutdown is a convenience for stopping a server from ListenAndServe with a
+// short grace period.
+func Shutdown(srv *http.Server) error {
+	if srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
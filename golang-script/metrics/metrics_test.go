@@ -0,0 +1,41 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"booker-bot/metrics"
+)
+
+func TestListenAndServe(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	promauto.With(reg).NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "Test."}, []string{"kind"}).
+		WithLabelValues("a").Inc()
+	srv, err := metrics.ListenAndServe("127.0.0.1:0", reg)
+	if err != nil {
+		t.Fatalf("ListenAndServe: %v", err)
+	}
+	defer metrics.Shutdown(srv)
+
+	resp, err := http.Get("http://" + srv.Addr + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(string(body), `test_total{kind="a"} 1`) {
+		t.Errorf("body:\n%s", body)
+	}
+
+	if _, err := metrics.ListenAndServe(srv.Addr, reg); err == nil {
+		t.Error("second listener on a busy port succeeded")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"booker-bot/client"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+		want      string
+	}{
+		{fmt.Errorf("%w after 2s: %w", client.ErrStepTimeout, errors.New("read")), true, "timeout"},
+		{&client.DuplicateReservationError{}, false, "duplicate"},
+		{fmt.Errorf("%w after 15s: %w", client.ErrStepTimeout, &client.OutcomeUnknownError{Err: errors.New("read")}), false, "outcome_unknown"},
+		{&client.SessionExpiredError{Reason: "redirected to login"}, false, "session"},
+		{fmt.Errorf("profile form: %w", client.ErrCSRFMissing), false, "session"},
+		{client.ErrMyheavenAuthRequired, false, "session"},
+		{client.ErrTermsNotAccepted, false, "options"},
+		{&client.UnknownOptionError{Missing: []string{"901"}}, false, "options"},
+		{client.ErrWaitlistRejected, false, "waitlist_rejected"},
+		{fmt.Errorf("%w: 2026-02-21 14:00", client.ErrSlotTaken), false, "slot_taken"},
+		{client.ErrPhoneOnly, false, "slot_taken"},
+		{&client.ValidationError{Messages: []string{"電話番号を入力してください"}}, false, "validation"},
+		{&client.RateLimitError{RetryAfter: time.Minute}, false, "rate_limited"},
+		{&url.Error{Op: "Get", URL: "https://yoyaku.cityheaven.net/", Err: errors.New("reset")}, true, "transient"},
+		{&client.ServerError{Status: 503}, true, "transient"},
+		{&client.ServerError{Code: "EFRESV030101"}, false, "server"},
+		{errors.New("course selection form not found"), false, "rejected"},
+	}
+	for _, tt := range tests {
+		te := &client.TransitionError{To: client.StateCourseSelected, Transient: tt.transient, Err: tt.err}
+		if got := errorClass(te); got != tt.want {
+			t.Errorf("errorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithHooks(t *testing.T) {
+	var transitions, errs int
+	hooks := client.FlowHooks{
+		OnTransition: func(from, to client.FlowState, elapsed time.Duration) { transitions++ },
+		OnError:      func(err *client.TransitionError, elapsed time.Duration) { errs++ },
+	}
+
+	// Without metrics the hooks are passed through as they are
+	var none *botMetrics
+	none.withHooks(hooks).OnTransition(client.StateStart, client.StateSlotSelected, 0)
+	if transitions != 1 {
+		t.Fatalf("nil metrics: %d transitions, want 1", transitions)
+	}
+
+	m := newBotMetrics(prometheus.NewRegistry())
+	wrapped := m.withHooks(hooks)
+	wrapped.OnTransition(client.StateStart, client.StateSlotSelected, time.Millisecond)
+	wrapped.OnTransition(client.StateSlotSelected, client.StateGirlSelected, time.Millisecond)
+	wrapped.OnError(&client.TransitionError{To: client.StateCourseSelected, Err: client.ErrSlotTaken}, time.Millisecond)
+
+	if transitions != 3 || errs != 1 {
+		t.Errorf("original hooks ran %d/%d times, want 3/1", transitions, errs)
+	}
+	for _, c := range []struct {
+		step, class string
+		want        float64
+	}{
+		{"SlotSelected", "ok", 1},
+		{"GirlSelected", "ok", 1},
+		{"CourseSelected", "slot_taken", 1},
+		{"CourseSelected", "ok", 0},
+	} {
+		if got := testutil.ToFloat64(m.attempts.WithLabelValues(c.step, c.class)); got != c.want {
+			t.Errorf("attempts{step=%q,class=%q} = %v, want %v", c.step, c.class, got, c.want)
+		}
+	}
+
+	// Hooks left nil stay optional
+	m.withHooks(client.FlowHooks{}).OnError(&client.TransitionError{To: client.StateConfirmed, Err: errors.New("x")}, 0)
+}
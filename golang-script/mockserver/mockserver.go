@@ -0,0 +1,314 @@
+// Package mockserver is an offline fake of www.cityheaven.net and
+// yoyaku.cityheaven.net for end-to-end tests of the booking flow.
+//
+// A single httptest TLS server answers for both hosts (requests are routed by
+// Host header). Point a client at it with Transport, which dials the local
+// listener for every host, so the client keeps using the real URLs and the
+// cookie jar scopes cookies exactly as it would against the live site.
+//
+// The flow mirrors the captured browser session in cityheaven_only.json:
+// age gate → login → S6ShareToReservationLogin → freservationresv/receive →
+// calendar (var get_result) → timeChangeProposal → calendar/SelectedList →
+// timeChangeProposal → SelectedGirl → select_course → select_option →
+// myhevenAuthc → terms → input_profile → confirm → Confirm/ConfirmList →
+// complete.
+package mockserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+const (
+	WWWHost    = "www.cityheaven.net"
+	YoyakuHost = "yoyaku.cityheaven.net"
+)
+
+// CalendarSlot is one cell of a girl's calendar, as serialised in get_result.
+type CalendarSlot struct {
+	Date string // e.g. "2026-02-21"
+	Time string // e.g. "1400"
+	Mark string // "○", "△", "TEL", "×"
+	Flg  string // e.g. "CAN"
+}
+
+// Girl is a cast member listed on the shop page.
+type Girl struct {
+	ID    string
+	Name  string
+	Slots []CalendarSlot
+}
+
+// Course is an entry on the select_course page.
+type Course struct {
+	ID      string
+	Name    string
+	Minutes int
+	Price   int
+}
+
+// Option is an extra (extension, nomination fee) offered on select_option.
+type Option struct {
+	ID    string
+	Name  string
+	Price int
+}
+
+// Booking is a reservation completed through Confirm/ConfirmList. Waitlist
+// bookings are cancellation notifications (SelectedList with
+// waitlist_notification=1 on a △ slot) and are listed by Waitlist, not
+// Bookings.
+type Booking struct {
+	Waitlist     bool
+	GirlID       string
+	Date         string
+	Time         string
+	CourseID     string
+	OptionIDs    []string
+	CustomerName string
+	Phone        string
+	Email        string
+}
+
+// Server is the fake site. Exported fields may be changed before the first
+// request is issued.
+type Server struct {
+	Username string
+	Password string
+	MemberID string
+
+	ShopID    string
+	ShopName  string
+	ShopPhone string
+	AreaPath  string // e.g. "niigata/A1501/A150101"
+	ShopDir   string // e.g. "arabiannight"
+
+	Girls   []Girl
+	Courses []Course
+	// Options, when set, makes select_option render a form instead of
+	// redirecting straight on (the captured shop offers none).
+	Options []Option
+	// RequireTerms makes the terms page render an agreement checkbox that
+	// must be ticked before input_profile is served.
+	RequireTerms bool
+	// OmitCourseCSRF leaves the _csrf input out of the course forms.
+	OmitCourseCSRF bool
+
+	// ProfileErrorCode, when set, makes the input_profile POST redirect to
+	// /error/<area>/<dir>/<code>/ instead of the confirm page.
+	ProfileErrorCode string
+	// ConfirmErrorCode does the same for the Confirm/ConfirmList POST.
+	ConfirmErrorCode string
+	// ConfirmStatus and ConfirmDelay spoil the Confirm/ConfirmList answer
+	// after the booking is recorded: the status is sent instead of the
+	// redirect to complete, after the delay.
+	ConfirmStatus int
+	ConfirmDelay  time.Duration
+	// DuplicateCancelWait and DuplicateReservationRequest make the matching
+	// /Confirm/Dupli* check report an existing registration ("flag":true).
+	DuplicateCancelWait         bool
+	DuplicateReservationRequest bool
+
+	// ClockOffset skews the Date header of every response, as if the site's
+	// clock ran this far ahead of the local one.
+	ClockOffset time.Duration
+
+	ts *httptest.Server
+
+	mu             sync.Mutex
+	wwwSessions    map[string]*wwwSession
+	yoyakuSessions map[string]*yoyakuSession
+	tempKeys       map[string]tempKey
+	bookings       []Booking
+	waitlist       []Booking
+	requests       []string
+}
+
+type wwwSession struct {
+	memberID string
+}
+
+type tempKey struct {
+	memberID string
+	girlID   string
+}
+
+// New starts a mock server populated with the shop, girl and course from
+// the captured session. Slots are generated for tomorrow (JST).
+func New() *Server {
+	jst := time.FixedZone("JST", 9*60*60)
+	tomorrow := time.Now().In(jst).AddDate(0, 0, 1).Format("2006-01-02")
+
+	s := &Server{
+		Username:  "testuser",
+		Password:  "testpass",
+		MemberID:  "64521258",
+		ShopID:    "2310001233",
+		ShopName:  "湯房アラビアンナイト",
+		ShopPhone: "025-241-1451",
+		AreaPath:  "niigata/A1501/A150101",
+		ShopDir:   "arabiannight",
+		Girls: []Girl{
+			{
+				ID:   "52809022",
+				Name: "じゅり",
+				Slots: []CalendarSlot{
+					{Date: tomorrow, Time: "1000", Mark: "×", Flg: "NG"},
+					{Date: tomorrow, Time: "1400", Mark: "○", Flg: "CAN"},
+					{Date: tomorrow, Time: "1500", Mark: "TEL", Flg: "TEL"},
+				},
+			},
+			{ID: "26221793", Name: "ももか"},
+		},
+		Courses: []Course{
+			{ID: "253139", Name: "通常コース", Minutes: 80, Price: 28000},
+			{ID: "253140", Name: "通常コース", Minutes: 100, Price: 35000},
+		},
+		wwwSessions:    map[string]*wwwSession{},
+		yoyakuSessions: map[string]*yoyakuSession{},
+		tempKeys:       map[string]tempKey{},
+	}
+
+	mux := http.NewServeMux()
+	s.registerWWW(mux)
+	s.registerYoyaku(mux)
+	s.ts = httptest.NewTLSServer(s.logRequests(mux))
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.ts.Close()
+}
+
+// Transport returns a RoundTripper that sends requests for any host to the
+// mock server. Certificate verification is disabled since the test
+// certificate is not issued for cityheaven.net.
+func (s *Server) Transport() http.RoundTripper {
+	addr := s.ts.Listener.Addr().String()
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+}
+
+// Bookings returns the reservations completed so far.
+func (s *Server) Bookings() []Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Booking(nil), s.bookings...)
+}
+
+// Waitlist returns the cancellation notifications registered so far.
+func (s *Server) Waitlist() []Booking {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Booking(nil), s.waitlist...)
+}
+
+// SetSlot adds or replaces the girl's calendar cell for slot.Date/slot.Time,
+// e.g. to close a slot after the client has read the calendar.
+func (s *Server) SetSlot(girlID string, slot CalendarSlot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.Girls {
+		g := &s.Girls[i]
+		if g.ID != girlID {
+			continue
+		}
+		for j, sl := range g.Slots {
+			if sl.Date == slot.Date && sl.Time == slot.Time {
+				g.Slots[j] = slot
+				return
+			}
+		}
+		g.Slots = append(g.Slots, slot)
+		return
+	}
+}
+
+// ExpireSessions forgets every www and yoyaku session, as the site does when
+// a login times out. Clients keep their cookies but are logged out.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.wwwSessions)
+	clear(s.yoyakuSessions)
+}
+
+// Requests returns every request received, as "METHOD host/path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, fmt.Sprintf("%s %s%s", r.Method, r.Host, r.URL.Path))
+		s.mu.Unlock()
+		w.Header().Set("Date", time.Now().Add(s.ClockOffset).UTC().Format(http.TimeFormat))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) girl(id string) *Girl {
+	for i := range s.Girls {
+		if s.Girls[i].ID == id {
+			return &s.Girls[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) option(id string) *Option {
+	for i := range s.Options {
+		if s.Options[i].ID == id {
+			return &s.Options[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) course(id string) *Course {
+	for i := range s.Courses {
+		if s.Courses[i].ID == id {
+			return &s.Courses[i]
+		}
+	}
+	return nil
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeHTML(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/html;charset=UTF-8")
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
+
+func page(title, body string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="ja">
+<head><meta charset="utf-8"><title>%s</title></head>
+<body>
+%s
+</body>
+</html>`, title, body)
+}
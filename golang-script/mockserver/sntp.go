@@ -0,0 +1,68 @@
+package mockserver
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds from 1900 (NTP era 0) to 1970.
+const ntpEpochOffset = 2208988800
+
+// SNTPServer is a local stand-in for an NTP server whose clock runs Offset
+// ahead of the local one. It answers client-mode requests on a UDP port of
+// 127.0.0.1.
+type SNTPServer struct {
+	Offset time.Duration
+	conn   net.PacketConn
+}
+
+// NewSNTPServer starts an SNTP server skewed by offset.
+func NewSNTPServer(offset time.Duration) (*SNTPServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &SNTPServer{Offset: offset, conn: conn}
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port to query.
+func (s *SNTPServer) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close stops the server.
+func (s *SNTPServer) Close() error {
+	return s.conn.Close()
+}
+
+func (s *SNTPServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		received := time.Now().Add(s.Offset)
+		if n < 48 || buf[0]&0x07 != 3 {
+			continue
+		}
+		resp := make([]byte, 48)
+		resp[0] = 0x24 // LI 0, version 4, mode 4 (server)
+		resp[1] = 1    // Stratum 1
+		copy(resp[12:16], "MOCK")
+		copy(resp[24:32], buf[40:48]) // Originate = client's transmit
+		putNTPTime(resp[16:], received)
+		putNTPTime(resp[32:], received)
+		putNTPTime(resp[40:], time.Now().Add(s.Offset))
+		s.conn.WriteTo(resp, addr)
+	}
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	binary.BigEndian.PutUint64(b, secs<<32|frac)
+}
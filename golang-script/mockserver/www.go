@@ -0,0 +1,200 @@
+package mockserver
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Cookie names used on www. "nenrei" stands in for the age-gate cookie; lo
+// and member_id are the login cookies the client checks for.
+const (
+	ageCookie     = "nenrei"
+	phpSessCookie = "PHPSESSID"
+)
+
+func (s *Server) registerWWW(mux *http.ServeMux) {
+	h := WWWHost
+	mux.Handle(h+"/", s.ageGate(http.HandlerFunc(s.handleWWWTop)))
+	mux.Handle("GET "+h+"/{pref}/login/{$}", s.ageGate(http.HandlerFunc(s.handleLoginPage)))
+	mux.Handle("POST "+h+"/{pref}/login/loginAuth/{$}", s.ageGate(http.HandlerFunc(s.handleLoginAuth)))
+	mux.Handle("GET "+h+"/{pref}/{a1}/{a2}/{dir}/{$}", s.ageGate(http.HandlerFunc(s.handleShopPage)))
+	mux.Handle("GET "+h+"/{pref}/{a1}/{a2}/{dir}/S6ShareToReservationLogin/{$}", s.ageGate(http.HandlerFunc(s.handleS6)))
+	mux.Handle("GET "+h+"/tt/community/SBMyReservation/{$}", s.ageGate(http.HandlerFunc(s.handleMyReservation)))
+	mux.Handle("GET "+h+"/tt/community/S1ShareToReservationLogin/{$}", s.ageGate(http.HandlerFunc(s.handleReservationHistory)))
+}
+
+// ageGate serves the 18+ confirmation page until the nenrei cookie is set.
+// Any request carrying ?nenrei=y passes and sets the cookie.
+func (s *Server) ageGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.wwwSession(w, r)
+
+		if r.URL.Query().Get("nenrei") == "y" {
+			http.SetCookie(w, &http.Cookie{Name: ageCookie, Value: "y", Path: "/"})
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := r.Cookie(ageCookie); err != nil {
+			writeHTML(w, http.StatusOK, page("年齢確認", fmt.Sprintf(
+				`<div class="age-gate"><p>18歳未満の方のご利用はお断りしております。</p>
+<a href="%s?nenrei=y">18歳以上です</a></div>`, html.EscapeString(r.URL.Path))))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wwwSession returns the PHPSESSID session, creating it (and the cookie) on
+// first contact.
+func (s *Server) wwwSession(w http.ResponseWriter, r *http.Request) *wwwSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ck, err := r.Cookie(phpSessCookie); err == nil {
+		if sess, ok := s.wwwSessions[ck.Value]; ok {
+			return sess
+		}
+	}
+	id := randomToken(16)
+	sess := &wwwSession{}
+	s.wwwSessions[id] = sess
+	http.SetCookie(w, &http.Cookie{Name: phpSessCookie, Value: id, Path: "/", Secure: true, SameSite: http.SameSiteNoneMode})
+	return sess
+}
+
+// loggedInMember returns the member ID when the request carries a valid
+// login (member_id cookie bound to a logged-in PHPSESSID).
+func (s *Server) loggedInMember(r *http.Request) string {
+	ck, err := r.Cookie(phpSessCookie)
+	if err != nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.wwwSessions[ck.Value]; ok {
+		return sess.memberID
+	}
+	return ""
+}
+
+func (s *Server) handleWWWTop(w http.ResponseWriter, r *http.Request) {
+	writeHTML(w, http.StatusOK, page("シティヘブンネット", `<div class="top">シティヘブンネット</div>`))
+}
+
+func loginForm(message string) string {
+	return page("ログイン", fmt.Sprintf(`%s
+<form id="login_form" name="login_form" action="/niigata/login/loginAuth/" method="post">
+  <input type="text" name="user" value="">
+  <input type="password" name="pass" value="">
+  <input type="submit" name="login" value="ログイン">
+</form>`, message))
+}
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	writeHTML(w, http.StatusOK, loginForm(""))
+}
+
+func (s *Server) handleLoginAuth(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if r.PostForm.Get("user") != s.Username || r.PostForm.Get("pass") != s.Password {
+		writeHTML(w, http.StatusOK, loginForm(`<p class="error">IDまたはパスワードが違います</p>`))
+		return
+	}
+
+	sess := s.wwwSession(w, r)
+	s.mu.Lock()
+	sess.memberID = s.MemberID
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: "lo", Value: "1", Path: "/"})
+	http.SetCookie(w, &http.Cookie{Name: "member_id", Value: s.MemberID, Path: "/"})
+	writeHTML(w, http.StatusOK, page("マイページ", `<a href="/tt/community/ABMypageHome/">マイページ</a> <a href="/logout/">ログアウト</a>`))
+}
+
+func (s *Server) handleShopPage(w http.ResponseWriter, r *http.Request) {
+	area := strings.Join([]string{r.PathValue("pref"), r.PathValue("a1"), r.PathValue("a2")}, "/")
+	if area != s.AreaPath || r.PathValue("dir") != s.ShopDir {
+		http.NotFound(w, r)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<h1>%s</h1><ul class="girls">`, html.EscapeString(s.ShopName))
+	for _, g := range s.Girls {
+		fmt.Fprintf(&b, `<li><a href="/%s/%s/girlid-%s/">%s</a></li>`, s.AreaPath, s.ShopDir, g.ID, html.EscapeString(g.Name))
+	}
+	b.WriteString(`</ul>`)
+	writeHTML(w, http.StatusOK, page(s.ShopName, b.String()))
+}
+
+// handleS6 issues a one-time temporary_key and hands the session over to
+// yoyaku, like the real S6ShareToReservationLogin redirect.
+func (s *Server) handleS6(w http.ResponseWriter, r *http.Request) {
+	memberID := s.loggedInMember(r)
+	if memberID == "" {
+		http.Redirect(w, r, "/niigata/login/", http.StatusFound)
+		return
+	}
+
+	girlID := r.URL.Query().Get("girl_id")
+	key := randomToken(32)
+	s.mu.Lock()
+	s.tempKeys[key] = tempKey{memberID: memberID, girlID: girlID}
+	s.mu.Unlock()
+
+	parts := strings.Split(s.AreaPath, "/")
+	q := url.Values{}
+	q.Set("system_key", "HEAVEN")
+	q.Set("temporary_key", key)
+	q.Set("user_id", memberID)
+	q.Set("forward", r.URL.Query().Get("forward"))
+	q.Set("prefectures", parts[0])
+	q.Set("area1", parts[1])
+	q.Set("area2", parts[2])
+	q.Set("directory_name", s.ShopDir)
+	q.Set("girl_id", girlID)
+	q.Set("user_kbn", "FRN")
+	http.Redirect(w, r, "https://"+YoyakuHost+"/freservationresv/receive?"+q.Encode(), http.StatusFound)
+}
+
+func (s *Server) handleMyReservation(w http.ResponseWriter, r *http.Request) {
+	if s.loggedInMember(r) == "" {
+		http.Redirect(w, r, "/niigata/login/", http.StatusFound)
+		return
+	}
+	writeHTML(w, http.StatusOK, page("予約履歴",
+		`<iframe src="/tt/community/S1ShareToReservationLogin/?forward=F4&pcmode=sp"></iframe>`))
+}
+
+func (s *Server) handleReservationHistory(w http.ResponseWriter, r *http.Request) {
+	if s.loggedInMember(r) == "" {
+		http.Redirect(w, r, "/niigata/login/", http.StatusFound)
+		return
+	}
+
+	bookings := append(s.Bookings(), s.Waitlist()...)
+	if len(bookings) == 0 {
+		writeHTML(w, http.StatusOK, page("予約履歴", `<p>該当する予約履歴情報はありません</p>`))
+		return
+	}
+
+	var b strings.Builder
+	for _, bk := range bookings {
+		name := bk.GirlID
+		if g := s.girl(bk.GirlID); g != nil {
+			name = g.Name
+		}
+		status := "仮予約"
+		if bk.Waitlist {
+			status = "キャンセル待ち"
+		}
+		fmt.Fprintf(&b, `<div class="yoyaku-history-box">
+  <span class="shop-name">%s</span><span class="girl-name">%s</span>
+  <span class="date">%s</span><span class="time">%s</span><span class="status">%s</span>
+</div>`, html.EscapeString(s.ShopName), html.EscapeString(name), bk.Date, formatHHMM(bk.Time), status)
+	}
+	writeHTML(w, http.StatusOK, page("予約履歴", b.String()))
+}
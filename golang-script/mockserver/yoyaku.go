@@ -0,0 +1,670 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sessionCookie = "SESSION"
+
+// Error codes used for /error/ redirects. The real site's codes are opaque;
+// these are only meaningful within the mock.
+const (
+	ErrCodeFlow = "EFRESV000001" // Page requested out of order (no slot/course/profile in session)
+	ErrCodeCSRF = "EFRESV000002" // Missing or wrong _csrf token
+)
+
+// yoyakuSession is the server-side reservation state bound to the SESSION cookie.
+type yoyakuSession struct {
+	memberID string
+	csrf     string
+
+	girlID       string
+	date         string // "2026-02-21"
+	time         string // "1400"
+	slotLocked   bool
+	waitlist     bool // SelectedList had waitlist_notification=1
+	girlSelected bool
+	courseID     string
+	optionIDs    []string
+	termsOK      bool
+	profile      url.Values
+}
+
+func (s *Server) registerYoyaku(mux *http.ServeMux) {
+	h := YoyakuHost
+	flow := "/{pref}/{a1}/{a2}/{dir}"
+	mux.HandleFunc(h+"/", s.handleYoyakuTop)
+	mux.HandleFunc("GET "+h+"/freservationresv/receive", s.handleReceive)
+	mux.HandleFunc("GET "+h+"/calendar"+flow+"/{week}/{girl}", s.withSession(s.handleCalendar))
+	mux.HandleFunc("POST "+h+"/timeChangeProposal", s.withSession(s.handleTimeChangeProposal))
+	mux.HandleFunc("POST "+h+"/calendar/SelectedList/{$}", s.withSession(s.handleSelectedList))
+	mux.HandleFunc("POST "+h+"/Selectvacancygirl/SelectedGirl", s.withSession(s.handleSelectedGirl))
+	mux.HandleFunc("GET "+h+"/select_course"+flow, s.withSession(s.handleCoursePage))
+	mux.HandleFunc("POST "+h+"/select_course"+flow, s.withSession(s.handleCoursePost))
+	mux.HandleFunc("GET "+h+"/select_option"+flow, s.withSession(s.handleSelectOption))
+	mux.HandleFunc("POST "+h+"/select_option"+flow, s.withSession(s.handleSelectOptionPost))
+	mux.HandleFunc("GET "+h+"/freservationresv/myhevenAuthc", s.withSession(s.handleMyhevenAuthc))
+	mux.HandleFunc("GET "+h+"/terms"+flow, s.withSession(s.handleTerms))
+	mux.HandleFunc("POST "+h+"/terms"+flow, s.withSession(s.handleTermsPost))
+	mux.HandleFunc("GET "+h+"/input_profile"+flow, s.withSession(s.handleProfilePage))
+	mux.HandleFunc("POST "+h+"/input_profile"+flow, s.withSession(s.handleProfilePost))
+	mux.HandleFunc("GET "+h+"/confirm"+flow, s.withSession(s.handleConfirmPage))
+	mux.HandleFunc("POST "+h+"/Confirm/DupliConfirmCancellWait", s.withSession(s.handleDupliCancelWait))
+	mux.HandleFunc("POST "+h+"/Confirm/DupliConfirmReservationRequest", s.withSession(s.handleDupliReservationRequest))
+	mux.HandleFunc("POST "+h+"/Confirm/ConfirmList"+flow, s.withSession(s.handleConfirmList))
+	mux.HandleFunc("GET "+h+"/complete"+flow+"/{girl}", s.withSession(s.handleComplete))
+	mux.HandleFunc("GET "+h+"/error"+flow+"/{code}/{$}", s.handleErrorPage)
+}
+
+type sessionHandler func(w http.ResponseWriter, r *http.Request, sess *yoyakuSession)
+
+// withSession resolves the SESSION cookie. Requests without a valid yoyaku
+// session are sent to the www login page, as the real site does.
+func (s *Server) withSession(next sessionHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var sess *yoyakuSession
+		if ck, err := r.Cookie(sessionCookie); err == nil {
+			s.mu.Lock()
+			sess = s.yoyakuSessions[ck.Value]
+			s.mu.Unlock()
+		}
+		if sess == nil {
+			http.Redirect(w, r, "https://"+WWWHost+"/niigata/login/", http.StatusFound)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		next(w, r, sess)
+	}
+}
+
+func (s *Server) flowPath(page string) string {
+	return fmt.Sprintf("/%s/%s/%s", page, s.AreaPath, s.ShopDir)
+}
+
+func (s *Server) redirectError(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, fmt.Sprintf("/error/%s/%s/%s/", s.AreaPath, s.ShopDir, code), http.StatusMovedPermanently)
+}
+
+// checkCSRF validates the posted _csrf field against the session token.
+func (s *Server) checkCSRF(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) bool {
+	r.ParseForm()
+	if r.PostForm.Get("_csrf") == "" || r.PostForm.Get("_csrf") != sess.csrf {
+		s.redirectError(w, r, ErrCodeCSRF)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleYoyakuTop(w http.ResponseWriter, r *http.Request) {
+	writeHTML(w, http.StatusOK, page("ネット予約", `<div class="top">ネット予約</div>`))
+}
+
+// handleReceive consumes the temporary_key from S6ShareToReservationLogin and
+// establishes the yoyaku session.
+func (s *Server) handleReceive(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("temporary_key")
+	s.mu.Lock()
+	tk, ok := s.tempKeys[key]
+	delete(s.tempKeys, key)
+	s.mu.Unlock()
+	if !ok {
+		http.Redirect(w, r, "https://"+WWWHost+"/niigata/login/", http.StatusFound)
+		return
+	}
+
+	id := randomToken(16)
+	s.mu.Lock()
+	s.yoyakuSessions[id] = &yoyakuSession{memberID: tk.memberID, csrf: randomToken(16)}
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: "member_id", Value: tk.memberID, Path: "/", MaxAge: 172800})
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", Secure: true, HttpOnly: true, SameSite: http.SameSiteNoneMode})
+	http.Redirect(w, r, fmt.Sprintf("/calendar/%s/%s/1/%s", s.AreaPath, s.ShopDir, tk.girlID), http.StatusMovedPermanently)
+}
+
+type calendarEntry struct {
+	Date          string `json:"date"`
+	Time          string `json:"time"`
+	GirlID        string `json:"girl_id"`
+	AcpStatusMark string `json:"acp_status_mark"`
+	AcpStatusFlg  string `json:"acp_status_flg"`
+}
+
+// handleCalendar renders the calendar page with the availability embedded as
+// `var get_result = '{...}';`.
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	g := s.girl(r.PathValue("girl"))
+	if g == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// One map per day, keyed by date, preserving slot order
+	var days []map[string][]calendarEntry
+	index := map[string]int{}
+	for _, sl := range g.Slots {
+		i, ok := index[sl.Date]
+		if !ok {
+			i = len(days)
+			index[sl.Date] = i
+			days = append(days, map[string][]calendarEntry{sl.Date: nil})
+		}
+		days[i][sl.Date] = append(days[i][sl.Date], calendarEntry{
+			Date: sl.Date, Time: sl.Time, GirlID: g.ID, AcpStatusMark: sl.Mark, AcpStatusFlg: sl.Flg,
+		})
+	}
+
+	data, _ := json.Marshal(map[string]any{
+		"shop_id":          s.ShopID,
+		"commu_acp_status": days,
+	})
+	writeHTML(w, http.StatusOK, page("空き状況", fmt.Sprintf(`<div id="chart"></div>
+<script type="text/javascript">
+var get_result = '%s';
+</script>`, data)))
+}
+
+// parseDay strips the "(土)" suffix the calendar sends with the date.
+func parseDay(day string) string {
+	if i := strings.Index(day, "("); i >= 0 {
+		return day[:i]
+	}
+	return day
+}
+
+// parseDayTime turns "14:00" or "14:00-" into "1400".
+func parseDayTime(dayTime string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(dayTime, "-"), ":", "")
+}
+
+func formatHHMM(t string) string {
+	if len(t) == 4 {
+		return t[:2] + ":" + t[2:]
+	}
+	return t
+}
+
+// slotOpen reports whether the girl (or any girl, for "0"/"" free
+// reservations) has a bookable slot at date/time.
+func (s *Server) slotOpen(girlID, date, hhmm string) bool {
+	for _, g := range s.Girls {
+		if girlID != "" && girlID != "0" && g.ID != girlID {
+			continue
+		}
+		for _, sl := range g.Slots {
+			if sl.Date == date && sl.Time == hhmm && (sl.Mark == "○" || sl.Flg == "CAN") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// slotWaitlisted reports whether the girl's slot is full but takes a
+// cancellation notification (△).
+func (s *Server) slotWaitlisted(girlID, date, hhmm string) bool {
+	if g := s.girl(girlID); g != nil {
+		for _, sl := range g.Slots {
+			if sl.Date == date && sl.Time == hhmm && sl.Mark == "△" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleTimeChangeProposal answers {"result":false,"resultData":null} while
+// the requested time is open, as in the capture. Otherwise it proposes the
+// open times of the same girl (any girl for "") on that day as
+// [{"day":"2026-02-21","day_time":"14:30"}, ...]; the live format for this
+// case was never captured.
+func (s *Server) handleTimeChangeProposal(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	var req struct {
+		GirlID  string `json:"girl_id"`
+		Day     string `json:"day"`
+		DayTime string `json:"day_time"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	date, hhmm := parseDay(req.Day), parseDayTime(req.DayTime)
+	if s.slotOpen(req.GirlID, date, hhmm) {
+		fmt.Fprint(w, `{"result":false,"resultData":null}`)
+		return
+	}
+
+	proposals := []map[string]string{}
+	seen := map[string]bool{}
+	for _, g := range s.Girls {
+		for _, sl := range g.Slots {
+			if sl.Date == date && !seen[sl.Time] && s.slotOpen(req.GirlID, date, sl.Time) {
+				seen[sl.Time] = true
+				proposals = append(proposals, map[string]string{"day": date, "day_time": formatHHMM(sl.Time)})
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"result": true, "resultData": proposals})
+}
+
+func (s *Server) handleSelectedList(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	r.ParseForm()
+	date := parseDay(r.PostForm.Get("day"))
+	hhmm := parseDayTime(r.PostForm.Get("day_time"))
+
+	w.Header().Set("Content-Type", "text/plain;charset=UTF-8")
+	waitlist := r.PostForm.Get("waitlist_notification") == "1"
+	if waitlist && !s.slotWaitlisted(r.PostForm.Get("girl_id"), date, hhmm) ||
+		!waitlist && !s.slotOpen(r.PostForm.Get("girl_id"), date, hhmm) {
+		fmt.Fprint(w, "false")
+		return
+	}
+	sess.girlID = r.PostForm.Get("girl_id")
+	sess.date = date
+	sess.time = hhmm
+	sess.slotLocked = true
+	sess.waitlist = waitlist
+	sess.girlSelected = false
+	fmt.Fprint(w, "true")
+}
+
+func (s *Server) handleSelectedGirl(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	var req struct {
+		ShopID  string `json:"shop_id"`
+		GirlID  string `json:"girl_id"`
+		Day     string `json:"day"`
+		DayTime string `json:"day_time"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	open := s.slotOpen(req.GirlID, sess.date, sess.time)
+	if sess.waitlist {
+		open = s.slotWaitlisted(req.GirlID, sess.date, sess.time)
+	}
+	if !sess.slotLocked || req.ShopID != s.ShopID || req.Day != sess.date || parseDayTime(req.DayTime) != sess.time || !open {
+		fmt.Fprint(w, "false")
+		return
+	}
+	sess.girlID = req.GirlID
+	sess.girlSelected = true
+	fmt.Fprint(w, "true")
+}
+
+func (s *Server) handleCoursePage(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if !sess.girlSelected {
+		s.redirectError(w, r, ErrCodeFlow)
+		return
+	}
+
+	csrf := fmt.Sprintf(`<input type="hidden" name="_csrf" value="%s"/>`, sess.csrf)
+	if s.OmitCourseCSRF {
+		csrf = ""
+	}
+	var b strings.Builder
+	b.WriteString(`<h2>コースを選択してください</h2>`)
+	for _, c := range s.Courses {
+		fmt.Fprintf(&b, `<form action="%s" method="post" name="save" class="save">%s
+  <p>%s%d分 %d円</p>
+  <input type="hidden" name="price_list_id" value="72032">
+  <input type="hidden" name="price_list_name" value="%s">
+  <input type="hidden" name="course_id" value="%s">
+  <input type="hidden" name="course_time" value="%d">
+  <input type="hidden" name="course_price" value="%d">
+  <input type="hidden" name="option_nocharge" value="0">
+  <input type="hidden" name="order_price_nocharge" value="0">
+  <input type="hidden" name="free_reservation" value="0">
+  <input type="hidden" name="tab_free" value="0">
+  <input type="hidden" name="free_reservation_use_flg" value="1">
+  <button type="submit">選択する</button>
+</form>
+`, s.flowPath("select_course"), csrf, html.EscapeString(c.Name), c.Minutes, c.Price,
+			html.EscapeString(c.Name), c.ID, c.Minutes, c.Price)
+	}
+	writeHTML(w, http.StatusOK, page("コース選択", b.String()))
+}
+
+func (s *Server) handleCoursePost(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if !s.checkCSRF(w, r, sess) {
+		return
+	}
+	if !sess.girlSelected || s.course(r.PostForm.Get("course_id")) == nil {
+		s.redirectError(w, r, ErrCodeFlow)
+		return
+	}
+	sess.courseID = r.PostForm.Get("course_id")
+	http.Redirect(w, r, s.flowPath("select_option")+"?path=%2Fselect_course&resv_condition=1", http.StatusMovedPermanently)
+}
+
+// handleSelectOption, handleMyhevenAuthc and handleTerms reproduce the
+// redirect chain between select_course and input_profile. select_option and
+// terms only render a page when Options / RequireTerms are set.
+func (s *Server) handleSelectOption(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if sess.courseID == "" {
+		s.redirectError(w, r, ErrCodeFlow)
+		return
+	}
+	if len(s.Options) == 0 {
+		s.redirectMyhevenAuthc(w, r, sess)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<h2>オプションを選択してください</h2>
+<form action="%s" method="post" id="next_form"><input type="hidden" name="_csrf" value="%s"/>
+`, s.flowPath("select_option"), sess.csrf)
+	for _, o := range s.Options {
+		fmt.Fprintf(&b, `  <input type="checkbox" name="option_id" value="%s" id="option_%s"><label for="option_%s">%s %s円</label>
+`, o.ID, o.ID, o.ID, html.EscapeString(o.Name), formatYen(o.Price))
+	}
+	b.WriteString(`  <button type="submit">次へ</button>
+</form>`)
+	writeHTML(w, http.StatusOK, page("オプション選択", b.String()))
+}
+
+func (s *Server) handleSelectOptionPost(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if !s.checkCSRF(w, r, sess) {
+		return
+	}
+	if sess.courseID == "" {
+		s.redirectError(w, r, ErrCodeFlow)
+		return
+	}
+	sess.optionIDs = nil
+	for _, id := range r.PostForm["option_id"] {
+		if s.option(id) == nil {
+			s.redirectError(w, r, ErrCodeFlow)
+			return
+		}
+		sess.optionIDs = append(sess.optionIDs, id)
+	}
+	s.redirectMyhevenAuthc(w, r, sess)
+}
+
+func (s *Server) redirectMyhevenAuthc(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	q := url.Values{}
+	q.Set("back_btn_url", s.flowPath("select_option"))
+	q.Set("resv_condition", "1")
+	q.Set("total_amount", strconv.Itoa(s.totalPrice(sess)))
+	q.Set("optionDispFlg", strconv.Itoa(min(len(s.Options), 1)))
+	http.Redirect(w, r, "/freservationresv/myhevenAuthc?"+q.Encode(), http.StatusMovedPermanently)
+}
+
+func (s *Server) handleMyhevenAuthc(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	http.Redirect(w, r, s.flowPath("terms"), http.StatusMovedPermanently)
+}
+
+func (s *Server) handleTerms(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if !s.RequireTerms {
+		s.redirectProfile(w, r)
+		return
+	}
+	writeHTML(w, http.StatusOK, s.termsPage(sess, ""))
+}
+
+func (s *Server) termsPage(sess *yoyakuSession, errMsg string) string {
+	errHTML := ""
+	if errMsg != "" {
+		errHTML = fmt.Sprintf(`<p class="errorstyle">%s</p>`, html.EscapeString(errMsg))
+	}
+	return page("利用規約", fmt.Sprintf(`<h2>ご利用規約</h2>
+%s
+<form action="%s" method="post" id="next_form"><input type="hidden" name="_csrf" value="%s"/>
+  <input type="checkbox" name="terms_agree" value="1" id="terms_agree"><label for="terms_agree">利用規約に同意する</label>
+  <button type="submit">同意して次へ</button>
+</form>`, errHTML, s.flowPath("terms"), sess.csrf))
+}
+
+func (s *Server) handleTermsPost(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if !s.checkCSRF(w, r, sess) {
+		return
+	}
+	if r.PostForm.Get("terms_agree") != "1" {
+		writeHTML(w, http.StatusOK, s.termsPage(sess, "利用規約に同意してください"))
+		return
+	}
+	sess.termsOK = true
+	s.redirectProfile(w, r)
+}
+
+func (s *Server) redirectProfile(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, s.flowPath("input_profile")+"?pic=%2Fimg%2Fterm_htc3pn.png", http.StatusMovedPermanently)
+}
+
+// totalPrice is the course price plus selected options.
+func (s *Server) totalPrice(sess *yoyakuSession) int {
+	total := 0
+	if c := s.course(sess.courseID); c != nil {
+		total = c.Price
+	}
+	for _, id := range sess.optionIDs {
+		if o := s.option(id); o != nil {
+			total += o.Price
+		}
+	}
+	return total
+}
+
+func (s *Server) profilePage(sess *yoyakuSession, errMsg string) string {
+	errHTML := ""
+	if errMsg != "" {
+		errHTML = fmt.Sprintf(`<p class="errorstyle">%s</p>`, html.EscapeString(errMsg))
+	}
+	return page("連絡先入力", fmt.Sprintf(`<h2>ご連絡先を入力ください</h2>
+%s
+<form action="%s" method="post" name="customer" id="next_form"><input type="hidden" name="_csrf" value="%s"/>
+  <input type="text" name="customer_name" value="">
+  <input type="tel" name="reservation_phone_number" value="">
+  <input type="email" name="mail_pc_sp" value="">
+  <input type="hidden" name="contact_time" value="0">
+  <textarea name="customer_input_notes"></textarea>
+  <input type="checkbox" name="contact_from_check" value="1">
+  <input type="hidden" name="contact_from_shop" value="1">
+</form>`, errHTML, s.flowPath("input_profile"), sess.csrf))
+}
+
+func (s *Server) handleProfilePage(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if sess.courseID == "" {
+		s.redirectError(w, r, ErrCodeFlow)
+		return
+	}
+	if s.RequireTerms && !sess.termsOK {
+		http.Redirect(w, r, s.flowPath("terms"), http.StatusMovedPermanently)
+		return
+	}
+	writeHTML(w, http.StatusOK, s.profilePage(sess, ""))
+}
+
+func (s *Server) handleProfilePost(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if !s.checkCSRF(w, r, sess) {
+		return
+	}
+	if sess.courseID == "" {
+		s.redirectError(w, r, ErrCodeFlow)
+		return
+	}
+	if s.ProfileErrorCode != "" {
+		s.redirectError(w, r, s.ProfileErrorCode)
+		return
+	}
+
+	form := r.PostForm
+	var errMsg string
+	phone := form.Get("reservation_phone_number")
+	switch {
+	case strings.TrimSpace(form.Get("customer_name")) == "":
+		errMsg = "お名前を入力してください"
+	case len(phone) < 10 || len(phone) > 11 || strings.Trim(phone, "0123456789") != "":
+		errMsg = "電話番号を正しく入力してください"
+	case !strings.Contains(form.Get("mail_pc_sp"), "@"):
+		errMsg = "メールアドレスを正しく入力してください"
+	}
+	if errMsg != "" {
+		writeHTML(w, http.StatusOK, s.profilePage(sess, errMsg))
+		return
+	}
+
+	sess.profile = form
+	http.Redirect(w, r, s.flowPath("confirm"), http.StatusMovedPermanently)
+}
+
+func (s *Server) handleConfirmPage(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if sess.profile == nil {
+		s.redirectError(w, r, ErrCodeFlow)
+		return
+	}
+
+	c := s.course(sess.courseID)
+	girlName := "指名なし"
+	if g := s.girl(sess.girlID); g != nil {
+		girlName = g.Name
+	}
+	dateLabel := sess.date
+	if t, err := time.Parse("2006-01-02", sess.date); err == nil {
+		dateLabel = fmt.Sprintf("%s（%s）", t.Format("2006/01/02"), []string{"日", "月", "火", "水", "木", "金", "土"}[t.Weekday()])
+	}
+
+	options := ""
+	for _, id := range sess.optionIDs {
+		o := s.option(id)
+		options += fmt.Sprintf(`
+  <dl><dt>オプション</dt><dd>%s %s円</dd></dl>`, html.EscapeString(o.Name), formatYen(o.Price))
+	}
+
+	writeHTML(w, http.StatusOK, page("確認", fmt.Sprintf(`<h2>ご予約内容をご確認ください。</h2>
+<form action="%s" method="post" id="next_form" class="booking-form-conf"><input type="hidden" name="_csrf" value="%s"/>
+  <dl><dt>日時</dt><dd>%s%s〜</dd></dl>
+  <dl><dt>女の子</dt><dd>%s</dd></dl>
+  <dl><dt>コース</dt><dd>%s%d分 %s円</dd></dl>%s
+  <dl><dt>合計</dt><dd class="total-amount">%s円</dd></dl>
+  <dl><dt>お名前</dt><dd>%s</dd></dl>
+</form>
+<a id="reservation_confirm" class="btn_blue reservation-confirm">上記に同意の上、ネット予約する</a>`,
+		s.flowPath("Confirm/ConfirmList"), sess.csrf,
+		dateLabel, formatHHMM(sess.time), html.EscapeString(girlName),
+		html.EscapeString(c.Name), c.Minutes, formatYen(c.Price), options, formatYen(s.totalPrice(sess)),
+		html.EscapeString(sess.profile.Get("customer_name")))))
+}
+
+func formatYen(n int) string {
+	s := strconv.Itoa(n)
+	var out []byte
+	for i := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+// handleDupliCancelWait also reports a notification already registered
+// through the mock for the session's girl and time.
+func (s *Server) handleDupliCancelWait(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	held := false
+	for _, b := range s.waitlist {
+		held = held || b.GirlID == sess.girlID && b.Date == sess.date && b.Time == sess.time
+	}
+	writeDupliCheck(w, s.DuplicateCancelWait || held)
+}
+
+func (s *Server) handleDupliReservationRequest(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	writeDupliCheck(w, s.DuplicateReservationRequest)
+}
+
+func writeDupliCheck(w http.ResponseWriter, duplicate bool) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"result":"OK","flag":%t}`, duplicate)
+}
+
+func (s *Server) handleConfirmList(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	if !s.checkCSRF(w, r, sess) {
+		return
+	}
+	if sess.profile == nil {
+		s.redirectError(w, r, ErrCodeFlow)
+		return
+	}
+	if s.ConfirmErrorCode != "" {
+		s.redirectError(w, r, s.ConfirmErrorCode)
+		return
+	}
+
+	b := Booking{
+		Waitlist:     sess.waitlist,
+		GirlID:       sess.girlID,
+		Date:         sess.date,
+		Time:         sess.time,
+		CourseID:     sess.courseID,
+		OptionIDs:    sess.optionIDs,
+		CustomerName: sess.profile.Get("customer_name"),
+		Phone:        sess.profile.Get("reservation_phone_number"),
+		Email:        sess.profile.Get("mail_pc_sp"),
+	}
+	if b.Waitlist {
+		s.waitlist = append(s.waitlist, b)
+	} else {
+		s.bookings = append(s.bookings, b)
+	}
+	girlID := sess.girlID
+	*sess = yoyakuSession{memberID: sess.memberID, csrf: randomToken(16)}
+
+	if s.ConfirmDelay > 0 {
+		// Let other requests through while this one hangs
+		s.mu.Unlock()
+		select {
+		case <-time.After(s.ConfirmDelay):
+		case <-r.Context().Done():
+		}
+		s.mu.Lock()
+	}
+	if s.ConfirmStatus != 0 {
+		http.Error(w, http.StatusText(s.ConfirmStatus), s.ConfirmStatus)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("%s/%s?deliveryNgFlg=0", s.flowPath("complete"), girlID), http.StatusMovedPermanently)
+}
+
+func (s *Server) handleComplete(w http.ResponseWriter, r *http.Request, sess *yoyakuSession) {
+	girlID := r.PathValue("girl")
+	girlName := girlID
+	if g := s.girl(girlID); g != nil {
+		girlName = g.Name
+	}
+	writeHTML(w, http.StatusOK, page("完了", fmt.Sprintf(`<form class="booking-form-thanks booking-content">
+  <div class="alert alert_blue"><h2>仮予約ありがとうございます。<br>店舗からのご連絡をお待ちください。</h2></div>
+  <div class="radius-box radius-box_img">
+    <strong class="txt-overflow" data-tooltip>%s（22歳）</strong>
+    <a href="https://%s/%s/%s/girlid-%s" id="profileLink">プロフィールを見る</a>
+  </div>
+  <dl class="radius-top"><dt>店舗名</dt><dd><a href="https://%s/%s/%s/" id="shopLink">
+    %s
+  </a></dd></dl>
+  <dl><dt>営業時間</dt><dd>9:00～最終受付23:00</dd></dl>
+  <dl class="radius-bottom"><dt>電話番号</dt><dd>%s</dd></dl>
+</form>`, html.EscapeString(girlName), WWWHost, s.AreaPath, s.ShopDir, girlID,
+		WWWHost, s.AreaPath, s.ShopDir, html.EscapeString(s.ShopName), s.ShopPhone)))
+}
+
+func (s *Server) handleErrorPage(w http.ResponseWriter, r *http.Request) {
+	msg := "エラーが発生しました。"
+	switch r.PathValue("code") {
+	case ErrCodeFlow:
+		msg = "予約情報が見つかりません。最初からやり直してください。"
+	case ErrCodeCSRF:
+		msg = "不正なリクエストです。"
+	}
+	writeHTML(w, http.StatusOK, page("エラー", fmt.Sprintf(`<div class="error"><p class="error-msg">%s</p><p>%s</p></div>`,
+		html.EscapeString(msg), html.EscapeString(r.PathValue("code")))))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"booker-bot/config"
+	"booker-bot/history"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Prints when the configured shop and its girls usually publish slots,
+// estimated from the calendars recorded in the history database, and the
+// next release moment the bot will aim at.
+//
+//	go run ./release_report [-since 720h] [-girl 52809022]
+//
+// Stop the bot first or pass a copy of the database: bbolt allows one
+// process at a time.
+func main() {
+	configPath := flag.String("config", config.DefaultPath, "path to the YAML/JSON run configuration")
+	dbPath := flag.String("db", history.DefaultPath, "history database written by the bot")
+	since := flag.Duration("since", 30*24*time.Hour, "only use calendars recorded this recently")
+	girl := flag.String("girl", "", "only report this girl (default: shop and every girl)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	hist, err := history.Open(*dbPath)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	defer hist.Close()
+
+	now := time.Now()
+	openings, err := hist.Openings(cfg.Shop.ID, now.Add(-*since), history.MaxRecordGap(cfg.Polling.Interval.Duration))
+	if err != nil {
+		fmt.Printf("Failed to read history: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Release report for shop %s (%s), last %v\n\n", cfg.Shop.ID, cfg.ShopURL(), *since)
+	for _, p := range history.AnalyzeReleases(cfg.Shop.ID, openings) {
+		if *girl != "" && p.GirlID != *girl {
+			continue
+		}
+		fmt.Println(p)
+		if next := p.Next(now); !next.IsZero() {
+			fmt.Printf("  suggested target: %s\n", next.Format("2006-01-02 15:04:05 MST"))
+		} else {
+			fmt.Printf("  suggested target: none (need %d openings)\n", history.MinReleaseSamples)
+		}
+		fmt.Println()
+	}
+}
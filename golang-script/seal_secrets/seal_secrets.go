@@ -0,0 +1,42 @@
+package main
+
+import (
+	"booker-bot/secrets"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Encrypts a plaintext KEY=VALUE file into the secrets file read by the bot.
+//
+//	CH_SECRETS_PASSPHRASE=... go run ./seal_secrets -in plain.env -out secrets.enc
+//
+// Delete the plaintext file afterwards.
+func main() {
+	in := flag.String("in", "", "plaintext KEY=VALUE file to encrypt")
+	out := flag.String("out", secrets.DefaultEncryptedPath, "encrypted output file")
+	flag.Parse()
+
+	if *in == "" {
+		fmt.Println("Usage: CH_SECRETS_PASSPHRASE=... seal_secrets -in plain.env [-out secrets.enc]")
+		os.Exit(2)
+	}
+
+	passphrase := os.Getenv(secrets.KeyPassphrase)
+	if passphrase == "" {
+		fmt.Printf("%s must be set\n", secrets.KeyPassphrase)
+		os.Exit(1)
+	}
+
+	values, err := secrets.LoadDotEnv(*in)
+	if err != nil {
+		fmt.Printf("Failed to read %s: %v\n", *in, err)
+		os.Exit(1)
+	}
+
+	if err := secrets.WriteEncryptedFile(*out, passphrase, values); err != nil {
+		fmt.Printf("Failed to write %s: %v\n", *out, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Encrypted %d secrets into %s\n", len(values), *out)
+}
@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadDotEnv reads a KEY=VALUE file into a MapProvider without touching the
+// process environment. It ignores comments starting with # and empty lines.
+func LoadDotEnv(filename string) (MapProvider, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := MapProvider{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		// Remove quotes if present
+		value = strings.Trim(value, `"'`)
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// Encrypted file layout: magic | salt | nonce | AES-256-GCM(JSON map)
+var encryptedMagic = []byte("CHSEC1")
+
+const (
+	saltSize         = 16
+	pbkdf2Iterations = 600000
+)
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+}
+
+// LoadEncryptedFile decrypts a file written by WriteEncryptedFile.
+func LoadEncryptedFile(path, passphrase string) (MapProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return nil, fmt.Errorf("secrets: %s is not an encrypted secrets file", path)
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < saltSize {
+		return nil, fmt.Errorf("secrets: %s is truncated", path)
+	}
+	salt, data := data[:saltSize], data[saltSize:]
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("secrets: %s is truncated", path)
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, ciphertext, encryptedMagic)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: failed to decrypt %s (wrong passphrase?)", path)
+	}
+
+	values := MapProvider{}
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, fmt.Errorf("secrets: %s contains invalid data: %w", path, err)
+	}
+	return values, nil
+}
+
+// WriteEncryptedFile encrypts values with a key derived from passphrase and
+// writes them to path, readable by the owner only.
+func WriteEncryptedFile(path, passphrase string, values map[string]string) error {
+	if passphrase == "" {
+		return errors.New("secrets: passphrase must not be empty")
+	}
+
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.Write(encryptedMagic)
+	out.Write(salt)
+	out.Write(nonce)
+	out.Write(gcm.Seal(nil, nonce, plain, encryptedMagic))
+
+	return os.WriteFile(path, out.Bytes(), 0600)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RedactedPlaceholder replaces secret values in redacted output.
+const RedactedPlaceholder = "******"
+
+// minRedactLength skips very short values, which would mangle unrelated text.
+const minRedactLength = 4
+
+// Redactor masks registered secret values in text.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   []string
+	replacer *strings.Replacer
+}
+
+// NewRedactor creates a Redactor masking the given values.
+func NewRedactor(values ...string) *Redactor {
+	r := &Redactor{}
+	r.Add(values...)
+	return r
+}
+
+// Add registers more values to mask.
+func (r *Redactor) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range values {
+		if len(v) >= minRedactLength {
+			r.values = append(r.values, v)
+		}
+	}
+	// Longest first so a secret containing another is masked whole
+	sort.Slice(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+
+	var pairs []string
+	for _, v := range r.values {
+		pairs = append(pairs, v, RedactedPlaceholder)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact returns s with every registered value masked.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// Writer wraps w so everything written through it is redacted.
+// Suitable for log.SetOutput.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &redactingWriter{r: r, w: w}
+}
+
+type redactingWriter struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// RedactStdout sends everything written to os.Stdout from now on through
+// the Redactor. Output is passed on line by line so a secret split across
+// several writes is still masked; restore flushes what is left and puts the
+// original os.Stdout back. Values passed to Add after this are honoured.
+//
+// Writers that captured os.Stdout before the call (color.Output, for one)
+// keep writing to the original and must be pointed at os.Stdout again.
+func (r *Redactor) RedactStdout() (restore func(), err error) {
+	orig := os.Stdout
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	os.Stdout = pw
+
+	out := r.Writer(orig)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		br := bufio.NewReader(pr)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				io.WriteString(out, line)
+			}
+			if err != nil {
+				pr.Close()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.Stdout = orig
+			pw.Close()
+			<-done
+		})
+	}, nil
+}
@@ -0,0 +1,201 @@
+// Package secrets keeps credentials and personal profile data out of source.
+//
+// Values are looked up through a Provider chain (environment variables, a
+// .env file and an encrypted local file unlocked by a passphrase). Load
+// fails loudly when a required secret is missing, and Redactor masks every
+// loaded value in log output.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Secret keys
+const (
+	KeyUsername      = "CH_USERNAME"
+	KeyPassword      = "CH_PASSWORD"
+	KeyCustomerName  = "CH_CUSTOMER_NAME"
+	KeyPhone         = "CH_PHONE"
+	KeyEmail         = "CH_EMAIL"
+	KeyProxyUser     = "SMARTPROXY_USER"
+	KeyProxyPass     = "SMARTPROXY_PASS"
+	KeyProxyEndpoint = "SMARTPROXY_ENDPOINT"
+
+	// KeyPassphrase and KeyFile configure the encrypted file provider.
+	// They are read from the process environment only.
+	KeyPassphrase = "CH_SECRETS_PASSPHRASE"
+	KeyFile       = "CH_SECRETS_FILE"
+)
+
+// DefaultDotEnvPath and DefaultEncryptedPath are used by DefaultChain.
+const (
+	DefaultDotEnvPath    = ".env"
+	DefaultEncryptedPath = "secrets.enc"
+)
+
+// DefaultCustomerName is used when CH_CUSTOMER_NAME is not set.
+// A Japanese name avoids validation issues on the profile form.
+const DefaultCustomerName = "山田 太郎"
+
+// Provider looks up a secret by key.
+type Provider interface {
+	Lookup(key string) (string, bool)
+}
+
+// EnvProvider reads secrets from the process environment.
+type EnvProvider struct{}
+
+func (EnvProvider) Lookup(key string) (string, bool) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return "", false
+	}
+	return v, true
+}
+
+// MapProvider serves secrets from an in-memory map (used by the .env and
+// encrypted file providers).
+type MapProvider map[string]string
+
+func (m MapProvider) Lookup(key string) (string, bool) {
+	v, ok := m[key]
+	if !ok || v == "" {
+		return "", false
+	}
+	return v, true
+}
+
+// Chain tries each provider in order and returns the first value found.
+type Chain []Provider
+
+func (c Chain) Lookup(key string) (string, bool) {
+	for _, p := range c {
+		if v, ok := p.Lookup(key); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// DefaultChain builds the standard lookup order: environment, then the .env
+// file, then the encrypted secrets file (only when CH_SECRETS_PASSPHRASE is
+// set). Missing files are skipped; unreadable or undecryptable files are errors.
+func DefaultChain() (Chain, error) {
+	chain := Chain{EnvProvider{}}
+
+	dotEnv, err := LoadDotEnv(DefaultDotEnvPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("secrets: failed to read %s: %w", DefaultDotEnvPath, err)
+	}
+	if err == nil {
+		chain = append(chain, dotEnv)
+	}
+
+	passphrase := os.Getenv(KeyPassphrase)
+	path := os.Getenv(KeyFile)
+	if path == "" {
+		path = DefaultEncryptedPath
+	}
+	if passphrase != "" {
+		enc, err := LoadEncryptedFile(path, passphrase)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			chain = append(chain, enc)
+		}
+	} else if _, err := os.Stat(path); err == nil {
+		log.Printf("secrets: %s exists but %s is not set; encrypted secrets are ignored", path, KeyPassphrase)
+	}
+
+	return chain, nil
+}
+
+// Secrets holds every credential and profile value the bot needs.
+type Secrets struct {
+	Username string
+	Password string
+
+	// Profile info submitted on the input_profile page
+	CustomerName string
+	Phone        string
+	Email        string
+
+	// Smartproxy credentials (all three set, or none)
+	ProxyUser     string
+	ProxyPass     string
+	ProxyEndpoint string
+}
+
+// MissingError reports required secrets that could not be found.
+type MissingError struct {
+	Keys []string
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("secrets: missing required secrets: %s (set them in the environment, %s or %s)",
+		strings.Join(e.Keys, ", "), DefaultDotEnvPath, DefaultEncryptedPath)
+}
+
+// Load resolves all secrets from p. Every key in required must be present,
+// otherwise a *MissingError listing all of them is returned.
+func Load(p Provider, required ...string) (*Secrets, error) {
+	get := func(key string) string {
+		v, _ := p.Lookup(key)
+		return strings.TrimSpace(v)
+	}
+
+	s := &Secrets{
+		Username:      get(KeyUsername),
+		Password:      get(KeyPassword),
+		CustomerName:  get(KeyCustomerName),
+		Phone:         get(KeyPhone),
+		Email:         get(KeyEmail),
+		ProxyUser:     get(KeyProxyUser),
+		ProxyPass:     get(KeyProxyPass),
+		ProxyEndpoint: get(KeyProxyEndpoint),
+	}
+	if s.CustomerName == "" {
+		s.CustomerName = DefaultCustomerName
+	}
+
+	var missing []string
+	for _, key := range required {
+		if _, ok := p.Lookup(key); !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, &MissingError{Keys: missing}
+	}
+
+	// Partial proxy credentials are almost certainly a mistake
+	proxySet := 0
+	for _, v := range []string{s.ProxyUser, s.ProxyPass, s.ProxyEndpoint} {
+		if v != "" {
+			proxySet++
+		}
+	}
+	if proxySet != 0 && proxySet != 3 {
+		return nil, errors.New("secrets: SMARTPROXY_USER, SMARTPROXY_PASS and SMARTPROXY_ENDPOINT must be set together")
+	}
+
+	return s, nil
+}
+
+// HasProxy reports whether Smartproxy credentials are configured.
+func (s *Secrets) HasProxy() bool {
+	return s.ProxyUser != "" && s.ProxyPass != ""
+}
+
+// Values returns every sensitive value, for registration with a Redactor.
+// The proxy endpoint is not considered sensitive.
+func (s *Secrets) Values() []string {
+	return []string{s.Username, s.Password, s.CustomerName, s.Phone, s.Email, s.ProxyUser, s.ProxyPass}
+}
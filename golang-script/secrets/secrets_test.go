@@ -0,0 +1,275 @@
+package secrets_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"booker-bot/secrets"
+)
+
+func TestDefaultChainOrder(t *testing.T) {
+	const passphrase = "correct horse battery staple"
+	tests := []struct {
+		name       string
+		env        string // CH_USERNAME in the environment
+		dotEnv     string // CH_USERNAME in .env; no file if empty
+		encrypted  string // CH_USERNAME in the encrypted file; no file if empty
+		encFile    string // CH_SECRETS_FILE
+		passphrase string
+		want       string // "" if not found
+	}{
+		{name: "environment first", env: "from-env", dotEnv: "from-dotenv", encrypted: "from-enc", passphrase: passphrase, want: "from-env"},
+		{name: ".env before the encrypted file", dotEnv: "from-dotenv", encrypted: "from-enc", passphrase: passphrase, want: "from-dotenv"},
+		{name: "encrypted file last", encrypted: "from-enc", passphrase: passphrase, want: "from-enc"},
+		{name: "encrypted file needs the passphrase", encrypted: "from-enc"},
+		{name: "CH_SECRETS_FILE path", encrypted: "from-enc", encFile: "other.enc", passphrase: passphrase, want: "from-enc"},
+		{name: "nothing set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv(secrets.KeyUsername, tt.env)
+			t.Setenv(secrets.KeyPassphrase, tt.passphrase)
+			t.Setenv(secrets.KeyFile, tt.encFile)
+			if tt.dotEnv != "" {
+				content := fmt.Sprintf("# comment\n%s=%q\n", secrets.KeyUsername, tt.dotEnv)
+				if err := os.WriteFile(secrets.DefaultDotEnvPath, []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.encrypted != "" {
+				path := tt.encFile
+				if path == "" {
+					path = secrets.DefaultEncryptedPath
+				}
+				if err := secrets.WriteEncryptedFile(path, passphrase, map[string]string{secrets.KeyUsername: tt.encrypted}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			chain, err := secrets.DefaultChain()
+			if err != nil {
+				t.Fatalf("DefaultChain: %v", err)
+			}
+			if got, _ := chain.Lookup(secrets.KeyUsername); got != tt.want {
+				t.Errorf("%s = %q, want %q", secrets.KeyUsername, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultChainWrongPassphrase(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := secrets.WriteEncryptedFile(secrets.DefaultEncryptedPath, "right", map[string]string{secrets.KeyUsername: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(secrets.KeyPassphrase, "wrong")
+	t.Setenv(secrets.KeyFile, "")
+	if _, err := secrets.DefaultChain(); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("DefaultChain: err = %v, want a decryption error", err)
+	}
+}
+
+func TestDefaultChainWarnsWithoutPassphrase(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := secrets.WriteEncryptedFile(secrets.DefaultEncryptedPath, "right", map[string]string{secrets.KeyUsername: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(secrets.KeyPassphrase, "")
+	t.Setenv(secrets.KeyFile, "")
+	var b strings.Builder
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stderr)
+
+	if _, err := secrets.DefaultChain(); err != nil {
+		t.Fatalf("DefaultChain: %v", err)
+	}
+	if !strings.Contains(b.String(), "encrypted secrets are ignored") {
+		t.Errorf("log = %q, want the ignored-file warning", b.String())
+	}
+}
+
+func TestEncryptedFile(t *testing.T) {
+	dir := t.TempDir()
+	sealed := filepath.Join(dir, "secrets.enc")
+	values := map[string]string{secrets.KeyUsername: "user@example.com", secrets.KeyPassword: "hunter2!"}
+	if err := secrets.WriteEncryptedFile(sealed, "passphrase", values); err != nil {
+		t.Fatalf("WriteEncryptedFile: %v", err)
+	}
+	if data, err := os.ReadFile(sealed); err != nil || strings.Contains(string(data), "hunter2") {
+		t.Fatalf("sealed file holds the plaintext (err %v)", err)
+	}
+	plain := filepath.Join(dir, "plain.txt")
+	if err := os.WriteFile(plain, []byte("CH_USERNAME=u\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		passphrase string
+		wantErr    string // "" for success
+	}{
+		{name: "round trip", path: sealed, passphrase: "passphrase"},
+		{name: "wrong passphrase", path: sealed, passphrase: "Passphrase", wantErr: "wrong passphrase"},
+		{name: "not sealed", path: plain, passphrase: "passphrase", wantErr: "not an encrypted secrets file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := secrets.LoadEncryptedFile(tt.path, tt.passphrase)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadEncryptedFile: %v", err)
+			}
+			for k, v := range values {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	base := secrets.MapProvider{
+		secrets.KeyUsername: "user@example.com",
+		secrets.KeyPassword: "hunter2!",
+		secrets.KeyPhone:    "09012345678",
+	}
+	with := func(extra map[string]string) secrets.MapProvider {
+		p := secrets.MapProvider{}
+		for k, v := range base {
+			p[k] = v
+		}
+		for k, v := range extra {
+			p[k] = v
+		}
+		return p
+	}
+	required := []string{secrets.KeyUsername, secrets.KeyPassword, secrets.KeyPhone}
+
+	tests := []struct {
+		name      string
+		provider  secrets.MapProvider
+		missing   []string // Keys of the expected *MissingError
+		wantErr   string   // Other expected error
+		wantProxy bool
+	}{
+		{name: "all set", provider: base},
+		{name: "missing keys sorted", provider: secrets.MapProvider{secrets.KeyUsername: "u"},
+			missing: []string{secrets.KeyPassword, secrets.KeyPhone}},
+		{name: "empty counts as missing", provider: with(map[string]string{secrets.KeyPassword: ""}),
+			missing: []string{secrets.KeyPassword}},
+		{name: "full proxy", provider: with(map[string]string{
+			secrets.KeyProxyUser: "pu", secrets.KeyProxyPass: "pp", secrets.KeyProxyEndpoint: "gate:7000"}), wantProxy: true},
+		{name: "proxy without endpoint", provider: with(map[string]string{
+			secrets.KeyProxyUser: "pu", secrets.KeyProxyPass: "pp"}), wantErr: "must be set together"},
+		{name: "proxy endpoint only", provider: with(map[string]string{
+			secrets.KeyProxyEndpoint: "gate:7000"}), wantErr: "must be set together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := secrets.Load(tt.provider, required...)
+			var missing *secrets.MissingError
+			switch {
+			case tt.missing != nil:
+				if !errors.As(err, &missing) || !slices.Equal(missing.Keys, tt.missing) {
+					t.Fatalf("err = %v, want missing %v", err, tt.missing)
+				}
+				return
+			case tt.wantErr != "":
+				if err == nil || errors.As(err, &missing) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("Load: %v", err)
+			}
+			if s.HasProxy() != tt.wantProxy {
+				t.Errorf("HasProxy = %v, want %v", s.HasProxy(), tt.wantProxy)
+			}
+			if s.CustomerName != secrets.DefaultCustomerName {
+				t.Errorf("CustomerName = %q, want the default", s.CustomerName)
+			}
+			// Everything the profile form submits is redacted
+			for _, v := range []string{s.Username, s.Password, s.CustomerName, s.Phone} {
+				if !slices.Contains(s.Values(), v) {
+					t.Errorf("Values() = %q, missing %q", s.Values(), v)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		in     string
+		want   string
+	}{
+		{name: "masks values", values: []string{"user@example.com", "hunter2!"},
+			in: "login user@example.com / hunter2!", want: "login ****** / ******"},
+		{name: "longest first", values: []string{"hunter", "hunter2!"},
+			in: "pw=hunter2!", want: "pw=******"},
+		{name: "short values ignored", values: []string{"abc", ""},
+			in: "abc def", want: "abc def"},
+		{name: "nothing registered", in: "plain", want: "plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := secrets.NewRedactor(tt.values...)
+			if got := r.Redact(tt.in); got != tt.want {
+				t.Errorf("Redact = %q, want %q", got, tt.want)
+			}
+			var b strings.Builder
+			if _, err := fmt.Fprint(r.Writer(&b), tt.in); err != nil || b.String() != tt.want {
+				t.Errorf("Writer wrote %q (err %v), want %q", b.String(), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactStdout(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	orig := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = orig }()
+
+	r := secrets.NewRedactor("hunter2!")
+	restore, err := r.RedactStdout()
+	if err != nil {
+		t.Fatalf("RedactStdout: %v", err)
+	}
+	// One line printed in pieces, and a tail without a newline
+	fmt.Print("password: hun")
+	fmt.Println("ter2!")
+	fmt.Print("again hunter2!")
+	restore()
+	if os.Stdout != out {
+		t.Errorf("restore did not put the original stdout back")
+	}
+
+	got, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "password: ******\nagain ******"; string(got) != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+}